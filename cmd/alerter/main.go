@@ -1,28 +1,43 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
 
 	"github.com/jeffspahr/bourbontracker/pkg/alerts"
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
+	"github.com/jeffspahr/bourbontracker/pkg/nc/wake"
 	"github.com/jeffspahr/bourbontracker/pkg/tracker"
 )
 
 var (
-	previousVAFile    = flag.String("previous-va", "", "Path to previous VA inventory JSON")
-	previousNCFile    = flag.String("previous-nc", "", "Path to previous NC inventory JSON")
-	currentVAFile     = flag.String("current-va", "", "Path to current VA inventory JSON")
-	currentNCFile     = flag.String("current-nc", "", "Path to current NC inventory JSON")
+	previousVAFile    = flag.String("previous-va", "", "Path to previous VA inventory (JSON array or envelope)")
+	previousNCFile    = flag.String("previous-nc", "", "Path to previous NC inventory (JSON array or envelope)")
+	currentVAFile     = flag.String("current-va", "", "Path to current VA inventory (JSON array or envelope)")
+	currentNCFile     = flag.String("current-nc", "", "Path to current NC inventory (JSON array or envelope)")
+	previousReport    = flag.String("previous-report", "", "Path to the previous run report (from tracker -report)")
+	currentReport     = flag.String("current-report", "", "Path to the current run report (from tracker -report)")
+	wakeStoresFile    = flag.String("wake-stores", "", "Path to the Wake County store registry (default: built in)")
 	subscriptionsFile = flag.String("subscriptions", "", "Path to subscriptions config file")
-	dryRun            = flag.Bool("dry-run", false, "Print email preview instead of sending")
+	ledgerFile        = flag.String("ledger", "", "Path to the alert ledger; alerts already sent within their cooldown are skipped")
+	outboxFile        = flag.String("outbox", "", "Path to the outbox; alerts wait there for delivery schedules and retries (required for delivery schedules)")
+	dryRun            = flag.Bool("dry-run", false, "Print alert previews instead of sending")
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "outbox" {
+		if err := runOutbox(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	logOptions := logging.BindFlags(flag.CommandLine)
 	flag.Parse()
+	logger := logging.Setup(logOptions)
 
 	// Load inventories
 	previousVA := loadInventory(*previousVAFile)
@@ -30,128 +45,151 @@ func main() {
 	currentVA := loadInventory(*currentVAFile)
 	currentNC := loadInventory(*currentNCFile)
 
-	// Combine VA and NC inventories
-	previous := append(previousVA, previousNC...)
-	current := append(currentVA, currentNC...)
+	// NC snapshots from before the store registry used display names as
+	// store IDs; map them to registry IDs so they compare with current ones
+	stores, err := wake.LoadStores(*wakeStoresFile)
+	if err != nil {
+		logging.Fatal(logger, "Failed to load Wake store registry", logging.KeyError, err)
+	}
+	previousNC.Items = stores.Canonicalize(previousNC.Items)
+	currentNC.Items = stores.Canonicalize(currentNC.Items)
 
 	// Skip alerts if no previous inventory (avoid spam on first run)
-	if len(previous) == 0 {
-		log.Println("No previous inventory - skipping alerts on first run")
+	if len(previousVA.Items) == 0 && len(previousNC.Items) == 0 {
+		logger.Info("No previous inventory - skipping alerts on first run")
 		return
 	}
 
-	// Detect changes
-	changes := alerts.DetectChanges(previous, current)
+	// Coverage tells us which stores/products each run actually scanned
+	prevReport := loadReport(*previousReport)
+	currReport := loadReport(*currentReport)
+
+	// Detect changes separately per tracker, since each has its own coverage.
+	// A tracker whose run the -max-drop guard rejected has no current
+	// snapshot to compare.
+	changes := &alerts.ComparisonResult{}
+	for _, source := range []struct {
+		name              string
+		previous, current *tracker.Envelope
+	}{
+		{"va", previousVA, currentVA},
+		{"wake", previousNC, currentNC},
+	} {
+		if rejected(currReport, source.name) {
+			logger.Warn("Skipping alerts for a tracker whose run was not published", logging.KeyTracker, source.name)
+			continue
+		}
+		changes.Merge(alerts.DetectSnapshotChanges(
+			snapshotOf(source.previous, prevReport, source.name),
+			snapshotOf(source.current, currReport, source.name),
+		))
+	}
 
-	log.Printf("Detected %d new items, %d removed items, %d quantity changes",
-		len(changes.NewItems), len(changes.RemovedItems), len(changes.QuantityChanges))
+	logger.Info("Detected changes", "new", len(changes.NewItems),
+		"removed", len(changes.RemovedItems), "quantity_changes", len(changes.QuantityChanges))
+	if len(changes.Uncovered) > 0 {
+		logger.Info("Skipped items at stores/products not scanned in both runs", "uncovered", len(changes.Uncovered))
+	}
 
-	if len(changes.NewItems) == 0 {
-		log.Println("No new items detected - no alerts to send")
+	// Queued digests may come due without new changes
+	if len(changes.NewItems) == 0 && len(changes.QuantityChanges) == 0 && len(changes.RemovedItems) == 0 && *outboxFile == "" {
+		logger.Info("No changes detected - no alerts to send")
 		return
 	}
 
 	// Load subscriptions config
 	if *subscriptionsFile == "" {
-		log.Println("No subscriptions file specified (-subscriptions flag)")
-		log.Println("Use -subscriptions to enable multi-user alerts")
+		logger.Info("No subscriptions file specified; use -subscriptions to enable multi-user alerts")
 		return
 	}
 
 	config, err := alerts.LoadConfig(*subscriptionsFile)
 	if err != nil {
-		log.Fatalf("Failed to load subscriptions config: %v", err)
+		logging.Fatal(logger, "Failed to load subscriptions config", logging.KeyError, err)
 	}
 
-	subscribers := alerts.GetEnabledSubscribers(config)
-	log.Printf("Loaded %d enabled subscriber(s)", len(subscribers))
-
-	if len(subscribers) == 0 {
-		log.Println("No enabled subscribers - no alerts to send")
-		return
+	alerter := alerts.NewAlerter(config, *dryRun, os.Stdout)
+	if *ledgerFile != "" {
+		alerter.Ledger, err = alerts.LoadLedger(*ledgerFile)
+		if err != nil {
+			logging.Fatal(logger, "Failed to load alert ledger", logging.KeyError, err)
+		}
 	}
-
-	// Filter changes for each subscriber based on their preferences
-	itemsPerSubscriber := make(map[string][]tracker.InventoryItem)
-	totalMatches := 0
-
-	for _, sub := range subscribers {
-		filtered := alerts.FilterForSubscriber(changes.NewItems, sub.Preferences)
-		if len(filtered) > 0 {
-			itemsPerSubscriber[sub.ID] = filtered
-			totalMatches += len(filtered)
-			log.Printf("Subscriber %s: %d matching items", sub.ID, len(filtered))
-		} else {
-			log.Printf("Subscriber %s: no matches", sub.ID)
+	if *outboxFile != "" {
+		alerter.Outbox, err = alerts.LoadOutbox(*outboxFile)
+		if err != nil {
+			logging.Fatal(logger, "Failed to load outbox", logging.KeyError, err)
 		}
 	}
-
-	if totalMatches == 0 {
-		log.Println("No items matched any subscriber preferences - no alerts to send")
-		return
+	if err := alerter.Run(changes); err != nil {
+		logging.Fatal(logger, "Failed to send alerts", logging.KeyError, err)
 	}
+}
 
-	// Dry run mode: print previews instead of sending
-	if *dryRun {
-		log.Println("\n=== DRY RUN MODE - Email Previews ===")
-		for _, sub := range subscribers {
-			items, ok := itemsPerSubscriber[sub.ID]
-			if !ok || len(items) == 0 {
-				continue
-			}
-
-			fmt.Printf("\n--- Email for %s (%s) ---\n", sub.ID, sub.Email)
-			fmt.Printf("Subject: Cask Watch Alert: %d New Allocation Item%s\n",
-				len(items), pluralize(len(items)))
-			fmt.Printf("Items:\n")
-			for _, item := range items {
-				fmt.Printf("  - %s (%s, %d bottles)\n", item.ProductName, item.StoreID, item.Quantity)
-			}
-		}
-		return
+// loadInventory loads an inventory file, either an envelope or a legacy
+// JSON array. A missing or unreadable file yields an empty inventory.
+func loadInventory(filePath string) *tracker.Envelope {
+	if filePath == "" {
+		return &tracker.Envelope{}
 	}
 
-	// Create mailer
-	mailer, err := alerts.NewMailer(config.Mailgun.FromEmail, config.Mailgun.FromName)
+	inventory, err := tracker.LoadInventory(filePath)
 	if err != nil {
-		log.Fatalf("Failed to initialize mailer: %v", err)
+		// File might not exist (first run or tracker failure)
+		slog.Warn("Could not load inventory", "path", filePath, logging.KeyError, err)
+		return &tracker.Envelope{}
 	}
 
-	// Send alerts
-	if err := mailer.SendAlertBatch(subscribers, itemsPerSubscriber); err != nil {
-		log.Printf("Warning: Some emails failed to send: %v", err)
-		os.Exit(1)
-	}
+	return inventory
+}
 
-	log.Println("Alert batch complete")
+// snapshotOf pairs an inventory with its coverage, taken from the run report
+// if one was given, or else from the inventory's own envelope
+func snapshotOf(inventory *tracker.Envelope, report *tracker.RunReport, name string) alerts.Snapshot {
+	coverage := coverageFor(report, name)
+	if coverage == nil {
+		coverage = inventory.Coverage
+	}
+	return alerts.Snapshot{Items: inventory.Items, Coverage: coverage}
 }
 
-// loadInventory loads inventory from a JSON file
-func loadInventory(filePath string) []tracker.InventoryItem {
+// loadReport loads a tracker run report, returning nil if unavailable
+func loadReport(filePath string) *tracker.RunReport {
 	if filePath == "" {
-		return []tracker.InventoryItem{}
+		return nil
 	}
 
-	data, err := ioutil.ReadFile(filePath)
+	report, err := tracker.LoadRunReport(filePath)
 	if err != nil {
-		// File might not exist (first run or tracker failure)
-		log.Printf("Warning: Could not read %s: %v", filePath, err)
-		return []tracker.InventoryItem{}
+		slog.Warn("Could not load run report", "path", filePath, logging.KeyError, err)
+		return nil
 	}
 
-	var items []tracker.InventoryItem
-	if err := json.Unmarshal(data, &items); err != nil {
-		log.Printf("Warning: Could not parse %s: %v", filePath, err)
-		return []tracker.InventoryItem{}
+	return report
+}
+
+// coverageFor returns the named tracker's coverage from a run report.
+// Without a report, the snapshot is assumed to cover everything. A rejected
+// run's coverage describes inventory that was never published, so it is
+// ignored too.
+func coverageFor(report *tracker.RunReport, name string) *tracker.Coverage {
+	if report == nil {
+		return nil
 	}
 
-	return items
+	r, ok := report.Find(name)
+	if !ok || r.Rejected {
+		return nil
+	}
+	return r.Coverage
 }
 
-// pluralize returns "s" if count != 1, otherwise empty string
-func pluralize(count int) string {
-	if count == 1 {
-		return ""
+// rejected reports whether the -max-drop guard refused to publish the named
+// tracker's run
+func rejected(report *tracker.RunReport, name string) bool {
+	if report == nil {
+		return false
 	}
-	return "s"
+	r, ok := report.Find(name)
+	return ok && r.Rejected
 }
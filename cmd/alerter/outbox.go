@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/alerts"
+)
+
+// statuses lists notification statuses in the order they are reported
+var statuses = []string{alerts.StatusPending, alerts.StatusFailed, alerts.StatusDead, alerts.StatusSent}
+
+// runOutbox implements "alerter outbox": list notifications by status, or
+// requeue failed and dead-lettered ones with "retry"
+func runOutbox(args []string) error {
+	fs := flag.NewFlagSet("outbox", flag.ExitOnError)
+	path := fs.String("outbox", "alert-outbox.json", "Path to the outbox")
+	status := fs.String("status", "", "Only list notifications with this status (pending, failed, dead or sent)")
+	asJSON := fs.Bool("json", false, "List notifications as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: alerter outbox [flags] [list | retry [ID...]]\n\n")
+		fmt.Fprintf(fs.Output(), "list shows notifications by status; retry requeues the given notifications,\nor every dead-lettered one\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	outbox, err := alerts.LoadOutbox(*path)
+	if err != nil {
+		return fmt.Errorf("failed to load outbox: %w", err)
+	}
+
+	action := fs.Arg(0)
+	switch action {
+	case "", "list":
+		notifications := outbox.Notifications()
+		if *status != "" {
+			var filtered []alerts.Notification
+			for _, n := range notifications {
+				if n.Status == *status {
+					filtered = append(filtered, n)
+				}
+			}
+			notifications = filtered
+		}
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(notifications)
+		}
+		writeOutbox(os.Stdout, outbox, notifications)
+		return nil
+	case "retry":
+		requeued, err := requeue(outbox, fs.Args()[1:], time.Now())
+		if err != nil {
+			return err
+		}
+		if requeued == 0 {
+			fmt.Println("Nothing to retry")
+			return nil
+		}
+		if err := outbox.Save(); err != nil {
+			return fmt.Errorf("failed to save outbox: %w", err)
+		}
+		fmt.Printf("Requeued %d notification(s); they are sent on the next delivery\n", requeued)
+		return nil
+	}
+
+	fs.Usage()
+	return fmt.Errorf("unknown outbox action: %s", action)
+}
+
+// requeue makes the notifications with the given ID prefixes due again, or
+// every dead-lettered one if no IDs are given
+func requeue(outbox *alerts.Outbox, ids []string, now time.Time) (int, error) {
+	if len(ids) == 0 {
+		requeued := 0
+		for _, n := range outbox.Notifications() {
+			if n.Status != alerts.StatusDead {
+				continue
+			}
+			found, err := outbox.Find(n.ID)
+			if err != nil {
+				return requeued, err
+			}
+			if err := found.Requeue(now); err != nil {
+				return requeued, err
+			}
+			requeued++
+		}
+		return requeued, nil
+	}
+
+	for _, id := range ids {
+		n, err := outbox.Find(id)
+		if err != nil {
+			return 0, err
+		}
+		if err := n.Requeue(now); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// writeOutbox prints a summary of the outbox and a table of notifications
+func writeOutbox(w io.Writer, outbox *alerts.Outbox, notifications []alerts.Notification) {
+	counts := outbox.Counts()
+	var summary []string
+	for _, status := range statuses {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[status], status))
+	}
+	fmt.Fprintf(w, "Notifications: %s\n", strings.Join(summary, ", "))
+
+	if held := outbox.Held(); held > 0 {
+		fmt.Fprintf(w, "Held for delivery schedules: %d alert set(s)\n", held)
+	}
+	if len(notifications) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tSUBSCRIBER\tCHANNEL\tCHANGES\tATTEMPTS\tWHEN\tLAST ERROR")
+	for _, n := range notifications {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			shortID(n.ID), n.Status, n.Subscriber, n.Channel.String(), n.Set.Total(), n.Attempts, when(n), truncate(n.LastError, 60))
+	}
+	tw.Flush()
+}
+
+// shortID abbreviates a notification ID for the table; IDs from a
+// hand-edited outbox may be shorter than the usual prefix
+func shortID(id string) string {
+	if len(id) <= 12 {
+		return id
+	}
+	return id[:12]
+}
+
+// when describes a notification's next attempt or when it was sent
+func when(n alerts.Notification) string {
+	switch n.Status {
+	case alerts.StatusSent:
+		return "sent " + n.SentAt.Local().Format("Jan 2 15:04")
+	case alerts.StatusPending, alerts.StatusFailed:
+		return "next " + n.NextAttempt.Local().Format("Jan 2 15:04")
+	}
+	return "-"
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -1,21 +1,26 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"flag"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
 )
 
 func main() {
+	logOptions := logging.BindFlags(flag.CommandLine)
+	flag.Parse()
+	logger := logging.Setup(logOptions)
+
 	var stores []string
 
 	// Add rate limiting to avoid API blocking
 	baseDelay := 250 * time.Millisecond
 
-	fmt.Println("Scanning for valid Virginia ABC store numbers (0-499)...")
+	logger.Info("Scanning for valid Virginia ABC store numbers", "first", 0, "last", 499)
 
 	for i := 0; i < 500; i++ {
 		// Sleep before each request except the first
@@ -26,7 +31,7 @@ func main() {
 		client := &http.Client{}
 		req, err := http.NewRequest("GET", "https://www.abc.virginia.gov/webapi/inventory/mystore", nil)
 		if err != nil {
-			log.Fatal(err)
+			logging.Fatal(logger, "Failed to create request", logging.KeyError, err)
 		}
 		req.Header.Add("Content-type", "application/json")
 		req.Header.Add("Accept", "application/json")
@@ -39,36 +44,35 @@ func main() {
 
 		resp, err := client.Do(req)
 		if err != nil {
-			log.Fatal(err)
+			logging.Fatal(logger, "Store request failed", logging.KeyStoreID, i, logging.KeyError, err)
 		}
 
 		if resp.StatusCode == 200 {
 			stores = append(stores, strconv.Itoa(i))
-			fmt.Printf("✓ Store %d is valid (%d/%d)\n", i, len(stores), i+1)
+			logger.Info("Store is valid", logging.KeyStoreID, i, "valid", len(stores), "scanned", i+1)
 		} else if i%50 == 0 {
 			// Show progress every 50 stores
-			fmt.Printf("  Scanned %d/%d stores, found %d valid...\n", i+1, 500, len(stores))
+			logger.Info("Progress", "scanned", i+1, "total", 500, "valid", len(stores))
 		}
 
 		resp.Body.Close()
 	}
-	fmt.Printf("\n✅ Scan complete! Found %d valid stores out of 500\n", len(stores))
-	fmt.Println("Writing stores to 'stores' file...")
+	logger.Info("Scan complete", "valid", len(stores), "total", 500)
 
 	// If the file doesn't exist, create it, or append to the file
 	file, err := os.OpenFile("stores", os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0755)
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal(logger, "Failed to open stores file", logging.KeyError, err)
 	}
 	for i := 0; i < len(stores); i++ {
 		if _, err := file.WriteString(stores[i] + "\n"); err != nil {
 			file.Close() // ignore error; Write error takes precedence
-			log.Fatal(err)
+			logging.Fatal(logger, "Failed to write stores file", logging.KeyError, err)
 		}
 	}
 	if err := file.Close(); err != nil {
-		log.Fatal(err)
+		logging.Fatal(logger, "Failed to write stores file", logging.KeyError, err)
 	}
 
-	fmt.Printf("✅ Successfully wrote %d store numbers to 'stores' file\n", len(stores))
+	logger.Info("Stores written", "path", "stores", "stores", len(stores))
 }
@@ -5,13 +5,13 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
 )
 
 // NCProduct represents a product from NC ABC warehouse
@@ -25,62 +25,63 @@ type NCProduct struct {
 }
 
 var (
-	outputFile = flag.String("output", "nc-products.json", "Output JSON file")
+	outputFile  = flag.String("output", "nc-products.json", "Output JSON file")
 	listingType = flag.String("listing", "", "Filter by listing type (Limited, Allocation, Listed, Barrel, Christmas)")
-	minCases   = flag.Int("min-cases", 0, "Minimum cases available to include")
+	minCases    = flag.Int("min-cases", 0, "Minimum cases available to include")
 )
 
 func main() {
+	logOptions := logging.BindFlags(flag.CommandLine)
 	flag.Parse()
+	logger := logging.Setup(logOptions)
 
-	fmt.Fprintf(os.Stderr, "Fetching NC ABC warehouse stock data...\n")
+	logger.Info("Fetching NC ABC warehouse stock data")
 
 	resp, err := http.Get("https://abc2.nc.gov/StoresBoards/Stocks")
 	if err != nil {
-		log.Fatalf("Failed to fetch stock page: %v", err)
+		logging.Fatal(logger, "Failed to fetch stock page", logging.KeyError, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("Unexpected status code: %d", resp.StatusCode)
+		logging.Fatal(logger, "Unexpected status code", logging.KeyStatus, resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatalf("Failed to read response: %v", err)
+		logging.Fatal(logger, "Failed to read response", logging.KeyError, err)
 	}
 
 	products, err := parseStockPage(string(body))
 	if err != nil {
-		log.Fatalf("Failed to parse stock page: %v", err)
+		logging.Fatal(logger, "Failed to parse stock page", logging.KeyError, err)
 	}
 
 	// Apply filters
 	filtered := filterProducts(products)
 
-	fmt.Fprintf(os.Stderr, "Found %d products (filtered from %d total)\n", len(filtered), len(products))
+	logger.Info("Found products", "products", len(filtered), "total", len(products))
 
 	// Write to JSON
 	data, err := json.MarshalIndent(filtered, "", "  ")
 	if err != nil {
-		log.Fatalf("Failed to marshal JSON: %v", err)
+		logging.Fatal(logger, "Failed to marshal JSON", logging.KeyError, err)
 	}
 
 	if err := os.WriteFile(*outputFile, data, 0644); err != nil {
-		log.Fatalf("Failed to write output file: %v", err)
+		logging.Fatal(logger, "Failed to write output file", "path", *outputFile, logging.KeyError, err)
 	}
 
-	fmt.Fprintf(os.Stderr, "Wrote %d products to %s\n", len(filtered), *outputFile)
+	logger.Info("Products written", "products", len(filtered), "path", *outputFile)
 
-	// Print summary by listing type
+	// Log a summary by listing type
 	typeCount := make(map[string]int)
 	for _, p := range filtered {
 		typeCount[p.ListingType]++
 	}
 
-	fmt.Fprintf(os.Stderr, "\nBreakdown by Listing Type:\n")
 	for listType, count := range typeCount {
-		fmt.Fprintf(os.Stderr, "  %s: %d\n", listType, count)
+		logger.Info("Listing type breakdown", "listing_type", listType, "products", count)
 	}
 }
 
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/api"
+	"github.com/jeffspahr/bourbontracker/pkg/history"
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
+)
+
+var (
+	addr           = flag.String("addr", ":8080", "Address to listen on")
+	inventoryFiles = flag.String("inventory", "inventory-va.json,inventory-nc.json", "Comma-separated inventory JSON files written by the tracker")
+	historyFile    = flag.String("history", "", "Path to the tracker's history log (enables /api/v1/history endpoints)")
+)
+
+func main() {
+	logOptions := logging.BindFlags(flag.CommandLine)
+	flag.Parse()
+	logger := logging.Setup(logOptions)
+
+	var paths []string
+	for _, path := range strings.Split(*inventoryFiles, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		logging.Fatal(logger, "No inventory files specified (-inventory)")
+	}
+
+	var historyLog *history.Log
+	if *historyFile != "" {
+		historyLog = history.Open(*historyFile)
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           api.NewServer(api.NewFileSource(paths), historyLog).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Serving inventory", "files", strings.Join(paths, ","), "addr", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logging.Fatal(logger, "Server failed", logging.KeyError, err)
+	}
+}
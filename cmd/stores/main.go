@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/geocode"
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
+	"github.com/jeffspahr/bourbontracker/pkg/nc/wake"
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+var (
+	registryFile   = flag.String("registry", "pkg/nc/wake/stores.json", "Wake County store registry to update")
+	inventoryFiles = flag.String("inventory", "inventory-nc.json", "Comma-separated Wake inventory files to find unknown stores in")
+	discover       = flag.Bool("discover", false, "Also search wakeabc.com for widely stocked products to find store addresses")
+	geocoderURL    = flag.String("geocoder-url", geocode.DefaultNominatimURL, "Nominatim-compatible geocoding server (empty to use only -overrides)")
+	userAgent      = flag.String("user-agent", "BourbonTracker/1.0 (store registry updater)", "User-Agent sent to the geocoding server")
+	overridesFile  = flag.String("overrides", "pkg/nc/wake/geocode-overrides.json", "JSON file of hand-entered coordinates by address")
+	cacheFile      = flag.String("cache", ".geocoding-cache.json", "JSON file caching geocoding results between runs")
+	dryRun         = flag.Bool("dry-run", false, "Report what would change without writing the registry")
+)
+
+func main() {
+	logOptions := logging.BindFlags(flag.CommandLine)
+	flag.Parse()
+	logger := logging.Setup(logOptions)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stores, err := wake.LoadStores(*registryFile)
+	if err != nil {
+		logging.Fatal(logger, "Failed to load store registry", logging.KeyError, err)
+	}
+
+	addresses := findAddresses(ctx, logger, stores)
+	logger.Info("Found unknown store addresses", "addresses", len(addresses), "registry", stores.Len())
+
+	overrides, err := geocode.LoadOverrides(*overridesFile)
+	if err != nil {
+		logging.Fatal(logger, "Failed to load geocoding overrides", logging.KeyError, err)
+	}
+	cache, err := geocode.LoadCache(*cacheFile)
+	if err != nil {
+		logging.Fatal(logger, "Failed to load geocoding cache", logging.KeyError, err)
+	}
+
+	// Overrides win over the cache, so a correction applies to addresses
+	// that were already geocoded wrongly
+	geocoder := geocode.Chain{overrides}
+	if *geocoderURL != "" {
+		geocoder = append(geocoder, cache.Wrap(geocode.NewNominatim(*geocoderURL, *userAgent)))
+	}
+
+	added, located := 0, 0
+	for _, address := range addresses {
+		if ctx.Err() != nil {
+			break
+		}
+		// An address added earlier in this run may already cover it
+		if store, ok := stores.Resolve(address); ok {
+			logger.Info("Address resolves to a store added this run", "address", address, logging.KeyStoreID, store.ID)
+			continue
+		}
+
+		location, ok := locate(ctx, logger, geocoder, address)
+		if !ok {
+			continue
+		}
+		store := stores.NewStore(address, location)
+		if err := stores.Add(store); err != nil {
+			logger.Warn("Could not add store", "address", address, logging.KeyError, err)
+			continue
+		}
+		logger.Info("Added store", logging.KeyStoreID, store.ID, "address", address,
+			"lat", location.Latitude, "lon", location.Longitude)
+		added++
+	}
+
+	// Stores entered by hand may not have coordinates yet
+	for _, store := range stores.List() {
+		if ctx.Err() != nil {
+			break
+		}
+		if store.Location != (tracker.Location{}) {
+			continue
+		}
+		location, ok := locate(ctx, logger, geocoder, store.Address)
+		if !ok {
+			continue
+		}
+		stores.SetLocation(store.ID, location)
+		logger.Info("Located store", logging.KeyStoreID, store.ID, "lat", location.Latitude, "lon", location.Longitude)
+		located++
+	}
+
+	if err := cache.Save(); err != nil {
+		logger.Warn("Failed to save geocoding cache", "path", *cacheFile, logging.KeyError, err)
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		logging.Fatal(logger, "Interrupted; registry not written", "added", added, "located", located)
+	case added == 0 && located == 0:
+		logger.Info("Store registry is up to date", "path", *registryFile)
+	case *dryRun:
+		logger.Info("Dry run; registry not written", "added", added, "located", located)
+	default:
+		if err := stores.Save(*registryFile); err != nil {
+			logging.Fatal(logger, "Failed to write store registry", logging.KeyError, err)
+		}
+		logger.Info("Store registry updated; review new IDs and names before committing",
+			"path", *registryFile, "added", added, "located", located)
+	}
+}
+
+// findAddresses collects store addresses the registry doesn't know, from the
+// given inventory files and, with -discover, from wakeabc.com searches
+func findAddresses(ctx context.Context, logger *slog.Logger, stores *wake.Stores) []string {
+	seen := make(map[string]bool)
+	var addresses []string
+	add := func(address string) {
+		if !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+
+	for _, path := range strings.Split(*inventoryFiles, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		inventory, err := tracker.LoadInventory(path)
+		if err != nil {
+			logger.Warn("Could not load inventory", "path", path, logging.KeyError, err)
+			continue
+		}
+		for _, address := range stores.UnknownAddresses(inventory.Items) {
+			add(address)
+		}
+	}
+
+	if *discover {
+		client := &http.Client{Timeout: 30 * time.Second}
+		found, err := wake.DiscoverAddresses(ctx, client, wake.DefaultDiscoveryTerms)
+		if err != nil {
+			logging.Fatal(logger, "Failed to search wakeabc.com for store addresses", logging.KeyError, err)
+		}
+		logger.Info("Searched wakeabc.com", "addresses", len(found))
+		for _, address := range found {
+			if _, ok := stores.Resolve(address); !ok {
+				add(address)
+			}
+		}
+	}
+	return addresses
+}
+
+// locate geocodes an address, logging failures
+func locate(ctx context.Context, logger *slog.Logger, geocoder geocode.Geocoder, address string) (tracker.Location, bool) {
+	location, err := geocoder.Geocode(ctx, address)
+	switch {
+	case ctx.Err() != nil:
+		return location, false
+	case errors.Is(err, geocode.ErrNotFound):
+		logger.Warn("Address not found; add its coordinates to the -overrides file", "address", address)
+		return location, false
+	case err != nil:
+		logger.Warn("Geocoding failed", "address", address, logging.KeyError, err)
+		return location, false
+	}
+	return location, true
+}
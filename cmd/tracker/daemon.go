@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/alerts"
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+var (
+	daemonMode        = flag.Bool("daemon", false, "Run continuously, each tracker on its own schedule")
+	listenAddr        = flag.String("listen", ":8081", "Address for /healthz, /readyz and /metrics in daemon mode")
+	scheduleList      = flag.String("schedule", "", "Per-tracker run intervals in daemon mode, e.g. va=6h,wake=1h (default: each tracker's own interval)")
+	subscriptionsFile = flag.String("subscriptions", "", "Subscriptions config; in daemon mode alerts are sent after each cycle")
+	alertDryRun       = flag.Bool("alert-dry-run", false, "Print alert previews instead of sending them (daemon mode)")
+	alertLedgerFile   = flag.String("alert-ledger", "", "Alert ledger; alerts already sent within their cooldown are skipped (daemon mode)")
+	alertOutboxFile   = flag.String("alert-outbox", "", "Outbox for alerts waiting on digests, quiet hours or retries (daemon mode; default: in memory)")
+	shutdownGrace     = flag.Duration("shutdown-grace", 30*time.Second, "On SIGTERM in daemon mode, how long in-flight trackers may run before partial results are checkpointed")
+)
+
+// deliverInterval is how often the daemon checks the outbox for alerts due
+// between cycles
+const deliverInterval = time.Minute
+
+// trackerStatus is a tracker's state as reported by /readyz
+type trackerStatus struct {
+	Interval     string    `json:"interval"`
+	Running      bool      `json:"running"`
+	Ready        bool      `json:"ready"` // Completed at least one run
+	LastStarted  time.Time `json:"last_started,omitzero"`
+	LastFinished time.Time `json:"last_finished,omitzero"`
+	LastItems    int       `json:"last_items"`
+	LastFailures int       `json:"last_failures"`
+	LastError    string    `json:"last_error,omitempty"`
+	NextRun      time.Time `json:"next_run,omitzero"`
+}
+
+// daemon runs trackers on their schedules and alerts after each cycle
+type daemon struct {
+	setups    []*trackerSetup
+	intervals map[string]time.Duration
+	runner    *runner
+	alerter   *alerts.Alerter
+	logger    *slog.Logger
+
+	// Previous snapshot per tracker, compared against the next run for alerts
+	snapshots map[string]alerts.Snapshot
+	report    *tracker.RunReport
+
+	mu           sync.Mutex
+	status       map[string]*trackerStatus
+	shuttingDown bool
+}
+
+// runDaemon runs the enabled trackers until ctx is cancelled. In-flight runs
+// get -shutdown-grace to finish before they are cancelled and their partial
+// results written.
+func runDaemon(ctx context.Context, setups []*trackerSetup, r *runner) error {
+	intervals, err := parseSchedule(*scheduleList, setups)
+	if err != nil {
+		return err
+	}
+
+	d := &daemon{
+		setups:    setups,
+		intervals: intervals,
+		runner:    r,
+		logger:    r.logger,
+		snapshots: make(map[string]alerts.Snapshot),
+		report:    &tracker.RunReport{},
+		status:    make(map[string]*trackerStatus),
+	}
+
+	if *subscriptionsFile != "" {
+		config, err := alerts.LoadConfig(*subscriptionsFile)
+		if err != nil {
+			return fmt.Errorf("failed to load subscriptions config: %w", err)
+		}
+		d.alerter = alerts.NewAlerter(config, *alertDryRun, os.Stdout)
+		d.alerter.Logger = d.logger.With("component", "alerter")
+		if *alertLedgerFile != "" {
+			if d.alerter.Ledger, err = alerts.LoadLedger(*alertLedgerFile); err != nil {
+				return fmt.Errorf("failed to load alert ledger: %w", err)
+			}
+		}
+		// Without a file, held alerts are lost on restart
+		if d.alerter.Outbox, err = alerts.LoadOutbox(*alertOutboxFile); err != nil {
+			return fmt.Errorf("failed to load outbox: %w", err)
+		}
+	}
+
+	// Alert against whatever the last run (of any mode) left on disk
+	for _, setup := range setups {
+		// Keep the envelope's coverage, so the first cycle doesn't alert on
+		// stores or products the last run never scanned
+		existing := loadExistingInventory(d.logger, setup.previousPath())
+		if t, err := setup.def.New(setup.config); err == nil {
+			existing.Items = canonicalize(t, existing.Items)
+		}
+		d.snapshots[setup.def.Name] = alerts.Snapshot{Items: existing.Items, Coverage: existing.Coverage}
+		d.status[setup.def.Name] = &trackerStatus{Interval: intervals[setup.def.Name].String()}
+	}
+	d.updateInventoryMetrics()
+
+	server := &http.Server{Addr: *listenAddr, Handler: d.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			d.logger.Error("Health server failed", logging.KeyError, err)
+		}
+	}()
+	d.logger.Info("Daemon started", "schedule", d.describeSchedule(), "listen", *listenAddr)
+
+	if d.alerter != nil && !d.alerter.DryRun {
+		go d.deliverLoop(ctx)
+	}
+
+	// Runs use their own context so that SIGTERM stops scheduling at once but
+	// cancels in-flight work only after the grace period
+	runCtx, cancelRuns := context.WithCancel(context.Background())
+	defer cancelRuns()
+	go func() {
+		<-ctx.Done()
+		d.mu.Lock()
+		d.shuttingDown = true
+		d.mu.Unlock()
+
+		d.logger.Info("Shutting down; waiting for in-flight trackers", "grace", *shutdownGrace)
+		timer := time.NewTimer(*shutdownGrace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			d.logger.Warn("Grace period expired; checkpointing partial results")
+			cancelRuns()
+		case <-runCtx.Done():
+		}
+	}()
+
+	next := make(map[string]time.Time)
+	for ctx.Err() == nil {
+		now := time.Now()
+		var due []*trackerSetup
+		for _, setup := range setups {
+			if !now.Before(next[setup.def.Name]) {
+				due = append(due, setup)
+			}
+		}
+
+		if len(due) > 0 {
+			d.cycle(ctx, runCtx, due)
+			for _, setup := range due {
+				next[setup.def.Name] = now.Add(intervals[setup.def.Name])
+				d.setStatus(setup.def.Name, func(s *trackerStatus) { s.NextRun = next[setup.def.Name] })
+			}
+			continue
+		}
+
+		wake := time.Time{}
+		for _, at := range next {
+			if wake.IsZero() || at.Before(wake) {
+				wake = at
+			}
+		}
+		tracker.Sleep(ctx, time.Until(wake))
+	}
+
+	cancelRuns()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+
+	d.logger.Info("Daemon stopped")
+	return nil
+}
+
+// cycle runs the due trackers one after another, then sends alerts for what
+// changed. Once shutdown starts no new tracker is started, but those that ran
+// are still written out and alerted on.
+func (d *daemon) cycle(ctx, runCtx context.Context, due []*trackerSetup) {
+	changes := &alerts.ComparisonResult{}
+	compared := false
+
+	for _, setup := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		name := setup.def.Name
+
+		d.setStatus(name, func(s *trackerStatus) {
+			s.Running = true
+			s.LastStarted = time.Now()
+		})
+
+		trackerCtx, cancel := runCtx, context.CancelFunc(func() {})
+		if *timeout > 0 {
+			trackerCtx, cancel = context.WithTimeout(runCtx, *timeout)
+		}
+		output, result, interrupted, err := d.runner.runAndWrite(trackerCtx, setup)
+		cancel()
+		if err != nil {
+			d.logger.Error("Tracker run failed", logging.KeyTracker, name, logging.KeyError, err)
+			d.setStatus(name, func(s *trackerStatus) {
+				s.Running = false
+				s.LastFinished = time.Now()
+				s.LastError = err.Error()
+			})
+			continue
+		}
+
+		d.setStatus(name, func(s *trackerStatus) {
+			s.Running = false
+			s.Ready = true
+			s.LastFinished = result.Finished
+			s.LastItems = len(output.items)
+			s.LastFailures = len(result.Failures)
+			s.LastError = ""
+			switch {
+			case !output.published:
+				s.LastError = "not published: " + strings.Join(output.guard.Violations, "; ")
+			case interrupted:
+				s.LastError = "interrupted; results are partial"
+			}
+		})
+
+		report := tracker.NewReport(name, result, interrupted)
+		report.Guard = output.guard
+		report.Rejected = !output.published
+		d.recordReport(report)
+
+		// An unpublished run leaves the previous snapshot in place
+		if !output.published {
+			continue
+		}
+
+		current := alerts.Snapshot{Items: output.items, Coverage: &result.Coverage}
+		if previous := d.snapshots[name]; len(previous.Items) > 0 {
+			changes.Merge(alerts.DetectSnapshotChanges(previous, current))
+			compared = true
+		}
+		d.snapshots[name] = current
+	}
+
+	d.updateInventoryMetrics()
+
+	if d.alerter == nil {
+		return
+	}
+	if !compared {
+		d.logger.Info("No previous inventory - skipping alerts on first run")
+		return
+	}
+
+	d.logger.Info("Detected changes", "new", len(changes.NewItems),
+		"removed", len(changes.RemovedItems), "quantity_changes", len(changes.QuantityChanges))
+	if err := d.alerter.Run(changes); err != nil {
+		d.logger.Error("Failed to send alerts", logging.KeyError, err)
+	}
+}
+
+// deliverLoop sends due digests and retries failed alerts between cycles
+// until ctx is cancelled
+func (d *daemon) deliverLoop(ctx context.Context) {
+	ticker := time.NewTicker(deliverInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.alerter.Deliver(); err != nil {
+				d.logger.Error("Failed to deliver queued alerts", logging.KeyError, err)
+			}
+		}
+	}
+}
+
+// updateInventoryMetrics rebuilds the inventory gauges from the latest snapshot
+// of every tracker and rewrites -metrics-file if set
+func (d *daemon) updateInventoryMetrics() {
+	var inventories [][]tracker.InventoryItem
+	for _, setup := range d.setups {
+		inventories = append(inventories, d.snapshots[setup.def.Name].Items)
+	}
+	d.runner.metrics.setInventory(inventories...)
+
+	if *metricsFile == "" {
+		return
+	}
+	if err := d.runner.metrics.registry.WriteFile(*metricsFile); err != nil {
+		d.logger.Error("Failed to write metrics", logging.KeyError, err)
+	}
+}
+
+// recordReport replaces the tracker's entry in the run report and rewrites
+// the -report file, so it always describes the latest run of each tracker
+func (d *daemon) recordReport(report tracker.Report) {
+	replaced := false
+	for i := range d.report.Trackers {
+		if d.report.Trackers[i].Name == report.Name {
+			d.report.Trackers[i] = report
+			replaced = true
+		}
+	}
+	if !replaced {
+		d.report.Trackers = append(d.report.Trackers, report)
+	}
+
+	if *reportFile == "" {
+		return
+	}
+	if err := tracker.WriteRunReport(*reportFile, d.report); err != nil {
+		d.logger.Error("Failed to write run report", logging.KeyError, err)
+	}
+}
+
+// setStatus updates a tracker's status under the lock
+func (d *daemon) setStatus(name string, update func(*trackerStatus)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	update(d.status[name])
+}
+
+// handler serves /healthz (the process is up), /readyz (every tracker has
+// completed a run and the daemon is not shutting down) and /metrics
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", d.runner.metrics.registry.Handler())
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		ready := !d.shuttingDown
+		for _, status := range d.status {
+			ready = ready && status.Ready
+		}
+		body, err := json.MarshalIndent(map[string]interface{}{
+			"ready":         ready,
+			"shutting_down": d.shuttingDown,
+			"trackers":      d.status,
+		}, "", "  ")
+		d.mu.Unlock()
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(body)
+	})
+	return mux
+}
+
+// describeSchedule summarises the intervals for the startup log line
+func (d *daemon) describeSchedule() string {
+	var parts []string
+	for _, setup := range d.setups {
+		parts = append(parts, fmt.Sprintf("%s every %v", setup.def.Name, d.intervals[setup.def.Name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseSchedule resolves -schedule overrides on top of each tracker's default interval
+func parseSchedule(list string, setups []*trackerSetup) (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration)
+	for _, setup := range setups {
+		interval := setup.def.Interval
+		if interval <= 0 {
+			interval = time.Hour
+		}
+		intervals[setup.def.Name] = interval
+	}
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid -schedule entry %q (want name=interval)", entry)
+		}
+		if _, enabled := intervals[name]; !enabled {
+			return nil, fmt.Errorf("-schedule entry for tracker %q, which is not enabled", name)
+		}
+
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid -schedule interval for %s: %q", name, value)
+		}
+		intervals[name] = interval
+	}
+
+	return intervals, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+
+	"github.com/jeffspahr/bourbontracker/pkg/elasticsearch"
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+var (
+	esURL        = flag.String("es-url", "", "Elasticsearch URL to index each run into via the _bulk API (optional)")
+	esIndex      = flag.String("es-index", elasticsearch.DefaultIndex, "Elasticsearch index or data stream name")
+	esDataStream = flag.Bool("es-data-stream", false, "Write to a data stream instead of a plain index")
+	esUsername   = flag.String("es-username", os.Getenv("ELASTICSEARCH_USERNAME"), "Elasticsearch username (env ELASTICSEARCH_USERNAME; password from ELASTICSEARCH_PASSWORD)")
+	esCACert     = flag.String("es-ca-cert", "", "PEM CA certificate to verify Elasticsearch with, e.g. ECK's ca.crt")
+)
+
+// newElasticsearchClient returns the client for -es-url, or nil if unset.
+// Secrets come from the environment so they never appear in args.
+func newElasticsearchClient(logger *slog.Logger) (*elasticsearch.Client, error) {
+	if *esURL == "" {
+		return nil, nil
+	}
+
+	config := elasticsearch.DefaultConfig()
+	config.URL = *esURL
+	config.Index = *esIndex
+	config.DataStream = *esDataStream
+	config.Username = *esUsername
+	config.Password = os.Getenv("ELASTICSEARCH_PASSWORD")
+	config.APIKey = os.Getenv("ELASTICSEARCH_API_KEY")
+	config.CACert = *esCACert
+
+	client, err := elasticsearch.New(config)
+	if err != nil {
+		return nil, err
+	}
+	client.SetLogger(logger.With("component", "elasticsearch"))
+	return client, nil
+}
+
+// indexInventory writes a tracker's inventory to Elasticsearch. Failures are
+// logged rather than fatal since the inventory file has already been written.
+func (r *runner) indexInventory(ctx context.Context, logger *slog.Logger, name string, items []tracker.InventoryItem, result *tracker.Result) {
+	// Index partial results too, even though the run's context is cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	bulk, err := r.elastic.Index(ctx, name, result.Finished, items)
+	if err != nil {
+		indexed := 0
+		if bulk != nil {
+			indexed = bulk.Indexed
+		}
+		logger.Error("Failed to index inventory in Elasticsearch", "index", *esIndex, "indexed", indexed, logging.KeyError, err)
+		return
+	}
+	logger.Info("Inventory indexed in Elasticsearch", "index", *esIndex, logging.KeyItems, bulk.Indexed)
+}
@@ -1,241 +1,487 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/jeffspahr/bourbontracker/pkg/nc/wake"
+	"github.com/jeffspahr/bourbontracker/pkg/elasticsearch"
+	"github.com/jeffspahr/bourbontracker/pkg/history"
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
+	"github.com/jeffspahr/bourbontracker/pkg/output"
 	"github.com/jeffspahr/bourbontracker/pkg/tracker"
-	vaabc "github.com/jeffspahr/bourbontracker/pkg/va/abc"
 )
 
 var (
-	storesFile     = flag.String("stores", "stores", "Path to stores file (VA ABC)")
-	productsFile   = flag.String("products", "products.json", "Path to products file (VA ABC)")
-	ncProductsFile = flag.String("nc-products", "nc-products.json", "Path to NC products file (Wake County)")
-	outputVAFile   = flag.String("output-va", "inventory-va.json", "Path to VA output JSON file")
-	outputNCFile   = flag.String("output-nc", "inventory-nc.json", "Path to NC output JSON file")
-	enableVA       = flag.Bool("va", true, "Enable Virginia ABC tracker")
-	enableWake     = flag.Bool("wake", false, "Enable Wake County NC tracker")
+	trackerList = flag.String("trackers", "va", "Comma-separated list of trackers to run ("+strings.Join(tracker.Names(), ", ")+")")
+	configFile  = flag.String("config", "", "Path to JSON file with per-tracker config blocks, keyed by tracker name")
+	timeout     = flag.Duration("timeout", 0, "Stop all trackers after this long and write partial results (0 = no limit)")
+	reportFile  = flag.String("report", "", "Path to write a JSON run report with per-tracker failures (optional)")
+	historyFile = flag.String("history", "", "Path to an inventory history log to append each run to (optional)")
+	envelope    = flag.Bool("envelope", false, "Write -output-<name> files as a versioned envelope with run metadata instead of a bare JSON array")
+	metricsFile = flag.String("metrics-file", "", "Path to write Prometheus metrics in text format, e.g. for node_exporter's textfile collector (optional)")
+
+	maxDrop      = flag.Float64("max-drop", 0.5, "Refuse to publish a run whose item count, store coverage or product coverage drops by more than this fraction versus the previous snapshot (0 disables)")
+	forcePublish = flag.Bool("force-publish", false, "Publish even if a run fails the -max-drop guard")
 )
 
+// progressInterval controls how often store/product progress is logged
+const progressInterval = 25
+
+// exitRejected is the exit status of a one-shot run in which the -max-drop
+// guard refused to publish at least one tracker's inventory, so scripts can
+// tell it apart from a failed run (1) or a usage error (2)
+const exitRejected = 3
+
+// trackerSetup holds a registered tracker's config block, primary JSON
+// output path, previous snapshot path and any extra -output sinks
+type trackerSetup struct {
+	def      tracker.Definition
+	config   interface{}
+	output   *string
+	previous *string
+	sinks    []output.Sink
+
+	published bool // The tracker has written its output in this process
+}
+
+// previousPath returns the snapshot a run is checked against and carries
+// forward from: -previous-<name> if set, until this process has published
+// the tracker's own output
+func (s *trackerSetup) previousPath() string {
+	if *s.previous != "" && !s.published {
+		return *s.previous
+	}
+	return *s.output
+}
+
+// runner holds what every tracker run shares
+type runner struct {
+	historyLog *history.Log
+	elastic    *elasticsearch.Client
+	metrics    *trackerMetrics
+	logger     *slog.Logger
+}
+
 type inventoryOutput struct {
 	label string
 	path  string
 	items []tracker.InventoryItem
+	run   *tracker.Envelope // items with the run's metadata
+
+	guard     *tracker.GuardCheck
+	published bool // False if the guard refused the run
 }
 
 func main() {
-	flag.Parse()
-
-	var vaInventory []tracker.InventoryItem
-	var ncInventory []tracker.InventoryItem
-
-	// Run VA tracker
-	if *enableVA {
-		va, err := vaabc.New(*storesFile, *productsFile)
-		if err != nil {
-			log.Fatalf("Failed to initialize VA ABC tracker: %v", err)
+	// Every registered tracker gets its config block flags and an -output-<name> flag
+	setups := make(map[string]*trackerSetup)
+	for _, def := range tracker.Definitions() {
+		setup := &trackerSetup{def: def, config: def.NewConfig()}
+		if binder, ok := setup.config.(tracker.FlagBinder); ok {
+			binder.BindFlags(flag.CommandLine)
 		}
+		setup.output = flag.String("output-"+def.Name, def.Output,
+			fmt.Sprintf("Path to %s output JSON file", def.Description))
+		setup.previous = flag.String("previous-"+def.Name, "",
+			fmt.Sprintf("Path to the previous %s snapshot to guard against and carry forward (default: -output-%s)", def.Description, def.Name))
+		setups[def.Name] = setup
+	}
 
-		fmt.Fprintf(os.Stderr, "Running %s tracker...\n", va.Name())
-		fmt.Fprintf(os.Stderr, "  Stores: %d\n", va.StoreCount())
-		fmt.Fprintf(os.Stderr, "  Products: %d\n", len(va.ProductCodes()))
+	var outputs outputList
+	flag.Var(&outputs, "output", "Extra output as [tracker=]format:path, repeatable ("+strings.Join(output.Names(), ", ")+"); {tracker} in the path is replaced by the tracker name")
 
-		startTime := time.Now()
-		items, err := va.Track()
-		duration := time.Since(startTime)
+	logOptions := logging.BindFlags(flag.CommandLine)
+	flag.Parse()
+	logger := logging.Setup(logOptions)
 
-		if err != nil {
-			log.Fatalf("ERROR: %s tracker failed: %v\n", va.Name(), err)
+	if *configFile != "" {
+		if err := loadConfigFile(*configFile, setups); err != nil {
+			logging.Fatal(logger, "Failed to load config file", logging.KeyError, err)
 		}
+	}
+
+	enabled, err := enabledTrackers(*trackerList, setups)
+	if err != nil {
+		logging.Fatal(logger, err.Error())
+	}
+	if err := resolveOutputs(outputs, enabled); err != nil {
+		logging.Fatal(logger, err.Error())
+	}
 
-		fmt.Fprintf(os.Stderr, "  Completed in %v\n", duration)
-		fmt.Fprintf(os.Stderr, "  Found %d items\n", len(items))
+	// Cancel in-flight trackers on SIGINT/SIGTERM so partial results get written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		vaInventory = items
+	r := &runner{metrics: newTrackerMetrics(), logger: logger}
+	if *historyFile != "" {
+		r.historyLog = history.Open(*historyFile)
+	}
+	if r.elastic, err = newElasticsearchClient(logger); err != nil {
+		logging.Fatal(logger, "Invalid Elasticsearch settings", logging.KeyError, err)
+	}
 
-		if err := writeInventory(inventoryOutput{
-			label: "VA",
-			path:  *outputVAFile,
-			items: vaInventory,
-		}); err != nil {
-			log.Fatalf("Failed to write VA inventory file: %v", err)
+	if *daemonMode {
+		if err := runDaemon(ctx, enabled, r); err != nil {
+			logging.Fatal(logger, "Daemon failed", logging.KeyError, err)
 		}
+		return
 	}
 
-	// Run Wake County tracker
-	if *enableWake {
-		// Load existing NC inventory for caching
-		existingNCInventory := loadExistingInventory(*outputNCFile)
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
 
-		wakeTracker, err := wake.New(*ncProductsFile)
-		if err != nil {
-			log.Fatalf("Failed to initialize Wake County tracker: %v", err)
+	interrupted := false
+	var written []inventoryOutput
+	var rejected []string
+	report := &tracker.RunReport{}
+
+	for _, setup := range enabled {
+		if interrupted {
+			break
 		}
 
-		// Determine which products need updating based on age and listing type
-		productsToUpdate := getProductsNeedingUpdate(wakeTracker, existingNCInventory)
-		wakeTracker.SetProductsToTrack(productsToUpdate)
+		output, result, wasInterrupted, err := r.runAndWrite(ctx, setup)
+		if err != nil {
+			logging.Fatal(logger, "Tracker run failed", logging.KeyTracker, setup.def.Name, logging.KeyError, err)
+		}
+		interrupted = wasInterrupted
 
-		fmt.Fprintf(os.Stderr, "Running %s tracker...\n", wakeTracker.Name())
-		fmt.Fprintf(os.Stderr, "  Stores: %d\n", wakeTracker.StoreCount())
-		fmt.Fprintf(os.Stderr, "  Products: %d (updating %d)\n", len(wakeTracker.ProductCodes()), len(productsToUpdate))
+		trackerReport := tracker.NewReport(setup.def.Name, result, interrupted)
+		trackerReport.Guard = output.guard
+		trackerReport.Rejected = !output.published
+		report.Trackers = append(report.Trackers, trackerReport)
 
-		startTime := time.Now()
-		items, err := wakeTracker.Track()
-		duration := time.Since(startTime)
+		if !output.published {
+			rejected = append(rejected, setup.def.Name)
+			continue
+		}
+		written = append(written, output)
+	}
 
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "ERROR: %s tracker failed: %v\n", wakeTracker.Name(), err)
-			// Use existing inventory if tracking fails
-			ncInventory = existingNCInventory
-		} else {
-			fmt.Fprintf(os.Stderr, "  Completed in %v\n", duration)
-			fmt.Fprintf(os.Stderr, "  Found %d items\n", len(items))
+	if *reportFile != "" {
+		if err := tracker.WriteRunReport(*reportFile, report); err != nil {
+			logging.Fatal(logger, "Failed to write run report", logging.KeyError, err)
+		}
+		logger.Info("Run report written", "path", *reportFile)
+	}
 
-			// Merge new NC data with existing NC data
-			ncInventory = mergeInventory(existingNCInventory, items)
+	if *metricsFile != "" {
+		var inventories [][]tracker.InventoryItem
+		for _, output := range written {
+			inventories = append(inventories, output.items)
 		}
+		r.metrics.setInventory(inventories...)
 
-		if err := writeInventory(inventoryOutput{
-			label: "NC",
-			path:  *outputNCFile,
-			items: ncInventory,
-		}); err != nil {
-			log.Fatalf("Failed to write NC inventory file: %v", err)
+		if err := r.metrics.registry.WriteFile(*metricsFile); err != nil {
+			logging.Fatal(logger, "Failed to write metrics", logging.KeyError, err)
 		}
+		logger.Info("Metrics written", "path", *metricsFile)
 	}
 
-	if !*enableVA && !*enableWake {
-		log.Fatal("No trackers enabled. Use -va or -wake flags.")
+	totalItems := 0
+	for _, output := range written {
+		totalItems += len(output.items)
+		logger.Info("Inventory summary", logging.KeyTracker, output.label, logging.KeyItems, len(output.items))
 	}
+	logger.Info("Found items in stock across all trackers", logging.KeyItems, totalItems)
 
-	fmt.Fprintf(os.Stderr, "\n")
-	totalItems := len(vaInventory) + len(ncInventory)
-	fmt.Printf("Found %d items in stock across all trackers\n", totalItems)
-	if *enableVA {
-		fmt.Fprintf(os.Stderr, "  VA: %d items\n", len(vaInventory))
+	if interrupted {
+		logging.Fatal(logger, "Run was interrupted; results are partial")
+	}
+	if status := exitStatus(report); status != 0 {
+		// Not a crash: everything else was published and the report says why
+		logger.Error("Refused to publish inventory that failed the -max-drop guard; the previous snapshot is still current. Rerun with -force-publish if the drop is real",
+			"trackers", strings.Join(rejected, ","), "exit_status", status)
+		os.Exit(status)
 	}
-	if *enableWake {
-		fmt.Fprintf(os.Stderr, "  NC: %d items\n", len(ncInventory))
+}
+
+// exitStatus returns the exit status of a one-shot run that finished:
+// exitRejected if any tracker's inventory was not published, otherwise 0
+func exitStatus(report *tracker.RunReport) int {
+	for _, r := range report.Trackers {
+		if r.Rejected {
+			return exitRejected
+		}
 	}
+	return 0
 }
 
-func writeInventory(output inventoryOutput) error {
-	inventoryJSON, err := json.MarshalIndent(output.items, "", "  ")
+// runAndWrite runs a tracker and checks its inventory against the previous
+// snapshot. If the check passes it writes the inventory, appends it to the
+// history log (if any) and indexes it in Elasticsearch (if configured);
+// otherwise nothing is published and the output is marked unpublished.
+func (r *runner) runAndWrite(ctx context.Context, setup *trackerSetup) (inventoryOutput, *tracker.Result, bool, error) {
+	runID := tracker.NewRunID(time.Now())
+	logger := r.logger.With(logging.KeyTracker, setup.def.Name, logging.KeyRunID, runID)
+
+	t, err := setup.def.New(setup.config)
 	if err != nil {
-		return err
+		r.metrics.recordRun(setup.def.Name, nil, "error", 0)
+		return inventoryOutput{}, nil, false, fmt.Errorf("failed to initialize %s tracker: %w", setup.def.Name, err)
+	}
+	if setter, ok := t.(tracker.LoggerSetter); ok {
+		setter.SetLogger(logger)
 	}
+	previous := loadExistingInventory(logger, setup.previousPath())
+	previous.Items = canonicalize(t, previous.Items)
 
-	if err := ioutil.WriteFile(output.path, inventoryJSON, 0644); err != nil {
-		return err
+	items, result, interrupted, err := r.runTracker(ctx, setup, t, logger, previous)
+	if err != nil {
+		r.metrics.recordRun(setup.def.Name, nil, "error", 0)
+		return inventoryOutput{}, nil, false, err
 	}
 
-	fmt.Fprintf(os.Stderr, "  Written to %s\n", output.path)
-	return nil
-}
+	output := inventoryOutput{
+		label: setup.def.Name,
+		path:  *setup.output,
+		items: items,
+		run:   tracker.NewEnvelope(setup.def.Name, runID, result, items),
+		guard: tracker.CheckDrop(previous.Items, items, *maxDrop),
+	}
+	if len(output.guard.Violations) > 0 {
+		violations := strings.Join(output.guard.Violations, "; ")
+		if !*forcePublish {
+			logger.Error("Refusing to publish: inventory dropped too far from the previous snapshot",
+				"violations", violations, "max_drop", *maxDrop)
+			r.metrics.recordRun(setup.def.Name, result, "rejected", len(items))
+			return output, result, interrupted, nil
+		}
+		output.guard.Overridden = true
+		logger.Warn("Publishing despite guard violations (-force-publish)", "violations", violations)
+	}
 
-// loadExistingInventory loads the existing inventory file
-func loadExistingInventory(filename string) []tracker.InventoryItem {
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		// File doesn't exist or can't be read, return empty inventory
-		fmt.Fprintf(os.Stderr, "No existing inventory found, will create fresh data\n")
-		return []tracker.InventoryItem{}
+	outcome := "success"
+	if interrupted {
+		outcome = "interrupted"
 	}
+	r.metrics.recordRun(setup.def.Name, result, outcome, len(items))
 
-	var inventory []tracker.InventoryItem
-	if err := json.Unmarshal(data, &inventory); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to parse existing inventory: %v\n", err)
-		return []tracker.InventoryItem{}
+	if err := writeInventory(output); err != nil {
+		return inventoryOutput{}, nil, false, fmt.Errorf("failed to write %s inventory file: %w", setup.def.Name, err)
 	}
+	logger.Info("Inventory written", "path", output.path, logging.KeyItems, len(items))
+	writeSinks(logger, setup, output.run)
 
-	return inventory
+	if r.historyLog != nil {
+		canonicalizer, _ := t.(tracker.Canonicalizer)
+		r.recordHistory(logger, output.run, canonicalizer)
+	}
+	if r.elastic != nil {
+		r.indexInventory(ctx, logger, setup.def.Name, items, result)
+	}
+	output.published = true
+	setup.published = true
+	return output, result, interrupted, nil
 }
 
-// getProductsNeedingUpdate determines which NC products need updating
-func getProductsNeedingUpdate(wakeTracker *wake.Tracker, existingInventory []tracker.InventoryItem) []string {
-	// Build map of product ID -> latest timestamp
-	productTimestamps := make(map[string]time.Time)
-	productListingTypes := make(map[string]string)
+// runTracker runs a single tracker, returning the inventory to write, the
+// raw run result and whether the run was interrupted. Incremental trackers
+// carry forward what they don't refresh from existing.
+func (r *runner) runTracker(ctx context.Context, setup *trackerSetup, t tracker.StreamTracker, logger *slog.Logger, existing *tracker.Envelope) ([]tracker.InventoryItem, *tracker.Result, bool, error) {
+	// Incremental trackers refresh part of their data and carry the rest forward
+	incremental, isIncremental := t.(tracker.Incremental)
+	if isIncremental {
+		incremental.Prepare(existing)
+	}
 
-	for _, item := range existingInventory {
-		// Only consider NC Wake County items
-		if item.State != "NC" || item.County != "Wake" {
-			continue
+	logger.Info("Running tracker", "name", t.Name(), "stores", t.StoreCount(), "products", len(t.ProductCodes()))
+
+	result, err := tracker.Collect(ctx, t, func(ev tracker.Event) {
+		r.metrics.observe(setup.def.Name, ev)
+		logProgress(logger, ev)
+	})
+
+	interrupted := false
+	switch {
+	case isCancellation(err):
+		interrupted = true
+		logger.Warn("Interrupted; writing partial results", logging.KeyDuration, result.Duration(), logging.KeyError, err)
+	case err != nil && isIncremental:
+		// Use existing inventory (and what it covered) if tracking fails
+		logger.Error("Tracker failed; keeping existing inventory", logging.KeyError, err)
+		if existing.Coverage != nil {
+			result.Coverage = *existing.Coverage
 		}
+		return existing.Items, result, false, nil
+	case err != nil:
+		return nil, nil, false, fmt.Errorf("%s tracker failed: %w", t.Name(), err)
+	default:
+		logger.Info("Completed", logging.KeyDuration, result.Duration())
+	}
+	logger.Info("Found items", logging.KeyItems, len(result.Items), "failures", len(result.Failures))
 
-		productID := item.ProductID
-		if ts, exists := productTimestamps[productID]; !exists || item.Timestamp.After(ts) {
-			productTimestamps[productID] = item.Timestamp
-			productListingTypes[productID] = item.ListingType
-		}
+	if len(result.Failures) > 0 {
+		logger.Warn("Some stores/products failed; results are missing for these", "failures", len(result.Failures))
+	}
+
+	if isIncremental {
+		return incremental.Merge(existing, result), result, interrupted, nil
 	}
+	return result.Items, result, interrupted, nil
+}
 
-	// Determine which products need updating
-	var productsToUpdate []string
-	now := time.Now()
+// recordHistory appends a tracker's inventory to the history log. Only pairs
+// the run covered can be recorded as removed, so partial runs are safe to log.
+// canonicalizer (if non-nil) moves history recorded under older item
+// identities to the current ones.
+func (r *runner) recordHistory(logger *slog.Logger, run *tracker.Envelope, canonicalizer tracker.Canonicalizer) {
+	record, err := r.historyLog.AppendEnvelope(run, canonicalizer)
+	switch {
+	case err != nil:
+		logger.Error("Failed to update history", "path", r.historyLog.Path(), logging.KeyError, err)
+	case record == nil:
+		logger.Info("History unchanged")
+	default:
+		logger.Info("History updated", "upserts", len(record.Upserts), "removed", len(record.Removed), "moved", len(record.Moved))
+	}
+}
 
-	// Load NC products to get all product codes
-	allProducts := wakeTracker.ProductCodes()
+// enabledTrackers resolves the -trackers list against the registry
+func enabledTrackers(list string, setups map[string]*trackerSetup) ([]*trackerSetup, error) {
+	var enabled []*trackerSetup
+	seen := make(map[string]bool)
 
-	for _, ncCode := range allProducts {
-		timestamp, exists := productTimestamps[ncCode]
-		if !exists {
-			// Never tracked before, needs update
-			productsToUpdate = append(productsToUpdate, ncCode)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
 			continue
 		}
+		setup, ok := setups[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tracker %q (available: %s)", name, strings.Join(tracker.Names(), ", "))
+		}
+		seen[name] = true
+		enabled = append(enabled, setup)
+	}
 
-		listingType := productListingTypes[ncCode]
-		age := now.Sub(timestamp)
+	if len(enabled) == 0 {
+		return nil, fmt.Errorf("no trackers enabled. Use -trackers (available: %s)", strings.Join(tracker.Names(), ", "))
+	}
+	return enabled, nil
+}
 
-		// "Listed" products: update every 24 hours
-		// Other types (Limited, Allocation, Barrel, Christmas): update every hour
-		needsUpdate := false
-		if listingType == "Listed" {
-			needsUpdate = age > 24*time.Hour
-		} else {
-			needsUpdate = age > 1*time.Hour
+// loadConfigFile decodes per-tracker config blocks from a JSON file. Flags set
+// explicitly on the command line take precedence over the file.
+func loadConfigFile(filename string, setups map[string]*trackerSetup) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	// Remember explicit flags before the file overwrites the values they point to
+	explicit := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if _, repeatable := f.Value.(*outputList); repeatable {
+			return // Not settable from the file, and Set would append a duplicate
 		}
+		explicit[f.Name] = f.Value.String()
+	})
+
+	var blocks map[string]json.RawMessage
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
 
-		if needsUpdate {
-			productsToUpdate = append(productsToUpdate, ncCode)
+	for name, block := range blocks {
+		setup, ok := setups[name]
+		if !ok {
+			return fmt.Errorf("config block for unknown tracker %q", name)
+		}
+		if err := json.Unmarshal(block, setup.config); err != nil {
+			return fmt.Errorf("invalid config block for %s: %w", name, err)
 		}
 	}
 
-	return productsToUpdate
+	// Re-apply explicit flags so they override the file
+	for name, value := range explicit {
+		if err := flag.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// mergeInventory merges new inventory with existing, replacing old NC data with new
-func mergeInventory(existing, new []tracker.InventoryItem) []tracker.InventoryItem {
-	// Create set of product IDs that were updated
-	updatedProducts := make(map[string]bool)
-	for _, item := range new {
-		if item.State == "NC" && item.County == "Wake" {
-			updatedProducts[item.ProductID] = true
-		}
+// logProgress logs periodic progress and any per-store/product failures
+func logProgress(logger *slog.Logger, ev tracker.Event) {
+	var unit string
+	switch ev.Kind {
+	case tracker.EventStore:
+		unit = "stores"
+	case tracker.EventProduct:
+		unit = "products"
+	default:
+		return
 	}
 
-	// Keep existing items that weren't updated
-	var merged []tracker.InventoryItem
-	for _, item := range existing {
-		// Skip NC items that were updated
-		if item.State == "NC" && item.County == "Wake" && updatedProducts[item.ProductID] {
-			continue
+	if ev.Err != nil {
+		if ev.Kind == tracker.EventStore {
+			logger.Warn("Failed store", logging.KeyStoreID, ev.StoreID, logging.KeyError, ev.Err)
+		} else {
+			logger.Warn("Failed product", logging.KeyProductID, ev.ProductID, logging.KeyError, ev.Err)
 		}
-		// Keep VA items and NC items that weren't updated
-		merged = append(merged, item)
 	}
 
-	// Add all new items
-	merged = append(merged, new...)
+	if ev.Done%progressInterval == 0 || ev.Done == ev.Total {
+		logger.Info("Progress", "done", ev.Done, "total", ev.Total, "unit", unit)
+	}
+}
+
+// isCancellation reports whether err came from the run being cancelled or timing out
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// writeInventory writes the primary file that the alerter, API server, map
+// and incremental trackers read: a bare JSON array, or an envelope with
+// -envelope
+func writeInventory(inventory inventoryOutput) error {
+	name := "json"
+	if *envelope {
+		name = "envelope"
+	}
+	format, _ := output.Lookup(name)
+	return output.Sink{Format: format, Path: inventory.path}.Write(inventory.run)
+}
+
+// canonicalize rewrites a previous snapshot to the tracker's current item
+// identities, for trackers that implement tracker.Canonicalizer
+func canonicalize(t tracker.StreamTracker, items []tracker.InventoryItem) []tracker.InventoryItem {
+	if canonicalizer, ok := t.(tracker.Canonicalizer); ok {
+		return canonicalizer.Canonicalize(items)
+	}
+	return items
+}
+
+// loadExistingInventory loads the existing inventory file, in either the
+// envelope or the legacy array format. A missing or unreadable file is
+// returned as an empty legacy snapshot.
+func loadExistingInventory(logger *slog.Logger, filename string) *tracker.Envelope {
+	existing, err := tracker.LoadInventory(filename)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		logger.Info("No existing inventory found, will create fresh data", "path", filename)
+		existing = &tracker.Envelope{}
+	case err != nil:
+		logger.Warn("Failed to read existing inventory", "path", filename, logging.KeyError, err)
+		existing = &tracker.Envelope{}
+	}
 
-	return merged
+	if existing.Items == nil {
+		existing.Items = []tracker.InventoryItem{}
+	}
+	return existing
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+func TestExitStatus(t *testing.T) {
+	full := make([]tracker.InventoryItem, 10)
+	for i := range full {
+		full[i] = tracker.InventoryItem{StoreID: strconv.Itoa(i), ProductID: "018006"}
+	}
+
+	// run reports a tracker the way the one-shot run does
+	run := func(name string, previous, current []tracker.InventoryItem, force bool) tracker.Report {
+		check := tracker.CheckDrop(previous, current, 0.5)
+		if len(check.Violations) > 0 && force {
+			check.Overridden = true
+		}
+		report := tracker.NewReport(name, &tracker.Result{Items: current}, false)
+		report.Guard = check
+		report.Rejected = !check.Passed()
+		return report
+	}
+
+	tests := []struct {
+		name     string
+		trackers []tracker.Report
+		want     int
+	}{
+		{"published", []tracker.Report{run("va", full, full, false)}, 0},
+		{"first run", []tracker.Report{run("va", nil, full[:1], false)}, 0},
+		{"rejected", []tracker.Report{run("va", full, full[:2], false)}, exitRejected},
+		{"forced", []tracker.Report{run("va", full, full[:2], true)}, 0},
+		{"one of two rejected", []tracker.Report{run("va", full, full, false), run("wake", full, nil, false)}, exitRejected},
+		{"no trackers", nil, 0},
+	}
+
+	for _, tt := range tests {
+		if got := exitStatus(&tracker.RunReport{Trackers: tt.trackers}); got != tt.want {
+			t.Errorf("%s: exitStatus = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/jeffspahr/bourbontracker/pkg/metrics"
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// trackerMetrics holds the metrics exported by -metrics-file and /metrics
+type trackerMetrics struct {
+	registry *metrics.Registry
+
+	requests  *metrics.Family
+	retries   *metrics.Family
+	skipped   *metrics.Family
+	runs      *metrics.Family
+	duration  *metrics.Family
+	lastRun   *metrics.Family
+	itemsSeen *metrics.Family
+
+	inventoryItems   *metrics.Family
+	inventoryBottles *metrics.Family
+	productBottles   *metrics.Family
+}
+
+func newTrackerMetrics() *trackerMetrics {
+	r := metrics.NewRegistry()
+	return &trackerMetrics{
+		registry: r,
+
+		requests: r.NewCounter("bourbontracker_requests_total",
+			"HTTP requests made by trackers, by status code (\"error\" when there was no response).", "tracker", "code"),
+		retries: r.NewCounter("bourbontracker_request_retries_total",
+			"HTTP requests that were retries of an earlier failed attempt.", "tracker"),
+		skipped: r.NewCounter("bourbontracker_skipped_total",
+			"Stores or products given up on after repeated failures.", "tracker", "kind"),
+		runs: r.NewCounter("bourbontracker_runs_total",
+			"Tracker runs by outcome (success, interrupted, rejected, error).", "tracker", "outcome"),
+		duration: r.NewGauge("bourbontracker_run_duration_seconds",
+			"Duration of the last tracker run.", "tracker"),
+		lastRun: r.NewGauge("bourbontracker_last_run_timestamp_seconds",
+			"Unix time the last tracker run finished.", "tracker"),
+		itemsSeen: r.NewGauge("bourbontracker_items_found",
+			"In-stock items found by the last tracker run.", "tracker"),
+
+		inventoryItems: r.NewGauge("bourbontracker_inventory_items",
+			"Product/store pairs currently in stock.", "state", "listing_type"),
+		inventoryBottles: r.NewGauge("bourbontracker_inventory_bottles",
+			"Bottles currently in stock.", "state", "listing_type"),
+		productBottles: r.NewGauge("bourbontracker_inventory_product_bottles",
+			"Bottles of each product currently in stock across all stores.", "state", "product_id", "product"),
+	}
+}
+
+// observe records request and failure events from a tracker run
+func (m *trackerMetrics) observe(name string, ev tracker.Event) {
+	switch {
+	case ev.Kind == tracker.EventRequest:
+		code := "error"
+		if ev.Status != 0 {
+			code = strconv.Itoa(ev.Status)
+		}
+		m.requests.Inc(name, code)
+		if ev.Attempt > 1 {
+			m.retries.Inc(name)
+		}
+	case ev.Err != nil:
+		m.skipped.Inc(name, ev.Kind.String())
+	}
+}
+
+// recordRun records the outcome of a tracker run: success, interrupted,
+// rejected (by the -max-drop guard) or error. result is nil when the tracker
+// failed before producing one.
+func (m *trackerMetrics) recordRun(name string, result *tracker.Result, outcome string, items int) {
+	m.runs.Inc(name, outcome)
+	if result == nil {
+		return
+	}
+
+	m.duration.Set(result.Duration().Seconds(), name)
+	m.lastRun.Set(float64(result.Finished.Unix()), name)
+	m.itemsSeen.Set(float64(items), name)
+}
+
+// setInventory rebuilds the inventory gauges from the current inventory of
+// every tracker
+func (m *trackerMetrics) setInventory(inventories ...[]tracker.InventoryItem) {
+	m.inventoryItems.Reset()
+	m.inventoryBottles.Reset()
+	m.productBottles.Reset()
+
+	for _, items := range inventories {
+		for _, item := range items {
+			m.inventoryItems.Inc(item.State, item.ListingType)
+			m.inventoryBottles.Add(float64(item.Quantity), item.State, item.ListingType)
+			m.productBottles.Add(float64(item.Quantity), item.State, item.ProductID, item.ProductName)
+		}
+	}
+}
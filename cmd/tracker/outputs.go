@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
+	"github.com/jeffspahr/bourbontracker/pkg/output"
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// outputList collects repeated -output flags
+type outputList []string
+
+func (l *outputList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *outputList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// trackerPlaceholder in an -output path is replaced by the tracker name
+const trackerPlaceholder = "{tracker}"
+
+// resolveOutputs attaches each -output spec to the trackers it applies to.
+// A spec is [tracker=]format:path; without a tracker prefix it applies to
+// every enabled tracker, in which case the path must contain {tracker} unless
+// only one tracker is enabled.
+func resolveOutputs(specs []string, enabled []*trackerSetup) error {
+	byName := make(map[string]*trackerSetup)
+	for _, setup := range enabled {
+		byName[setup.def.Name] = setup
+	}
+
+	for _, spec := range specs {
+		targets := enabled
+		sinkSpec := spec
+		if name, rest, ok := strings.Cut(spec, "="); ok && !strings.Contains(name, ":") {
+			setup, enabled := byName[name]
+			if !enabled {
+				return fmt.Errorf("-output %q is for tracker %q, which is not enabled", spec, name)
+			}
+			targets = []*trackerSetup{setup}
+			sinkSpec = rest
+		}
+
+		sink, err := output.ParseSink(sinkSpec)
+		if err != nil {
+			return err
+		}
+		if len(targets) > 1 && !strings.Contains(sink.Path, trackerPlaceholder) {
+			return fmt.Errorf("-output %q applies to every tracker; prefix it with a tracker name (va=%s) or put %s in the path",
+				spec, sinkSpec, trackerPlaceholder)
+		}
+
+		for _, setup := range targets {
+			setup.sinks = append(setup.sinks, output.Sink{
+				Format: sink.Format,
+				Path:   strings.ReplaceAll(sink.Path, trackerPlaceholder, setup.def.Name),
+			})
+		}
+	}
+	return nil
+}
+
+// writeSinks writes a tracker's inventory to its extra -output sinks. The
+// primary JSON file has already been written, so failures here are logged
+// rather than failing the run.
+func writeSinks(logger *slog.Logger, setup *trackerSetup, run *tracker.Envelope) {
+	for _, sink := range setup.sinks {
+		if err := sink.Write(run); err != nil {
+			logger.Error("Failed to write output", "output", sink.String(), logging.KeyError, err)
+			continue
+		}
+		logger.Info("Output written", "output", sink.String(), logging.KeyItems, len(run.Items))
+	}
+}
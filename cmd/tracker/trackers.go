@@ -0,0 +1,9 @@
+package main
+
+// Tracker implementations register themselves with the tracker registry when
+// imported. Add a blank import here to make a new state or county available
+// through -trackers.
+import (
+	_ "github.com/jeffspahr/bourbontracker/pkg/nc/wake"
+	_ "github.com/jeffspahr/bourbontracker/pkg/va/abc"
+)
@@ -0,0 +1,373 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
+)
+
+// Alerter turns detected changes into per-subscriber alerts and sends them.
+// It is shared by cmd/alerter and the tracker daemon.
+type Alerter struct {
+	Config  *Config
+	DryRun  bool      // Print previews to Preview instead of sending
+	Preview io.Writer // Destination for dry-run previews
+	Logger  *slog.Logger
+	Client  *http.Client // Shared by webhook and chat notifiers
+	Ledger  *Ledger      // Suppresses alerts already sent; nil to send everything
+	Outbox  *Outbox      // Holds alerts until due and retries failures; nil to send at once
+
+	mu sync.Mutex // Serializes Run and Deliver
+}
+
+// NewAlerter returns an alerter for a subscriptions config
+func NewAlerter(config *Config, dryRun bool, preview io.Writer) *Alerter {
+	return &Alerter{
+		Config:  config,
+		DryRun:  dryRun,
+		Preview: preview,
+		Logger:  slog.Default(),
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// BuildAlerts returns the alert set for every subscriber with something to
+// hear about, keyed by subscriber ID
+func BuildAlerts(changes *ComparisonResult, subscribers []Subscriber) map[string]AlertSet {
+	alertsPerSubscriber := make(map[string]AlertSet)
+
+	for _, sub := range subscribers {
+		if set := BuildAlertSet(changes, sub.Preferences); !set.IsEmpty() {
+			alertsPerSubscriber[sub.ID] = set
+		}
+	}
+
+	return alertsPerSubscriber
+}
+
+// Run builds alerts for a set of changes and sends each subscriber's to all
+// of their channels. Notifiers are created per send, so dry runs and quiet
+// cycles need no credentials. With a Ledger, changes sent within their
+// cooldown are left out, and what is sent is recorded and saved. With an
+// Outbox, alerts are saved to it before anything is sent, wait there until
+// the subscriber's delivery schedule is due, and failed sends are retried
+// with backoff.
+func (a *Alerter) Run(changes *ComparisonResult) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	hasChanges := len(changes.NewItems) > 0 || len(changes.QuantityChanges) > 0 || len(changes.RemovedItems) > 0
+	if !hasChanges && (a.Outbox == nil || a.Outbox.Len() == 0) {
+		a.Logger.Info("No changes detected - no alerts to send")
+		return nil
+	}
+
+	subscribers := GetEnabledSubscribers(a.Config)
+	a.Logger.Info("Loaded subscribers", "enabled", len(subscribers))
+
+	if len(subscribers) == 0 {
+		a.Logger.Info("No enabled subscribers - no alerts to send")
+		return nil
+	}
+
+	now := time.Now()
+	alertsPerSubscriber := a.buildAlerts(changes, subscribers, now)
+
+	if a.DryRun {
+		if len(alertsPerSubscriber) > 0 {
+			a.Logger.Info("Dry run - printing alert previews instead of sending")
+			WritePreviews(a.Preview, subscribers, alertsPerSubscriber)
+		}
+		return nil
+	}
+
+	// Without an outbox, everything is sent now and failures aren't retried
+	outbox := a.Outbox
+	if outbox == nil {
+		if len(alertsPerSubscriber) == 0 {
+			return nil
+		}
+		outbox, _ = LoadOutbox("")
+	}
+	for _, sub := range subscribers {
+		if set, ok := alertsPerSubscriber[sub.ID]; ok {
+			outbox.Add(sub.ID, set, now)
+		}
+	}
+
+	return a.deliver(outbox, subscribers, now)
+}
+
+// Deliver sends what is due in the outbox without new changes: digests whose
+// time has come, alerts held over quiet hours, and retries whose backoff has
+// passed. The tracker daemon calls it between cycles.
+func (a *Alerter) Deliver() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.Outbox == nil || a.Outbox.Len() == 0 || a.DryRun {
+		return nil
+	}
+	return a.deliver(a.Outbox, GetEnabledSubscribers(a.Config), time.Now())
+}
+
+// deliver releases held alerts that are due into notifications, attempts the
+// notifications that are due, saving the outbox and ledger as it goes
+func (a *Alerter) deliver(outbox *Outbox, subscribers []Subscriber, now time.Time) error {
+	persistent := outbox == a.Outbox
+
+	if dropped := outbox.Retain(subscribers); dropped > 0 {
+		a.Logger.Info("Dropped queued alerts for subscribers no longer enabled", "dropped", dropped)
+	}
+	byID := make(map[string]Subscriber, len(subscribers))
+	for _, sub := range subscribers {
+		byID[sub.ID] = sub
+		a.release(outbox, sub, now, !persistent)
+	}
+
+	// Save what was queued and released before sending anything, and after
+	// every attempt, so a crash partway through a batch loses at most the
+	// attempt in flight
+	if err := a.persist(outbox, persistent, false); err != nil {
+		return err
+	}
+
+	sentCount := 0
+	errorCount := 0
+	due := outbox.Due(now)
+	for i, n := range due {
+		sub := byID[n.Subscriber]
+
+		// Rate limiting: small delay between subscribers to respect provider
+		// limits (Mailgun sandbox: 300 emails/day, production varies by plan)
+		if i > 0 && due[i-1].Subscriber != n.Subscriber {
+			time.Sleep(500 * time.Millisecond)
+		}
+
+		msg, err := a.render(sub, n)
+		if err == nil {
+			err = a.notify(sub, n.Channel, msg)
+		}
+		if err != nil {
+			errorCount++
+			if n.MarkFailed(err, a.Config.Retry, now) || !persistent {
+				a.Logger.Error("Failed to send alert", logging.KeySubscriber, sub.ID, "channel", n.Channel.String(),
+					"id", n.ID, "attempts", n.Attempts, logging.KeyStatus, n.Status, logging.KeyError, err)
+			} else {
+				a.Logger.Warn("Failed to send alert; will retry", logging.KeySubscriber, sub.ID, "channel", n.Channel.String(),
+					"id", n.ID, "attempts", n.Attempts, "retry_at", n.NextAttempt, logging.KeyError, err)
+			}
+			if err := a.persist(outbox, persistent, false); err != nil {
+				return err
+			}
+			continue
+		}
+
+		n.MarkSent(now)
+		a.Logger.Info("Sent alert", logging.KeySubscriber, sub.ID, "channel", n.Channel.String(), "id", n.ID, "changes", n.Set.Total())
+		sentCount++
+		if a.Ledger != nil {
+			a.Ledger.Record(sub.ID, n.Set, now)
+		}
+		if err := a.persist(outbox, persistent, true); err != nil {
+			return err
+		}
+	}
+
+	if len(due) > 0 {
+		a.Logger.Info("Alert batch complete", "sent", sentCount, "errors", errorCount)
+	}
+
+	prunedSent := outbox.Prune(now)
+	prunedLedger := 0
+	if a.Ledger != nil && sentCount > 0 {
+		prunedLedger = a.Ledger.Prune(now.Add(-a.Config.Cooldowns.Longest()))
+	}
+	if prunedSent > 0 || prunedLedger > 0 {
+		if err := a.persist(outbox, persistent, prunedLedger > 0); err != nil {
+			return err
+		}
+	}
+	if persistent {
+		a.Logger.Debug("Saved outbox", "queued", outbox.Len())
+	}
+	if a.Ledger != nil && sentCount > 0 {
+		a.Logger.Debug("Saved alert ledger", "entries", a.Ledger.Len(), "pruned", prunedLedger)
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("%d notification(s) failed to send", errorCount)
+	}
+
+	return nil
+}
+
+// persist saves the outbox, unless it is in memory only, and with ledger
+// set, the alert ledger
+func (a *Alerter) persist(outbox *Outbox, persistent, ledger bool) error {
+	if persistent {
+		if err := outbox.Save(); err != nil {
+			return fmt.Errorf("failed to save outbox: %w", err)
+		}
+	}
+	if ledger && a.Ledger != nil {
+		if err := a.Ledger.Save(); err != nil {
+			return fmt.Errorf("failed to save alert ledger: %w", err)
+		}
+	}
+	return nil
+}
+
+// buildAlerts builds each subscriber's alert set and drops changes the
+// ledger says were already sent
+func (a *Alerter) buildAlerts(changes *ComparisonResult, subscribers []Subscriber, now time.Time) map[string]AlertSet {
+	alertsPerSubscriber := BuildAlerts(changes, subscribers)
+	for _, sub := range subscribers {
+		set := alertsPerSubscriber[sub.ID]
+		a.Logger.Info("Subscriber matches", logging.KeySubscriber, sub.ID,
+			"new", len(set.NewItems), "restocked", len(set.Restocks), "sold_out", len(set.SoldOut))
+	}
+	if len(alertsPerSubscriber) == 0 {
+		a.Logger.Info("No items matched any subscriber preferences - no new alerts")
+		return alertsPerSubscriber
+	}
+
+	if a.Ledger != nil {
+		for _, sub := range subscribers {
+			set, ok := alertsPerSubscriber[sub.ID]
+			if !ok {
+				continue
+			}
+			kept, suppressed := a.Ledger.Filter(sub.ID, set, a.Config.Cooldowns, now)
+			if suppressed > 0 {
+				a.Logger.Info("Suppressed alerts already sent within their cooldown",
+					logging.KeySubscriber, sub.ID, "suppressed", suppressed, "remaining", kept.Total())
+			}
+			if kept.IsEmpty() {
+				delete(alertsPerSubscriber, sub.ID)
+			} else {
+				alertsPerSubscriber[sub.ID] = kept
+			}
+		}
+		if len(alertsPerSubscriber) == 0 {
+			a.Logger.Info("All matching changes were already alerted - no new alerts")
+		}
+	}
+
+	return alertsPerSubscriber
+}
+
+// release turns a subscriber's held alerts into notifications once their
+// delivery schedule is due: everything held, as a digest unless it is a
+// single instant alert. immediate ignores the schedule.
+func (a *Alerter) release(outbox *Outbox, sub Subscriber, now time.Time, immediate bool) {
+	pending := outbox.Pending(sub.ID)
+	if len(pending) == 0 {
+		return
+	}
+	since := pending[0].QueuedAt
+
+	switch {
+	case immediate:
+		if sub.Delivery.Period() != "" || sub.Delivery.QuietHours != nil {
+			a.Logger.Warn("Delivery schedule needs an outbox; sending now", logging.KeySubscriber, sub.ID)
+		}
+	case !sub.Delivery.Due(now, since):
+		a.Logger.Debug("Holding alerts until delivery is due", logging.KeySubscriber, sub.ID,
+			"queued", len(pending), "mode", sub.Delivery.Mode, "quiet", sub.Delivery.Quiet(now))
+		return
+	}
+
+	if len(pending) == 1 && (sub.Delivery.Period() == "" || immediate) {
+		outbox.Release(sub, pending[0].Set, false, since, now)
+		return
+	}
+	sets := make([]AlertSet, len(pending))
+	for i, entry := range pending {
+		sets[i] = entry.Set
+	}
+	merged := MergeAlertSets(sets)
+	sortByDistance(&merged, sub.Preferences.Near)
+	outbox.Release(sub, merged, true, since, now)
+}
+
+// render builds a notification's message. It is rendered as of when the
+// notification was created, so every attempt sends the same thing.
+func (a *Alerter) render(sub Subscriber, n *Notification) (*Message, error) {
+	var msg *Message
+	var err error
+	if n.Digest {
+		msg, err = NewDigest(sub, n.Set, n.Since, n.CreatedAt)
+	} else {
+		msg, err = NewMessage(sub, n.Set, n.CreatedAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	msg.ID = n.ID
+	return msg, nil
+}
+
+// notify delivers a message to one of a subscriber's channels
+func (a *Alerter) notify(sub Subscriber, channel Channel, msg *Message) error {
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	notifier, err := NewNotifier(a.Config, sub, channel, client)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return notifier.Notify(ctx, msg)
+}
+
+// WritePreviews prints a plain-text preview of each subscriber's alert and
+// the channels it would go to
+func WritePreviews(w io.Writer, subscribers []Subscriber, alertsPerSubscriber map[string]AlertSet) {
+	for _, sub := range subscribers {
+		set, ok := alertsPerSubscriber[sub.ID]
+		if !ok || set.IsEmpty() {
+			continue
+		}
+
+		var channels []string
+		for _, channel := range sub.AlertChannels() {
+			if channel.usesEmail() && channel.To == "" {
+				channel.To = sub.Email
+			}
+			channels = append(channels, channel.String())
+		}
+
+		near := sub.Preferences.Near
+		fmt.Fprintf(w, "\n--- Alert for %s (%s) ---\n", sub.ID, strings.Join(channels, ", "))
+		fmt.Fprintf(w, "Subject: %s\n", Subject(set))
+		if len(set.NewItems) > 0 {
+			fmt.Fprintf(w, "New:\n")
+			for _, item := range set.NewItems {
+				fmt.Fprintf(w, "  - %s (%s, %d bottles%s)\n", item.ProductName, item.StoreLabel(), item.Quantity, distanceSuffix(near, item))
+			}
+		}
+		if len(set.Restocks) > 0 {
+			fmt.Fprintf(w, "Restocked:\n")
+			for _, change := range set.Restocks {
+				fmt.Fprintf(w, "  - %s (%s, %d -> %d bottles%s)\n", change.Item.ProductName, change.Item.StoreLabel(), change.OldQuantity, change.NewQuantity, distanceSuffix(near, change.Item))
+			}
+		}
+		if len(set.SoldOut) > 0 {
+			fmt.Fprintf(w, "Sold out:\n")
+			for _, item := range set.SoldOut {
+				fmt.Fprintf(w, "  - %s (%s%s)\n", item.ProductName, item.StoreLabel(), distanceSuffix(near, item))
+			}
+		}
+	}
+}
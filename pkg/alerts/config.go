@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"regexp"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
 )
 
 // LoadConfig loads and validates the subscriptions configuration file
@@ -33,6 +35,16 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("version field is required")
 	}
 
+	for _, change := range []string{ChangeNew, ChangeRestock, ChangeSoldOut} {
+		if config.Cooldowns.For(change) < 0 {
+			return fmt.Errorf("cooldown for %s cannot be negative", change)
+		}
+	}
+
+	if config.Retry.MaxAttempts < 0 || config.Retry.InitialBackoff < 0 || config.Retry.MaxBackoff < 0 {
+		return fmt.Errorf("retry settings cannot be negative")
+	}
+
 	// Check for duplicate subscriber IDs
 	ids := make(map[string]bool)
 	for _, sub := range config.Subscribers {
@@ -44,9 +56,24 @@ func validateConfig(config *Config) error {
 		}
 		ids[sub.ID] = true
 
-		// Validate email format
-		if err := validateEmail(sub.Email); err != nil {
-			return fmt.Errorf("invalid email for subscriber %s: %w", sub.ID, err)
+		// Validate channels, and the email address if a channel sends to it
+		needsEmail := false
+		for i, channel := range sub.AlertChannels() {
+			if err := validateChannel(channel); err != nil {
+				return fmt.Errorf("invalid channel %d for subscriber %s: %w", i, sub.ID, err)
+			}
+			if channel.usesEmail() && channel.To == "" {
+				needsEmail = true
+			}
+		}
+		if needsEmail || sub.Email != "" {
+			if err := validateEmail(sub.Email); err != nil {
+				return fmt.Errorf("invalid email for subscriber %s: %w", sub.ID, err)
+			}
+		}
+
+		if err := sub.Delivery.validate(); err != nil {
+			return fmt.Errorf("invalid delivery for subscriber %s: %w", sub.ID, err)
 		}
 
 		// Validate preferences
@@ -73,6 +100,31 @@ func validateEmail(email string) error {
 	return nil
 }
 
+// validateChannel checks a channel has what its type needs to send
+func validateChannel(channel Channel) error {
+	switch channel.Type {
+	case ChannelEmail, ChannelSMTP, ChannelMailgun:
+		if channel.To != "" {
+			return validateEmail(channel.To)
+		}
+	case ChannelWebhook, ChannelSlack, ChannelDiscord:
+		if channel.URL == "" && channel.URLEnv == "" {
+			return fmt.Errorf("%s channel requires url or url_env", channel.Type)
+		}
+	case ChannelNtfy:
+		if channel.Topic == "" {
+			return fmt.Errorf("ntfy channel requires topic")
+		}
+	case ChannelTelegram:
+		if channel.ChatID == "" {
+			return fmt.Errorf("telegram channel requires chat_id")
+		}
+	default:
+		return fmt.Errorf("unknown channel type %q", channel.Type)
+	}
+	return nil
+}
+
 // validatePreferences validates subscriber preferences
 func validatePreferences(prefs *Preferences) error {
 	// Validate states (if specified)
@@ -102,6 +154,40 @@ func validatePreferences(prefs *Preferences) error {
 		return fmt.Errorf("min_quantity cannot be negative")
 	}
 
+	// Validate alert_on.min_increase
+	if prefs.AlertOn.MinIncrease < 0 {
+		return fmt.Errorf("alert_on.min_increase cannot be negative")
+	}
+
+	// Validate home points and polygon
+	for i, home := range prefs.Near {
+		if err := validateLocation(home.Location); err != nil {
+			return fmt.Errorf("near[%d]: %w", i, err)
+		}
+		if home.RadiusMiles < 0 {
+			return fmt.Errorf("near[%d]: radius_miles cannot be negative", i)
+		}
+	}
+	if len(prefs.Polygon) > 0 && len(prefs.Polygon) < 3 {
+		return fmt.Errorf("polygon needs at least 3 points")
+	}
+	for i, point := range prefs.Polygon {
+		if err := validateLocation(point); err != nil {
+			return fmt.Errorf("polygon[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateLocation checks coordinates are in range and not left at zero
+func validateLocation(location tracker.Location) error {
+	if location == (tracker.Location{}) {
+		return fmt.Errorf("lat and lon are required")
+	}
+	if location.Latitude < -90 || location.Latitude > 90 || location.Longitude < -180 || location.Longitude > 180 {
+		return fmt.Errorf("lat/lon out of range: %g,%g", location.Latitude, location.Longitude)
+	}
 	return nil
 }
 
@@ -7,16 +7,24 @@ import (
 // DetectChanges compares previous and current inventory to find new items,
 // removed items, and quantity changes
 func DetectChanges(previous, current []tracker.InventoryItem) *ComparisonResult {
+	return DetectSnapshotChanges(Snapshot{Items: previous}, Snapshot{Items: current})
+}
+
+// DetectSnapshotChanges compares two snapshots, but only for product/store
+// pairs covered by both. A store that failed to scan or a product whose search
+// errored would otherwise look like a removal followed by a new allocation.
+// Items for uncovered pairs are returned in Uncovered instead.
+func DetectSnapshotChanges(previous, current Snapshot) *ComparisonResult {
 	// Build maps keyed by (ProductID + StoreID)
 	prevMap := make(map[string]tracker.InventoryItem)
 	currMap := make(map[string]tracker.InventoryItem)
 
-	for _, item := range previous {
+	for _, item := range previous.Items {
 		key := makeInventoryKey(item.ProductID, item.StoreID)
 		prevMap[key] = item
 	}
 
-	for _, item := range current {
+	for _, item := range current.Items {
 		key := makeInventoryKey(item.ProductID, item.StoreID)
 		currMap[key] = item
 	}
@@ -25,10 +33,21 @@ func DetectChanges(previous, current []tracker.InventoryItem) *ComparisonResult
 		NewItems:        []tracker.InventoryItem{},
 		RemovedItems:    []tracker.InventoryItem{},
 		QuantityChanges: []QuantityChange{},
+		Uncovered:       []tracker.InventoryItem{},
+	}
+
+	covered := func(item tracker.InventoryItem) bool {
+		return previous.Coverage.Covers(item.ProductID, item.StoreID) &&
+			current.Coverage.Covers(item.ProductID, item.StoreID)
 	}
 
 	// Find new items (exists in current, not in previous)
 	for key, item := range currMap {
+		if !covered(item) {
+			result.Uncovered = append(result.Uncovered, item)
+			continue
+		}
+
 		if prevItem, exists := prevMap[key]; !exists {
 			result.NewItems = append(result.NewItems, item)
 		} else {
@@ -46,9 +65,15 @@ func DetectChanges(previous, current []tracker.InventoryItem) *ComparisonResult
 
 	// Find removed items (exists in previous, not in current)
 	for key, item := range prevMap {
-		if _, exists := currMap[key]; !exists {
-			result.RemovedItems = append(result.RemovedItems, item)
+		if _, exists := currMap[key]; exists {
+			continue
+		}
+
+		if !covered(item) {
+			result.Uncovered = append(result.Uncovered, item)
+			continue
 		}
+		result.RemovedItems = append(result.RemovedItems, item)
 	}
 
 	return result
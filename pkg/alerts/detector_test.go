@@ -0,0 +1,110 @@
+package alerts
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// summarize lists a comparison as sorted "kind product/store" strings
+func summarize(result *ComparisonResult) []string {
+	lines := []string{}
+	for _, item := range result.NewItems {
+		lines = append(lines, fmt.Sprintf("new %s/%s", item.ProductID, item.StoreID))
+	}
+	for _, item := range result.RemovedItems {
+		lines = append(lines, fmt.Sprintf("removed %s/%s", item.ProductID, item.StoreID))
+	}
+	for _, change := range result.QuantityChanges {
+		lines = append(lines, fmt.Sprintf("quantity %s/%s %d->%d (%+d)", change.Item.ProductID, change.Item.StoreID,
+			change.OldQuantity, change.NewQuantity, change.Delta))
+	}
+	for _, item := range result.Uncovered {
+		lines = append(lines, fmt.Sprintf("uncovered %s/%s", item.ProductID, item.StoreID))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestDetectSnapshotChanges(t *testing.T) {
+	stock := func(product, store string, quantity int) tracker.InventoryItem {
+		return tracker.InventoryItem{ProductID: product, StoreID: store, Quantity: quantity}
+	}
+	previous := []tracker.InventoryItem{
+		stock("a", "1", 2), // Restocked
+		stock("b", "1", 1), // Sold out
+		stock("a", "2", 5), // Unchanged
+		stock("c", "3", 4), // Sold out, at a store only the previous run scanned
+	}
+	current := []tracker.InventoryItem{
+		stock("a", "1", 6),
+		stock("a", "2", 5),
+		stock("d", "1", 1), // New
+		stock("d", "4", 2), // New, at a store only the current run scanned
+	}
+
+	tests := []struct {
+		name              string
+		previous, current *tracker.Coverage
+		want              []string
+	}{
+		{
+			name: "no coverage compares everything",
+			want: []string{"new d/1", "new d/4", "quantity a/1 2->6 (+4)", "removed b/1", "removed c/3"},
+		},
+		{
+			name:     "store coverage on both sides",
+			previous: &tracker.Coverage{Stores: []string{"1", "2", "3"}},
+			current:  &tracker.Coverage{Stores: []string{"1", "2", "4"}},
+			want:     []string{"new d/1", "quantity a/1 2->6 (+4)", "removed b/1", "uncovered c/3", "uncovered d/4"},
+		},
+		{
+			name:    "coverage on one side only",
+			current: &tracker.Coverage{Stores: []string{"1", "2"}},
+			want:    []string{"new d/1", "quantity a/1 2->6 (+4)", "removed b/1", "uncovered c/3", "uncovered d/4"},
+		},
+		{
+			name:     "product coverage",
+			previous: &tracker.Coverage{Products: []string{"a", "b", "c", "d"}},
+			current:  &tracker.Coverage{Products: []string{"a", "d"}},
+			want:     []string{"new d/1", "new d/4", "quantity a/1 2->6 (+4)", "uncovered b/1", "uncovered c/3"},
+		},
+		{
+			name:     "stores and products",
+			previous: &tracker.Coverage{Stores: []string{"1", "2", "3", "4"}, Products: []string{"a", "b"}},
+			current:  &tracker.Coverage{Stores: []string{"1", "2", "3", "4"}, Products: []string{"a", "b", "d"}},
+			want:     []string{"quantity a/1 2->6 (+4)", "removed b/1", "uncovered c/3", "uncovered d/1", "uncovered d/4"},
+		},
+		{
+			name:     "a run that covered nothing",
+			previous: &tracker.Coverage{Stores: []string{"1", "2", "3"}},
+			current:  &tracker.Coverage{Stores: []string{}},
+			want:     []string{"uncovered a/1", "uncovered a/2", "uncovered b/1", "uncovered c/3", "uncovered d/1", "uncovered d/4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarize(DetectSnapshotChanges(
+				Snapshot{Items: previous, Coverage: tt.previous},
+				Snapshot{Items: current, Coverage: tt.current},
+			))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changes =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectChangesEmpty(t *testing.T) {
+	result := DetectChanges(nil, nil)
+	if result.NewItems == nil || result.RemovedItems == nil || result.QuantityChanges == nil || result.Uncovered == nil {
+		t.Errorf("empty comparison has nil lists: %+v", result)
+	}
+	if got := summarize(result); len(got) != 0 {
+		t.Errorf("changes = %q, want none", got)
+	}
+}
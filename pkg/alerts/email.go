@@ -0,0 +1,216 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v4"
+)
+
+// MailgunNotifier emails alerts through the Mailgun API
+type MailgunNotifier struct {
+	mg   *mailgun.MailgunImpl
+	from string
+	to   string
+}
+
+// NewMailgunNotifier returns a notifier that emails to, using MAILGUN_DOMAIN
+// and MAILGUN_API_KEY from the environment
+func NewMailgunNotifier(config MailgunConfig, to string) (*MailgunNotifier, error) {
+	mailgunDomain := os.Getenv("MAILGUN_DOMAIN")
+	mailgunAPIKey := os.Getenv("MAILGUN_API_KEY")
+
+	if mailgunDomain == "" || mailgunAPIKey == "" {
+		return nil, fmt.Errorf("Mailgun configuration missing (MAILGUN_DOMAIN and MAILGUN_API_KEY required)")
+	}
+
+	mg := mailgun.NewMailgun(mailgunDomain, mailgunAPIKey)
+	if config.APIBase != "" {
+		mg.SetAPIBase(config.APIBase)
+	}
+
+	// Use default sender if from_email not specified
+	fromEmail := config.FromEmail
+	if fromEmail == "" {
+		fromEmail = fmt.Sprintf("postmaster@%s", mailgunDomain)
+	}
+
+	return &MailgunNotifier{mg: mg, from: formatAddress(config.FromName, fromEmail), to: to}, nil
+}
+
+// Notify sends the alert as an email with HTML and plain-text parts
+func (n *MailgunNotifier) Notify(ctx context.Context, msg *Message) error {
+	message := n.mg.NewMessage(n.from, msg.Subject, msg.Text, n.to)
+	message.SetHtml(msg.HTML)
+	if msg.ID != "" {
+		message.AddHeader("Message-Id", messageID(msg))
+	}
+
+	if _, _, err := n.mg.Send(ctx, message); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", n.to, err)
+	}
+	return nil
+}
+
+// SMTPNotifier emails alerts through an SMTP server. It upgrades to TLS with
+// STARTTLS when the server offers it, or connects with TLS on port 465.
+type SMTPNotifier struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string // Envelope sender
+	header   string // From header, with display name
+	to       string
+}
+
+// NewSMTPNotifier returns a notifier that emails to, using SMTP_PASSWORD
+// from the environment if the config has a username
+func NewSMTPNotifier(config SMTPConfig, to string) (*SMTPNotifier, error) {
+	if config.Host == "" || config.FromEmail == "" {
+		return nil, fmt.Errorf("SMTP configuration missing (smtp.host and smtp.from_email required)")
+	}
+
+	port := config.Port
+	if port == 0 {
+		port = 587
+	}
+	return &SMTPNotifier{
+		host:     config.Host,
+		port:     port,
+		username: config.Username,
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     config.FromEmail,
+		header:   formatAddress(config.FromName, config.FromEmail),
+		to:       to,
+	}, nil
+}
+
+// Notify sends the alert as a multipart email with HTML and plain-text parts
+func (n *SMTPNotifier) Notify(ctx context.Context, msg *Message) error {
+	body, err := n.buildEmail(msg)
+	if err != nil {
+		return err
+	}
+	if err := n.send(ctx, body); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", n.to, err)
+	}
+	return nil
+}
+
+// send delivers a message over a single SMTP session
+func (n *SMTPNotifier) send(ctx context.Context, body []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(n.host, strconv.Itoa(n.port)))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if n.port == 465 {
+		conn = tls.Client(conn, &tls.Config{ServerName: n.host})
+	}
+
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && n.port != 465 {
+		if err := client.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if n.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.username, n.password, n.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(n.to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildEmail renders a multipart/alternative MIME message
+func (n *SMTPNotifier) buildEmail(msg *Message) ([]byte, error) {
+	var parts bytes.Buffer
+	writer := multipart.NewWriter(&parts)
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var email bytes.Buffer
+	fmt.Fprintf(&email, "From: %s\r\n", n.header)
+	fmt.Fprintf(&email, "To: %s\r\n", n.to)
+	fmt.Fprintf(&email, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&email, "Date: %s\r\n", msg.Time.Format(time.RFC1123Z))
+	if msg.ID != "" {
+		fmt.Fprintf(&email, "Message-ID: %s\r\n", messageID(msg))
+	}
+	fmt.Fprintf(&email, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&email, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", writer.Boundary())
+	email.Write(parts.Bytes())
+	return email.Bytes(), nil
+}
+
+// messageID turns a notification's idempotency key into a Message-ID, so a
+// retried email that was already delivered shows up as the same message
+func messageID(msg *Message) string {
+	return "<" + msg.ID + "@bourbontracker>"
+}
+
+// formatAddress builds an address with an optional display name
+func formatAddress(name, email string) string {
+	if name == "" {
+		return email
+	}
+	return fmt.Sprintf("%s <%s>", mime.QEncoding.Encode("utf-8", name), email)
+}
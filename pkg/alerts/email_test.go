@@ -0,0 +1,220 @@
+package alerts
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what fakeSMTP received in one session
+type smtpSession struct {
+	auth string // Decoded AUTH PLAIN credentials
+	from string
+	rcpt []string
+	data string
+}
+
+// fakeSMTP accepts one SMTP session on a local port, advertising AUTH PLAIN
+// but not STARTTLS, and sends what it received on the returned channel
+func fakeSMTP(t *testing.T) (host string, port int, sessions <-chan smtpSession) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	out := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+		var session smtpSession
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+			switch verb {
+			case "EHLO", "HELO":
+				reply("250-fake")
+				reply("250 AUTH PLAIN")
+			case "AUTH":
+				fields := strings.Fields(line)
+				decoded, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+				session.auth = string(decoded)
+				reply("235 ok")
+			case "MAIL":
+				session.from = line
+				reply("250 ok")
+			case "RCPT":
+				session.rcpt = append(session.rcpt, line)
+				reply("250 ok")
+			case "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(strings.TrimPrefix(dataLine, "."))
+				}
+				session.data = data.String()
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				out <- session
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, out
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	host, port, sessions := fakeSMTP(t)
+	t.Setenv("SMTP_PASSWORD", "hunter2")
+
+	notifier, err := NewSMTPNotifier(SMTPConfig{
+		Host:      host,
+		Port:      port,
+		Username:  "alerts",
+		FromEmail: "alerts@example.com",
+		FromName:  "Cask Watch",
+	}, "sub@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := testMessage(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := notifier.Notify(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	var session smtpSession
+	select {
+	case session = <-sessions:
+	case <-ctx.Done():
+		t.Fatal("SMTP session did not finish")
+	}
+
+	if session.auth != "\x00alerts\x00hunter2" {
+		t.Errorf("AUTH PLAIN credentials = %q", session.auth)
+	}
+	if session.from != "MAIL FROM:<alerts@example.com>" && !strings.HasPrefix(session.from, "MAIL FROM:<alerts@example.com> ") {
+		t.Errorf("MAIL = %q, want alerts@example.com", session.from)
+	}
+	if len(session.rcpt) != 1 || session.rcpt[0] != "RCPT TO:<sub@example.com>" {
+		t.Errorf("RCPT = %q, want sub@example.com", session.rcpt)
+	}
+
+	email, err := mail.ReadMessage(strings.NewReader(session.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(email.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q, want %q", subject, msg.Subject)
+	}
+	if got := email.Header.Get("Message-ID"); got != "<"+msg.ID+"@bourbontracker>" {
+		t.Errorf("Message-ID = %q", got)
+	}
+	if got := email.Header.Get("From"); !strings.Contains(got, "<alerts@example.com>") {
+		t.Errorf("From = %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(email.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", email.Header.Get("Content-Type"))
+	}
+	var types []string
+	parts := multipart.NewReader(email.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+		// multipart.Reader decodes quoted-printable parts
+		body, _ := io.ReadAll(part)
+		if !strings.Contains(string(body), "Blanton's") && !strings.Contains(string(body), "Blanton&#39;s") {
+			t.Errorf("%s part does not mention the item", part.Header.Get("Content-Type"))
+		}
+	}
+	if strings.Join(types, ",") != "text/plain; charset=utf-8,text/html; charset=utf-8" {
+		t.Errorf("parts = %v, want plain text then HTML", types)
+	}
+}
+
+func TestSMTPNotifierServerError(t *testing.T) {
+	// A listener that rejects the connection outright
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		io.WriteString(conn, "554 no service\r\n")
+		conn.Close()
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	notifier, err := NewSMTPNotifier(SMTPConfig{Host: addr.IP.String(), Port: addr.Port, FromEmail: "alerts@example.com"}, "sub@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = notifier.Notify(context.Background(), testMessage(t))
+	if err == nil || !strings.Contains(err.Error(), "sub@example.com") {
+		t.Errorf("error = %v, want a send failure naming the recipient", err)
+	}
+}
+
+func TestNewSMTPNotifierDefaults(t *testing.T) {
+	if _, err := NewSMTPNotifier(SMTPConfig{Host: "mail.example.com"}, "sub@example.com"); err == nil {
+		t.Error("NewSMTPNotifier accepted a config without from_email")
+	}
+
+	notifier, err := NewSMTPNotifier(SMTPConfig{Host: "mail.example.com", FromEmail: "a@example.com"}, "sub@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notifier.port != 587 {
+		t.Errorf("port = %s, want 587", strconv.Itoa(notifier.port))
+	}
+}
@@ -19,6 +19,45 @@ func FilterForSubscriber(items []tracker.InventoryItem, prefs Preferences) []tra
 	return filtered
 }
 
+// BuildAlertSet selects the changes a subscriber should hear about, according
+// to their filters and AlertOn settings
+func BuildAlertSet(changes *ComparisonResult, prefs Preferences) AlertSet {
+	alertOn := prefs.AlertOn
+	if !alertOn.NewProductAtStore && !alertOn.QuantityIncrease && !alertOn.SoldOut {
+		// Subscriptions written before alert_on existed only got new items
+		alertOn.NewProductAtStore = true
+	}
+
+	var set AlertSet
+
+	if alertOn.NewProductAtStore {
+		set.NewItems = FilterForSubscriber(changes.NewItems, prefs)
+	}
+
+	if alertOn.QuantityIncrease {
+		minIncrease := alertOn.MinIncrease
+		if minIncrease < 1 {
+			minIncrease = 1
+		}
+
+		for _, change := range changes.QuantityChanges {
+			if change.Delta >= minIncrease && matchesPreferences(change.Item, prefs) {
+				set.Restocks = append(set.Restocks, change)
+			}
+		}
+	}
+
+	if alertOn.SoldOut {
+		// The quantity threshold doesn't apply to items that are now gone
+		soldOutPrefs := prefs
+		soldOutPrefs.MinQuantity = 0
+		set.SoldOut = FilterForSubscriber(changes.RemovedItems, soldOutPrefs)
+	}
+
+	sortByDistance(&set, prefs.Near)
+	return set
+}
+
 // matchesPreferences checks if an item matches all subscriber preferences
 func matchesPreferences(item tracker.InventoryItem, prefs Preferences) bool {
 	// State filter
@@ -58,6 +97,11 @@ func matchesPreferences(item tracker.InventoryItem, prefs Preferences) bool {
 		return false
 	}
 
+	// Home radius / polygon filter
+	if !prefs.inArea(item.Location) {
+		return false
+	}
+
 	return true
 }
 
@@ -0,0 +1,106 @@
+package alerts
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// DefaultRadiusMiles applies to home points without radius_miles
+const DefaultRadiusMiles = 25
+
+// Radius returns the point's radius in miles
+func (h HomePoint) Radius() float64 {
+	if h.RadiusMiles <= 0 {
+		return DefaultRadiusMiles
+	}
+	return h.RadiusMiles
+}
+
+// inArea reports whether a location is within any home point's radius or
+// inside the polygon. Subscribers with neither match everywhere; items
+// without a location match nowhere once an area is set.
+func (p Preferences) inArea(location tracker.Location) bool {
+	if len(p.Near) == 0 && len(p.Polygon) == 0 {
+		return true
+	}
+	if location == (tracker.Location{}) {
+		return false
+	}
+	for _, home := range p.Near {
+		if home.DistanceMiles(location) <= home.Radius() {
+			return true
+		}
+	}
+	return len(p.Polygon) >= 3 && insidePolygon(location, p.Polygon)
+}
+
+// nearestHome returns the home point closest to location and the distance to
+// it in miles. ok is false if there are no home points or the location is
+// unknown.
+func nearestHome(near []HomePoint, location tracker.Location) (home HomePoint, miles float64, ok bool) {
+	if location == (tracker.Location{}) {
+		return home, 0, false
+	}
+	for _, point := range near {
+		if d := point.DistanceMiles(location); !ok || d < miles {
+			home, miles, ok = point, d, true
+		}
+	}
+	return home, miles, ok
+}
+
+// distanceLabel describes how far an item is from the nearest home point,
+// e.g. "4.2 mi from Home", or returns "" if that isn't known
+func distanceLabel(near []HomePoint, item tracker.InventoryItem) string {
+	home, miles, ok := nearestHome(near, item.Location)
+	if !ok {
+		return ""
+	}
+	if home.Name == "" {
+		return fmt.Sprintf("%.1f mi", miles)
+	}
+	return fmt.Sprintf("%.1f mi from %s", miles, home.Name)
+}
+
+// sortByDistance orders each part of an alert set nearest first. Items
+// without a location keep their order after the rest.
+func sortByDistance(set *AlertSet, near []HomePoint) {
+	if len(near) == 0 {
+		return
+	}
+	less := func(a, b tracker.Location) bool {
+		_, da, okA := nearestHome(near, a)
+		_, db, okB := nearestHome(near, b)
+		if okA != okB {
+			return okA
+		}
+		return okA && da < db
+	}
+	sort.SliceStable(set.NewItems, func(i, j int) bool {
+		return less(set.NewItems[i].Location, set.NewItems[j].Location)
+	})
+	sort.SliceStable(set.Restocks, func(i, j int) bool {
+		return less(set.Restocks[i].Item.Location, set.Restocks[j].Item.Location)
+	})
+	sort.SliceStable(set.SoldOut, func(i, j int) bool {
+		return less(set.SoldOut[i].Location, set.SoldOut[j].Location)
+	})
+}
+
+// insidePolygon reports whether a location is inside a polygon, by counting
+// edge crossings of a ray from it. Treating coordinates as planar is close
+// enough at the scale of a subscriber's area.
+func insidePolygon(location tracker.Location, polygon []tracker.Location) bool {
+	x, y := location.Longitude, location.Latitude
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		xi, yi := polygon[i].Longitude, polygon[i].Latitude
+		xj, yj := polygon[j].Longitude, polygon[j].Latitude
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
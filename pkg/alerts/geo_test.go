@@ -0,0 +1,165 @@
+package alerts
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// at returns a location; a degree of latitude is about 69 miles
+func at(lat, lon float64) tracker.Location {
+	return tracker.Location{Latitude: lat, Longitude: lon}
+}
+
+func TestInAreaRadius(t *testing.T) {
+	home := HomePoint{Name: "Home", Location: at(37, -77)} // Default 25 miles
+	cabin := HomePoint{Name: "Cabin", Location: at(36, -80), RadiusMiles: 10}
+
+	tests := []struct {
+		name     string
+		near     []HomePoint
+		location tracker.Location
+		want     bool
+	}{
+		{"no area", nil, at(40, -70), true},
+		{"no area, no location", nil, tracker.Location{}, true},
+		{"inside the default radius", []HomePoint{home}, at(37.36, -77), true},   // ~24.9 mi
+		{"outside the default radius", []HomePoint{home}, at(37.37, -77), false}, // ~25.6 mi
+		{"inside a set radius", []HomePoint{cabin}, at(35.86, -80), true},        // ~9.7 mi
+		{"outside a set radius", []HomePoint{cabin}, at(35.85, -80), false},      // ~10.4 mi
+		{"near the second point", []HomePoint{home, cabin}, at(36.05, -80), true},
+		{"near neither", []HomePoint{home, cabin}, at(38, -79), false},
+		{"unknown location", []HomePoint{home}, tracker.Location{}, false},
+	}
+
+	for _, tt := range tests {
+		prefs := Preferences{Near: tt.near}
+		if got := prefs.inArea(tt.location); got != tt.want {
+			t.Errorf("%s: inArea = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInAreaPolygon(t *testing.T) {
+	square := []tracker.Location{at(0, 0), at(0, 2), at(2, 2), at(2, 0)}
+	// A U open to the north: the notch between the arms is outside
+	u := []tracker.Location{at(0, 0), at(0, 3), at(3, 3), at(3, 2), at(1, 2), at(1, 1), at(3, 1), at(3, 0)}
+
+	tests := []struct {
+		name     string
+		polygon  []tracker.Location
+		location tracker.Location
+		want     bool
+	}{
+		{"inside", square, at(1, 1), true},
+		{"outside", square, at(3, 1), false},
+		{"beyond a corner", square, at(-0.1, -0.1), false},
+		{"concave, left arm", u, at(2, 0.5), true},
+		{"concave, right arm", u, at(2, 2.5), true},
+		{"concave, base", u, at(0.5, 1.5), true},
+		{"concave, in the notch", u, at(2, 1.5), false},
+		{"concave, above the notch", u, at(3.5, 1.5), false},
+		{"too few vertices", square[:2], at(0, 1), false},
+		{"unknown location", square, tracker.Location{}, false},
+	}
+
+	for _, tt := range tests {
+		prefs := Preferences{Polygon: tt.polygon}
+		if got := prefs.inArea(tt.location); got != tt.want {
+			t.Errorf("%s: inArea = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInsidePolygonSharedEdge(t *testing.T) {
+	// A point on the edge two polygons share belongs to exactly one of them,
+	// so a subscriber who splits an area in two doesn't lose or double it
+	west := []tracker.Location{at(0, 0), at(2, 0), at(2, 1), at(0, 1)}
+	east := []tracker.Location{at(0, 1), at(2, 1), at(2, 2), at(0, 2)}
+
+	for _, location := range []tracker.Location{at(0.5, 1), at(1, 1), at(1.5, 1)} {
+		inWest, inEast := insidePolygon(location, west), insidePolygon(location, east)
+		if inWest == inEast {
+			t.Errorf("%v: in west %v, in east %v; want exactly one", location, inWest, inEast)
+		}
+	}
+}
+
+func TestInAreaRadiusOrPolygon(t *testing.T) {
+	prefs := Preferences{
+		Near:    []HomePoint{{Location: at(37, -77), RadiusMiles: 5}},
+		Polygon: []tracker.Location{at(0, 0), at(0, 2), at(2, 2), at(2, 0)},
+	}
+	if !prefs.inArea(at(37.05, -77)) || !prefs.inArea(at(1, 1)) {
+		t.Error("a location in either the radius or the polygon should match")
+	}
+	if prefs.inArea(at(10, 10)) {
+		t.Error("a location in neither matched")
+	}
+}
+
+func TestSortByDistance(t *testing.T) {
+	home := []HomePoint{{Name: "Home", Location: at(37, -77)}, {Name: "Work", Location: at(38, -77)}}
+	item := func(store string, location tracker.Location) tracker.InventoryItem {
+		return tracker.InventoryItem{StoreID: store, Location: location}
+	}
+
+	set := AlertSet{
+		NewItems: []tracker.InventoryItem{
+			item("unknown-1", tracker.Location{}),
+			item("far", at(39, -77)),         // 1 degree from Work
+			item("near-work", at(38.1, -77)), // 0.1 from Work
+			item("unknown-2", tracker.Location{}),
+			item("near-home", at(37.2, -77)), // 0.2 from Home
+		},
+		Restocks: []QuantityChange{
+			{Item: item("far", at(36, -77))},
+			{Item: item("near", at(37, -77))},
+		},
+		SoldOut: []tracker.InventoryItem{item("b", at(37.5, -77)), item("a", at(37.5, -77))},
+	}
+	sortByDistance(&set, home)
+
+	stores := func(items []tracker.InventoryItem) []string {
+		var ids []string
+		for _, item := range items {
+			ids = append(ids, item.StoreID)
+		}
+		return ids
+	}
+	if got, want := stores(set.NewItems), []string{"near-work", "near-home", "far", "unknown-1", "unknown-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("new items = %v, want %v", got, want)
+	}
+	if set.Restocks[0].Item.StoreID != "near" {
+		t.Errorf("restocks not sorted: %v", set.Restocks)
+	}
+	// Ties keep their order
+	if got, want := stores(set.SoldOut), []string{"b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sold out = %v, want %v", got, want)
+	}
+
+	// Without home points nothing moves
+	unsorted := AlertSet{NewItems: []tracker.InventoryItem{item("far", at(39, -77)), item("near", at(37, -77))}}
+	sortByDistance(&unsorted, nil)
+	if got := stores(unsorted.NewItems); !reflect.DeepEqual(got, []string{"far", "near"}) {
+		t.Errorf("sorted without home points: %v", got)
+	}
+}
+
+func TestDistanceLabel(t *testing.T) {
+	item := tracker.InventoryItem{Location: at(37.1, -77)}
+	tests := []struct {
+		near []HomePoint
+		want string
+	}{
+		{[]HomePoint{{Name: "Home", Location: at(37, -77)}}, "6.9 mi from Home"},
+		{[]HomePoint{{Location: at(37, -77)}}, "6.9 mi"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := distanceLabel(tt.near, item); got != tt.want {
+			t.Errorf("distanceLabel = %q, want %q", got, tt.want)
+		}
+	}
+}
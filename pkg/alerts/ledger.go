@@ -0,0 +1,273 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Change types, as recorded in the ledger
+const (
+	ChangeNew     = "new"
+	ChangeRestock = "restock"
+	ChangeSoldOut = "sold_out"
+)
+
+// DefaultCooldown applies to change types without a configured cooldown
+const DefaultCooldown = 24 * time.Hour
+
+// Cooldowns set how long after an alert the same change for the same product,
+// store and subscriber is suppressed. Unset types use DefaultCooldown; "0s"
+// turns suppression off for a type.
+type Cooldowns struct {
+	NewProductAtStore *Duration `json:"new_product_at_store,omitempty"`
+	QuantityIncrease  *Duration `json:"quantity_increase,omitempty"`
+	SoldOut           *Duration `json:"sold_out,omitempty"`
+}
+
+// For returns the cooldown for a change type
+func (c Cooldowns) For(change string) time.Duration {
+	var d *Duration
+	switch change {
+	case ChangeNew:
+		d = c.NewProductAtStore
+	case ChangeRestock:
+		d = c.QuantityIncrease
+	case ChangeSoldOut:
+		d = c.SoldOut
+	}
+	if d == nil {
+		return DefaultCooldown
+	}
+	return time.Duration(*d)
+}
+
+// Longest returns the longest cooldown of any change type
+func (c Cooldowns) Longest() time.Duration {
+	longest := time.Duration(0)
+	for _, change := range []string{ChangeNew, ChangeRestock, ChangeSoldOut} {
+		if d := c.For(change); d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// Duration is a time.Duration written in JSON as a string such as "24h"
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"24h\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LedgerEntry is the last alert of one change type a subscriber was sent for
+// a product at a store
+type LedgerEntry struct {
+	Subscriber string    `json:"subscriber"`
+	ProductID  string    `json:"product_id"`
+	StoreID    string    `json:"store_id"`
+	Change     string    `json:"change"`
+	Quantity   int       `json:"quantity"` // Quantity in the alert
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// ledgerFile is the on-disk ledger format
+type ledgerFile struct {
+	Version int           `json:"version"`
+	Entries []LedgerEntry `json:"entries"`
+}
+
+// ledgerVersion is the ledger file format version
+const ledgerVersion = 1
+
+// ledgerKey identifies an entry
+type ledgerKey struct {
+	subscriber, productID, storeID, change string
+}
+
+// Ledger remembers which alerts have been sent across runs, so a change that
+// flickers in and out (a skipped store, a failed search) is only alerted once
+// per cooldown
+type Ledger struct {
+	path    string
+	entries map[ledgerKey]LedgerEntry
+}
+
+// LoadLedger reads a ledger file. A missing file yields an empty ledger,
+// which Save creates.
+func LoadLedger(path string) (*Ledger, error) {
+	ledger := &Ledger{path: path, entries: make(map[ledgerKey]LedgerEntry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file ledgerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse alert ledger %s: %w", path, err)
+	}
+	if file.Version > ledgerVersion {
+		return nil, fmt.Errorf("alert ledger %s has version %d; this build reads up to %d", path, file.Version, ledgerVersion)
+	}
+	for _, entry := range file.Entries {
+		ledger.entries[entry.key()] = entry
+	}
+	return ledger, nil
+}
+
+// Len returns the number of entries
+func (l *Ledger) Len() int {
+	return len(l.entries)
+}
+
+// Filter removes changes the subscriber was already alerted about within
+// their cooldown, returning what is left and how many were suppressed. A
+// restock is only suppressed if it doesn't exceed the quantity last sent.
+func (l *Ledger) Filter(subscriberID string, set AlertSet, cooldowns Cooldowns, now time.Time) (AlertSet, int) {
+	var kept AlertSet
+	suppressed := 0
+
+	for _, item := range set.NewItems {
+		if _, ok := l.recent(subscriberID, item.ProductID, item.StoreID, ChangeNew, cooldowns, now); ok {
+			suppressed++
+			continue
+		}
+		kept.NewItems = append(kept.NewItems, item)
+	}
+	for _, change := range set.Restocks {
+		entry, ok := l.recent(subscriberID, change.Item.ProductID, change.Item.StoreID, ChangeRestock, cooldowns, now)
+		if ok && change.NewQuantity <= entry.Quantity {
+			suppressed++
+			continue
+		}
+		kept.Restocks = append(kept.Restocks, change)
+	}
+	for _, item := range set.SoldOut {
+		if _, ok := l.recent(subscriberID, item.ProductID, item.StoreID, ChangeSoldOut, cooldowns, now); ok {
+			suppressed++
+			continue
+		}
+		kept.SoldOut = append(kept.SoldOut, item)
+	}
+
+	return kept, suppressed
+}
+
+// recent returns the entry for a change if it was sent within its cooldown
+func (l *Ledger) recent(subscriberID, productID, storeID, change string, cooldowns Cooldowns, now time.Time) (LedgerEntry, bool) {
+	entry, ok := l.entries[ledgerKey{subscriberID, productID, storeID, change}]
+	if !ok || now.Sub(entry.SentAt) >= cooldowns.For(change) {
+		return LedgerEntry{}, false
+	}
+	return entry, true
+}
+
+// Record notes that a subscriber was sent an alert set
+func (l *Ledger) Record(subscriberID string, set AlertSet, now time.Time) {
+	add := func(productID, storeID, change string, quantity int) {
+		entry := LedgerEntry{
+			Subscriber: subscriberID,
+			ProductID:  productID,
+			StoreID:    storeID,
+			Change:     change,
+			Quantity:   quantity,
+			SentAt:     now,
+		}
+		l.entries[entry.key()] = entry
+	}
+	for _, item := range set.NewItems {
+		add(item.ProductID, item.StoreID, ChangeNew, item.Quantity)
+	}
+	for _, change := range set.Restocks {
+		add(change.Item.ProductID, change.Item.StoreID, ChangeRestock, change.NewQuantity)
+	}
+	for _, item := range set.SoldOut {
+		add(item.ProductID, item.StoreID, ChangeSoldOut, 0)
+	}
+}
+
+// Prune drops entries sent before a time, which can no longer suppress
+// anything
+func (l *Ledger) Prune(before time.Time) int {
+	pruned := 0
+	for key, entry := range l.entries {
+		if entry.SentAt.Before(before) {
+			delete(l.entries, key)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// Save writes the ledger atomically, sorted so diffs stay readable
+func (l *Ledger) Save() error {
+	file := ledgerFile{Version: ledgerVersion, Entries: make([]LedgerEntry, 0, len(l.entries))}
+	for _, entry := range l.entries {
+		file.Entries = append(file.Entries, entry)
+	}
+	sort.Slice(file.Entries, func(i, j int) bool {
+		a, b := file.Entries[i], file.Entries[j]
+		if a.Subscriber != b.Subscriber {
+			return a.Subscriber < b.Subscriber
+		}
+		if a.ProductID != b.ProductID {
+			return a.ProductID < b.ProductID
+		}
+		if a.StoreID != b.StoreID {
+			return a.StoreID < b.StoreID
+		}
+		return a.Change < b.Change
+	})
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), "."+filepath.Base(l.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
+
+// key returns the entry's map key
+func (e LedgerEntry) key() ledgerKey {
+	return ledgerKey{e.Subscriber, e.ProductID, e.StoreID, e.Change}
+}
@@ -0,0 +1,123 @@
+package alerts
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+func newTestLedger(t *testing.T) *Ledger {
+	t.Helper()
+	ledger, err := LoadLedger(filepath.Join(t.TempDir(), "ledger.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ledger
+}
+
+func TestLedgerCooldown(t *testing.T) {
+	sent := time.Date(2025, 12, 13, 10, 0, 0, 0, time.UTC)
+	blantons := tracker.InventoryItem{ProductID: "016850", StoreID: "247", Quantity: 3}
+	set := AlertSet{NewItems: []tracker.InventoryItem{blantons}}
+
+	ledger := newTestLedger(t)
+	ledger.Record("sub-1", set, sent)
+
+	tests := []struct {
+		name           string
+		subscriber     string
+		cooldowns      Cooldowns
+		after          time.Duration
+		wantSuppressed int
+	}{
+		{"inside the default cooldown", "sub-1", Cooldowns{}, 23 * time.Hour, 1},
+		{"default cooldown over", "sub-1", Cooldowns{}, 24 * time.Hour, 0},
+		{"inside a set cooldown", "sub-1", Cooldowns{NewProductAtStore: durationOf(2 * time.Hour)}, time.Hour, 1},
+		{"set cooldown over", "sub-1", Cooldowns{NewProductAtStore: durationOf(2 * time.Hour)}, 3 * time.Hour, 0},
+		{"cooldown turned off", "sub-1", Cooldowns{NewProductAtStore: durationOf(0)}, 0, 0},
+		{"another subscriber", "sub-2", Cooldowns{}, time.Hour, 0},
+	}
+
+	for _, tt := range tests {
+		kept, suppressed := ledger.Filter(tt.subscriber, set, tt.cooldowns, sent.Add(tt.after))
+		if suppressed != tt.wantSuppressed || kept.Total()+suppressed != 1 {
+			t.Errorf("%s: kept %d, suppressed %d; want %d suppressed", tt.name, kept.Total(), suppressed, tt.wantSuppressed)
+		}
+	}
+}
+
+func TestLedgerChangeKinds(t *testing.T) {
+	sent := time.Date(2025, 12, 13, 10, 0, 0, 0, time.UTC)
+	item := tracker.InventoryItem{ProductID: "016850", StoreID: "247", Quantity: 3}
+	restock := QuantityChange{Item: item, OldQuantity: 1, NewQuantity: 3, Delta: 2}
+
+	ledger := newTestLedger(t)
+	ledger.Record("sub-1", AlertSet{NewItems: []tracker.InventoryItem{item}, Restocks: []QuantityChange{restock}}, sent)
+	later := sent.Add(time.Hour)
+
+	// A new-item alert doesn't suppress the pair selling out
+	kept, suppressed := ledger.Filter("sub-1", AlertSet{SoldOut: []tracker.InventoryItem{item}}, Cooldowns{}, later)
+	if suppressed != 0 || len(kept.SoldOut) != 1 {
+		t.Errorf("sold out suppressed by another kind of change: kept %+v", kept)
+	}
+
+	// Each kind has its own cooldown
+	cooldowns := Cooldowns{NewProductAtStore: durationOf(30 * time.Minute)}
+	kept, suppressed = ledger.Filter("sub-1", AlertSet{NewItems: []tracker.InventoryItem{item}, Restocks: []QuantityChange{restock}}, cooldowns, later)
+	if suppressed != 1 || len(kept.NewItems) != 1 || len(kept.Restocks) != 0 {
+		t.Errorf("kept %+v, suppressed %d; want the new item sent and the restock suppressed", kept, suppressed)
+	}
+
+	// A restock above the quantity last sent goes out within the cooldown
+	bigger := QuantityChange{Item: item, OldQuantity: 3, NewQuantity: 6, Delta: 3}
+	smaller := QuantityChange{Item: item, OldQuantity: 3, NewQuantity: 2, Delta: -1}
+	for _, tt := range []struct {
+		change QuantityChange
+		sent   bool
+	}{{bigger, true}, {restock, false}, {smaller, false}} {
+		kept, _ := ledger.Filter("sub-1", AlertSet{Restocks: []QuantityChange{tt.change}}, Cooldowns{}, later)
+		if (len(kept.Restocks) == 1) != tt.sent {
+			t.Errorf("restock to %d: sent %v, want %v", tt.change.NewQuantity, len(kept.Restocks) == 1, tt.sent)
+		}
+	}
+
+	// Recording the bigger restock raises the bar
+	ledger.Record("sub-1", AlertSet{Restocks: []QuantityChange{bigger}}, later)
+	if kept, _ := ledger.Filter("sub-1", AlertSet{Restocks: []QuantityChange{bigger}}, Cooldowns{}, later); len(kept.Restocks) != 0 {
+		t.Error("the same restock was sent twice within its cooldown")
+	}
+}
+
+func TestLedgerPruneAndSave(t *testing.T) {
+	old := time.Date(2025, 12, 1, 10, 0, 0, 0, time.UTC)
+	recent := old.Add(10 * 24 * time.Hour)
+	ledger := newTestLedger(t)
+	ledger.Record("sub-1", AlertSet{NewItems: []tracker.InventoryItem{{ProductID: "a", StoreID: "1"}}}, old)
+	ledger.Record("sub-1", AlertSet{SoldOut: []tracker.InventoryItem{{ProductID: "b", StoreID: "1"}}}, recent)
+
+	if pruned := ledger.Prune(recent.Add(-24 * time.Hour)); pruned != 1 || ledger.Len() != 1 {
+		t.Fatalf("pruned %d, %d left; want 1 and 1", pruned, ledger.Len())
+	}
+	if err := ledger.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadLedger(ledger.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Len() != 1 {
+		t.Fatalf("reloaded %d entries, want 1", reloaded.Len())
+	}
+	kept, suppressed := reloaded.Filter("sub-1", AlertSet{SoldOut: []tracker.InventoryItem{{ProductID: "b", StoreID: "1"}}}, Cooldowns{}, recent.Add(time.Hour))
+	if suppressed != 1 || !kept.IsEmpty() {
+		t.Error("the reloaded ledger doesn't suppress what was sent")
+	}
+}
+
+func durationOf(d time.Duration) *Duration {
+	duration := Duration(d)
+	return &duration
+}
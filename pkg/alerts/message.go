@@ -0,0 +1,215 @@
+package alerts
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+//go:embed templates/*.html templates/*.txt
+var templateFS embed.FS
+
+var (
+	htmlTemplate       = template.Must(template.ParseFS(templateFS, "templates/new_allocations.html"))
+	digestHTMLTemplate = template.Must(template.ParseFS(templateFS, "templates/digest.html"))
+
+	// Plain text must not be HTML-escaped (e.g. "Blanton's")
+	textTemplate       = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/new_allocations.txt"))
+	digestTextTemplate = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/digest.txt"))
+)
+
+// EmailData represents the data passed to email templates
+type EmailData struct {
+	SubscriberID string
+	TotalChanges int
+	NewItems     []tracker.InventoryItem
+	Restocks     []QuantityChange
+	SoldOut      []tracker.InventoryItem
+	Timestamp    string
+	Near         []HomePoint // Subscriber's home points, for Distance
+
+	// Digests only
+	Period string // "Daily", "Hourly", or empty for alerts held over quiet hours
+	Since  string // When the oldest change in the digest was found
+}
+
+// Distance describes how far an item is from the subscriber's nearest home
+// point, or returns "" if they have none
+func (d EmailData) Distance(item tracker.InventoryItem) string {
+	return distanceLabel(d.Near, item)
+}
+
+// Message is one subscriber's alert set rendered for delivery. Email
+// notifiers send the HTML and text bodies; chat notifiers send Summary, which
+// fits in a single chat message.
+type Message struct {
+	Subscriber Subscriber
+	Set        AlertSet
+	Time       time.Time
+	Subject    string
+	HTML       string
+	Text       string
+	ID         string // Idempotency key of the outbox notification, if any
+
+	lines []string // One line per change, for Summary
+}
+
+// NewMessage renders an alert set for a subscriber
+func NewMessage(subscriber Subscriber, set AlertSet, now time.Time) (*Message, error) {
+	data := newEmailData(subscriber, set, now)
+	return render(subscriber, set, now, Subject(set), htmlTemplate, textTemplate, data)
+}
+
+// NewDigest renders alerts held since a time as one digest
+func NewDigest(subscriber Subscriber, set AlertSet, since, now time.Time) (*Message, error) {
+	data := newEmailData(subscriber, set, now)
+	data.Period = subscriber.Delivery.Period()
+	data.Since = since.In(subscriber.Delivery.location()).Format(time.RFC1123)
+	return render(subscriber, set, now, DigestSubject(set, data.Period), digestHTMLTemplate, digestTextTemplate, data)
+}
+
+// newEmailData fills in the template data common to alerts and digests
+func newEmailData(subscriber Subscriber, set AlertSet, now time.Time) EmailData {
+	return EmailData{
+		SubscriberID: subscriber.ID,
+		TotalChanges: set.Total(),
+		NewItems:     set.NewItems,
+		Restocks:     set.Restocks,
+		SoldOut:      set.SoldOut,
+		Timestamp:    now.In(subscriber.Delivery.location()).Format(time.RFC1123),
+		Near:         subscriber.Preferences.Near,
+	}
+}
+
+// render executes a pair of templates into a Message
+func render(subscriber Subscriber, set AlertSet, now time.Time, subject string,
+	htmlTmpl *template.Template, textTmpl *texttemplate.Template, data EmailData) (*Message, error) {
+	var htmlBody bytes.Buffer
+	if err := htmlTmpl.Execute(&htmlBody, data); err != nil {
+		return nil, fmt.Errorf("failed to render HTML template: %w", err)
+	}
+
+	var textBody bytes.Buffer
+	if err := textTmpl.Execute(&textBody, data); err != nil {
+		return nil, fmt.Errorf("failed to render text template: %w", err)
+	}
+
+	return &Message{
+		Subscriber: subscriber,
+		Set:        set,
+		Time:       now,
+		Subject:    subject,
+		HTML:       htmlBody.String(),
+		Text:       textBody.String(),
+		lines:      changeLines(set, subscriber.Preferences.Near),
+	}, nil
+}
+
+// Summary returns the changes as a list of at most limit bytes, one change
+// per line. Changes that don't fit are counted in a final "and N more" line.
+func (m *Message) Summary(limit int) string {
+	var b strings.Builder
+	for i, line := range m.lines {
+		rest := len(m.lines) - i
+
+		// Unless this is the last line, leave room to say how many follow
+		need := len(line)
+		if rest > 1 {
+			need += 1 + len(moreLine(rest-1))
+		}
+		if b.Len()+need > limit {
+			b.WriteString(moreLine(rest))
+			break
+		}
+
+		b.WriteString(line)
+		if rest > 1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func moreLine(n int) string {
+	return fmt.Sprintf("…and %d more", n)
+}
+
+// changeLines describes each change in a set on one line, with the distance
+// from the nearest home point if there are any
+func changeLines(set AlertSet, near []HomePoint) []string {
+	var lines []string
+	for _, item := range set.NewItems {
+		lines = append(lines, fmt.Sprintf("🆕 %s at %s (%d bottle%s%s)",
+			item.ProductName, item.StoreLabel(), item.Quantity, pluralize(item.Quantity), distanceSuffix(near, item)))
+	}
+	for _, change := range set.Restocks {
+		lines = append(lines, fmt.Sprintf("📈 %s at %s (%d → %d bottles%s)",
+			change.Item.ProductName, change.Item.StoreLabel(), change.OldQuantity, change.NewQuantity, distanceSuffix(near, change.Item)))
+	}
+	for _, item := range set.SoldOut {
+		line := fmt.Sprintf("❌ %s sold out at %s", item.ProductName, item.StoreLabel())
+		if distance := distanceLabel(near, item); distance != "" {
+			line += " (" + distance + ")"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// distanceSuffix returns ", <distance>" for an item, or "" if not known
+func distanceSuffix(near []HomePoint, item tracker.InventoryItem) string {
+	if distance := distanceLabel(near, item); distance != "" {
+		return ", " + distance
+	}
+	return ""
+}
+
+// Subject builds the email subject line for an alert set
+func Subject(set AlertSet) string {
+	// Keep the familiar subject when there are only new allocations
+	if len(set.Restocks) == 0 && len(set.SoldOut) == 0 {
+		return fmt.Sprintf("Cask Watch Alert: %d New Allocation Item%s",
+			len(set.NewItems), pluralize(len(set.NewItems)))
+	}
+
+	return "Cask Watch Alert: " + changeCounts(set)
+}
+
+// DigestSubject builds the email subject line for a digest, e.g.
+// "Cask Watch Daily Digest: 3 New, 1 Sold Out"
+func DigestSubject(set AlertSet, period string) string {
+	name := "Cask Watch Digest"
+	if period != "" {
+		name = "Cask Watch " + period + " Digest"
+	}
+	return name + ": " + changeCounts(set)
+}
+
+// changeCounts summarizes a set as e.g. "3 New, 1 Restocked, 1 Sold Out"
+func changeCounts(set AlertSet) string {
+	var parts []string
+	if len(set.NewItems) > 0 {
+		parts = append(parts, fmt.Sprintf("%d New", len(set.NewItems)))
+	}
+	if len(set.Restocks) > 0 {
+		parts = append(parts, fmt.Sprintf("%d Restocked", len(set.Restocks)))
+	}
+	if len(set.SoldOut) > 0 {
+		parts = append(parts, fmt.Sprintf("%d Sold Out", len(set.SoldOut)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pluralize returns "s" if count != 1, otherwise empty string
+func pluralize(count int) string {
+	if count == 1 {
+		return ""
+	}
+	return "s"
+}
@@ -0,0 +1,138 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Notifier delivers a rendered alert to one destination
+type Notifier interface {
+	Notify(ctx context.Context, msg *Message) error
+}
+
+// Ensure every channel type's notifier satisfies the interface
+var (
+	_ Notifier = (*MailgunNotifier)(nil)
+	_ Notifier = (*SMTPNotifier)(nil)
+	_ Notifier = (*WebhookNotifier)(nil)
+	_ Notifier = (*SlackNotifier)(nil)
+	_ Notifier = (*DiscordNotifier)(nil)
+	_ Notifier = (*NtfyNotifier)(nil)
+	_ Notifier = (*TelegramNotifier)(nil)
+)
+
+// defaultNtfyServer is used for ntfy channels without a url
+const defaultNtfyServer = "https://ntfy.sh"
+
+// defaultTelegramTokenEnv holds the bot token for telegram channels without
+// a token_env
+const defaultTelegramTokenEnv = "TELEGRAM_BOT_TOKEN"
+
+// NewNotifier builds the notifier for one of a subscriber's channels. HTTP
+// notifiers share client.
+func NewNotifier(config *Config, subscriber Subscriber, channel Channel, client *http.Client) (Notifier, error) {
+	switch channel.Type {
+	case ChannelEmail:
+		if config.SMTP.Host != "" {
+			return NewSMTPNotifier(config.SMTP, channel.emailTo(subscriber))
+		}
+		return NewMailgunNotifier(config.Mailgun, channel.emailTo(subscriber))
+	case ChannelSMTP:
+		return NewSMTPNotifier(config.SMTP, channel.emailTo(subscriber))
+	case ChannelMailgun:
+		return NewMailgunNotifier(config.Mailgun, channel.emailTo(subscriber))
+
+	case ChannelWebhook:
+		url, err := channel.url()
+		if err != nil {
+			return nil, err
+		}
+		notifier := &WebhookNotifier{URL: url, Client: client}
+		if channel.SecretEnv != "" {
+			if notifier.Secret = os.Getenv(channel.SecretEnv); notifier.Secret == "" {
+				return nil, fmt.Errorf("webhook secret missing (%s is not set)", channel.SecretEnv)
+			}
+		}
+		return notifier, nil
+	case ChannelSlack:
+		url, err := channel.url()
+		if err != nil {
+			return nil, err
+		}
+		return &SlackNotifier{URL: url, Client: client}, nil
+	case ChannelDiscord:
+		url, err := channel.url()
+		if err != nil {
+			return nil, err
+		}
+		return &DiscordNotifier{URL: url, Client: client}, nil
+
+	case ChannelNtfy:
+		server, err := channel.url()
+		if err != nil {
+			server = defaultNtfyServer
+		}
+		notifier := &NtfyNotifier{Server: server, Topic: channel.Topic, Client: client}
+		if channel.TokenEnv != "" {
+			notifier.Token = os.Getenv(channel.TokenEnv)
+		}
+		return notifier, nil
+	case ChannelTelegram:
+		tokenEnv := channel.TokenEnv
+		if tokenEnv == "" {
+			tokenEnv = defaultTelegramTokenEnv
+		}
+		token := os.Getenv(tokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("Telegram bot token missing (%s is not set)", tokenEnv)
+		}
+		// url, if set, points at another Bot API server
+		baseURL, _ := channel.url()
+		return &TelegramNotifier{BaseURL: baseURL, Token: token, ChatID: channel.ChatID, Client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown channel type %q", channel.Type)
+}
+
+// String describes the channel for logs and previews, without secrets
+func (c Channel) String() string {
+	switch c.Type {
+	case ChannelEmail, ChannelSMTP, ChannelMailgun:
+		if c.To != "" {
+			return c.Type + ":" + c.To
+		}
+	case ChannelNtfy:
+		return c.Type + ":" + c.Topic
+	case ChannelTelegram:
+		return c.Type + ":" + c.ChatID
+	}
+	return c.Type
+}
+
+// emailTo returns the channel's email address, defaulting to the subscriber's
+func (c Channel) emailTo(subscriber Subscriber) string {
+	if c.To != "" {
+		return c.To
+	}
+	return subscriber.Email
+}
+
+// url returns the channel's URL, from the config or from url_env
+func (c Channel) url() (string, error) {
+	if c.URL != "" {
+		return c.URL, nil
+	}
+	if c.URLEnv != "" {
+		if url := os.Getenv(c.URLEnv); url != "" {
+			return url, nil
+		}
+		return "", fmt.Errorf("%s channel URL missing (%s is not set)", c.Type, c.URLEnv)
+	}
+	return "", fmt.Errorf("%s channel has no url or url_env", c.Type)
+}
+
+// usesEmail reports whether the channel sends email
+func (c Channel) usesEmail() bool {
+	return c.Type == ChannelEmail || c.Type == ChannelSMTP || c.Type == ChannelMailgun
+}
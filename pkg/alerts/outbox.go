@@ -0,0 +1,404 @@
+package alerts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OutboxEntry is an alert set held for a subscriber until their delivery
+// schedule is due
+type OutboxEntry struct {
+	Subscriber string    `json:"subscriber"`
+	Set        AlertSet  `json:"set"`
+	QueuedAt   time.Time `json:"queued_at"`
+}
+
+// Notification statuses
+const (
+	StatusPending = "pending" // Not attempted yet
+	StatusSent    = "sent"    // Accepted by the channel
+	StatusFailed  = "failed"  // Last attempt failed; retried after NextAttempt
+	StatusDead    = "dead"    // Gave up after the maximum attempts
+)
+
+// Notification is one alert for one of a subscriber's channels. Its ID is
+// sent with every attempt as an idempotency key, so receivers can drop
+// repeats if a send succeeded but wasn't recorded.
+type Notification struct {
+	ID          string    `json:"id"`
+	Subscriber  string    `json:"subscriber"`
+	Channel     Channel   `json:"channel"`
+	Set         AlertSet  `json:"set"`
+	Digest      bool      `json:"digest,omitempty"`
+	Since       time.Time `json:"since,omitempty"` // Digests: when the oldest change was queued
+	CreatedAt   time.Time `json:"created_at"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	SentAt      time.Time `json:"sent_at,omitempty"`
+}
+
+// Retry defaults
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = 5 * time.Minute
+	DefaultMaxBackoff     = 6 * time.Hour
+)
+
+// Backoff returns how long to wait after the given number of failed attempts
+func (r RetryConfig) Backoff(attempts int) time.Duration {
+	backoff := time.Duration(r.InitialBackoff)
+	if backoff <= 0 {
+		backoff = DefaultInitialBackoff
+	}
+	limit := time.Duration(r.MaxBackoff)
+	if limit <= 0 {
+		limit = DefaultMaxBackoff
+	}
+	for i := 1; i < attempts && backoff < limit; i++ {
+		backoff *= 2
+	}
+	if backoff > limit {
+		backoff = limit
+	}
+	return backoff
+}
+
+// attempts returns the maximum number of attempts
+func (r RetryConfig) attempts() int {
+	if r.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return r.MaxAttempts
+}
+
+// sentRetention is how long sent notifications are kept for reporting
+const sentRetention = 7 * 24 * time.Hour
+
+// outboxFile is the on-disk outbox format
+type outboxFile struct {
+	Version       int            `json:"version"`
+	Entries       []OutboxEntry  `json:"entries"` // Held for delivery schedules
+	Notifications []Notification `json:"notifications"`
+}
+
+// outboxVersion is the outbox file format version. Version 1 files only
+// held entries.
+const outboxVersion = 2
+
+// Outbox holds alerts that haven't been delivered yet, across runs: alert
+// sets waiting for a subscriber's digest or quiet hours to end, then one
+// notification per channel until it is sent or given up on
+type Outbox struct {
+	path          string // Empty to keep the outbox in memory only
+	entries       []OutboxEntry
+	notifications []Notification
+}
+
+// LoadOutbox reads an outbox file. A missing file yields an empty outbox,
+// which Save creates. An empty path gives an outbox that is never saved.
+func LoadOutbox(path string) (*Outbox, error) {
+	outbox := &Outbox{path: path}
+	if path == "" {
+		return outbox, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return outbox, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file outboxFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse outbox %s: %w", path, err)
+	}
+	if file.Version > outboxVersion {
+		return nil, fmt.Errorf("outbox %s has version %d; this build reads up to %d", path, file.Version, outboxVersion)
+	}
+	outbox.entries = file.Entries
+	outbox.notifications = file.Notifications
+	return outbox, nil
+}
+
+// Add holds an alert set for a subscriber
+func (o *Outbox) Add(subscriberID string, set AlertSet, now time.Time) {
+	o.entries = append(o.entries, OutboxEntry{Subscriber: subscriberID, Set: set, QueuedAt: now})
+}
+
+// Pending returns a subscriber's held entries, oldest first
+func (o *Outbox) Pending(subscriberID string) []OutboxEntry {
+	var pending []OutboxEntry
+	for _, entry := range o.entries {
+		if entry.Subscriber == subscriberID {
+			pending = append(pending, entry)
+		}
+	}
+	return pending
+}
+
+// Release replaces a subscriber's held entries with a notification of set
+// for each of their channels
+func (o *Outbox) Release(sub Subscriber, set AlertSet, digest bool, since, now time.Time) {
+	o.removeEntries(func(entry OutboxEntry) bool { return entry.Subscriber == sub.ID })
+	for i, channel := range sub.AlertChannels() {
+		o.notifications = append(o.notifications, Notification{
+			ID:          notificationID(sub.ID, i, channel, set, now),
+			Subscriber:  sub.ID,
+			Channel:     channel,
+			Set:         set,
+			Digest:      digest,
+			Since:       since,
+			CreatedAt:   now,
+			Status:      StatusPending,
+			NextAttempt: now,
+		})
+	}
+}
+
+// Due returns the notifications to attempt at now: pending ones, and failed
+// ones whose backoff has passed. They point into the outbox, so marking them
+// updates it.
+func (o *Outbox) Due(now time.Time) []*Notification {
+	var due []*Notification
+	for i := range o.notifications {
+		n := &o.notifications[i]
+		if (n.Status == StatusPending || n.Status == StatusFailed) && !now.Before(n.NextAttempt) {
+			due = append(due, n)
+		}
+	}
+	return due
+}
+
+// MarkSent records a successful attempt
+func (n *Notification) MarkSent(now time.Time) {
+	n.Attempts++
+	n.Status = StatusSent
+	n.SentAt = now
+	n.NextAttempt = time.Time{}
+	n.LastError = ""
+}
+
+// MarkFailed records a failed attempt, scheduling a retry with exponential
+// backoff or giving up once the attempts are used up. It reports whether
+// the notification was dead-lettered.
+func (n *Notification) MarkFailed(err error, retry RetryConfig, now time.Time) bool {
+	n.Attempts++
+	n.LastError = err.Error()
+	if n.Attempts >= retry.attempts() {
+		n.Status = StatusDead
+		n.NextAttempt = time.Time{}
+		return true
+	}
+	n.Status = StatusFailed
+	n.NextAttempt = now.Add(retry.Backoff(n.Attempts))
+	return false
+}
+
+// Notifications returns a copy of every notification, oldest first
+func (o *Outbox) Notifications() []Notification {
+	return append([]Notification(nil), o.notifications...)
+}
+
+// Find returns the notification whose ID starts with prefix
+func (o *Outbox) Find(prefix string) (*Notification, error) {
+	var found *Notification
+	for i := range o.notifications {
+		if strings.HasPrefix(o.notifications[i].ID, prefix) {
+			if found != nil {
+				return nil, fmt.Errorf("notification ID %q is ambiguous", prefix)
+			}
+			found = &o.notifications[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no notification with ID %q", prefix)
+	}
+	return found, nil
+}
+
+// Requeue makes a failed or dead notification due again with its attempts
+// reset, keeping its ID so receivers still see the same idempotency key
+func (n *Notification) Requeue(now time.Time) error {
+	if n.Status != StatusFailed && n.Status != StatusDead {
+		return fmt.Errorf("notification %s is %s", n.ID, n.Status)
+	}
+	n.Status = StatusPending
+	n.Attempts = 0
+	n.NextAttempt = now
+	return nil
+}
+
+// Counts returns the number of notifications in each status
+func (o *Outbox) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, n := range o.notifications {
+		counts[n.Status]++
+	}
+	return counts
+}
+
+// Retain drops held entries and undelivered notifications for subscribers
+// not in keep, such as ones removed or disabled since their alerts were
+// queued. It returns the number dropped.
+func (o *Outbox) Retain(keep []Subscriber) int {
+	ids := make(map[string]bool, len(keep))
+	for _, sub := range keep {
+		ids[sub.ID] = true
+	}
+	dropped := o.removeEntries(func(entry OutboxEntry) bool { return !ids[entry.Subscriber] })
+	dropped += o.removeNotifications(func(n Notification) bool {
+		return !ids[n.Subscriber] && (n.Status == StatusPending || n.Status == StatusFailed)
+	})
+	return dropped
+}
+
+// Prune drops notifications sent more than a week before now
+func (o *Outbox) Prune(now time.Time) int {
+	return o.removeNotifications(func(n Notification) bool {
+		return n.Status == StatusSent && now.Sub(n.SentAt) > sentRetention
+	})
+}
+
+// Held returns the number of alert sets held for delivery schedules
+func (o *Outbox) Held() int {
+	return len(o.entries)
+}
+
+// Len returns the number of held entries and unsent notifications
+func (o *Outbox) Len() int {
+	count := len(o.entries)
+	for _, n := range o.notifications {
+		if n.Status == StatusPending || n.Status == StatusFailed {
+			count++
+		}
+	}
+	return count
+}
+
+// removeEntries drops the held entries drop matches, returning how many
+func (o *Outbox) removeEntries(drop func(OutboxEntry) bool) int {
+	kept := o.entries[:0]
+	for _, entry := range o.entries {
+		if !drop(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	removed := len(o.entries) - len(kept)
+	o.entries = kept
+	return removed
+}
+
+// removeNotifications drops the notifications drop matches, returning how
+// many
+func (o *Outbox) removeNotifications(drop func(Notification) bool) int {
+	kept := o.notifications[:0]
+	for _, n := range o.notifications {
+		if !drop(n) {
+			kept = append(kept, n)
+		}
+	}
+	removed := len(o.notifications) - len(kept)
+	o.notifications = kept
+	return removed
+}
+
+// Save writes the outbox atomically. In-memory outboxes aren't written.
+func (o *Outbox) Save() error {
+	if o.path == "" {
+		return nil
+	}
+
+	file := outboxFile{Version: outboxVersion, Entries: o.entries, Notifications: o.notifications}
+	if file.Entries == nil {
+		file.Entries = []OutboxEntry{}
+	}
+	if file.Notifications == nil {
+		file.Notifications = []Notification{}
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	tmp, err := os.CreateTemp(filepath.Dir(o.path), "."+filepath.Base(o.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), o.path)
+}
+
+// notificationID derives a notification's idempotency key from what it sends
+// and where, and when it was created
+func notificationID(subscriberID string, index int, channel Channel, set AlertSet, now time.Time) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%d\x00%s\x00%s\x00", subscriberID, index, channel.Type, now.Format(time.RFC3339Nano))
+	json.NewEncoder(hash).Encode(set)
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// MergeAlertSets combines alert sets queued over time into one. A product at
+// a store appears once per kind of change: the latest new or sold-out item,
+// and one restock from the earliest old quantity to the latest new one.
+func MergeAlertSets(sets []AlertSet) AlertSet {
+	var merged AlertSet
+	newIndex := make(map[string]int)
+	restockIndex := make(map[string]int)
+	soldOutIndex := make(map[string]int)
+
+	for _, set := range sets {
+		for _, item := range set.NewItems {
+			key := makeInventoryKey(item.ProductID, item.StoreID)
+			if i, ok := newIndex[key]; ok {
+				merged.NewItems[i] = item
+				continue
+			}
+			newIndex[key] = len(merged.NewItems)
+			merged.NewItems = append(merged.NewItems, item)
+		}
+		for _, change := range set.Restocks {
+			key := makeInventoryKey(change.Item.ProductID, change.Item.StoreID)
+			if i, ok := restockIndex[key]; ok {
+				change.OldQuantity = merged.Restocks[i].OldQuantity
+				change.Delta = change.NewQuantity - change.OldQuantity
+				merged.Restocks[i] = change
+				continue
+			}
+			restockIndex[key] = len(merged.Restocks)
+			merged.Restocks = append(merged.Restocks, change)
+		}
+		for _, item := range set.SoldOut {
+			key := makeInventoryKey(item.ProductID, item.StoreID)
+			if i, ok := soldOutIndex[key]; ok {
+				merged.SoldOut[i] = item
+				continue
+			}
+			soldOutIndex[key] = len(merged.SoldOut)
+			merged.SoldOut = append(merged.SoldOut, item)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,215 @@
+package alerts
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		retry    RetryConfig
+		attempts int
+		want     time.Duration
+	}{
+		{"default first", RetryConfig{}, 1, 5 * time.Minute},
+		{"default doubles", RetryConfig{}, 3, 20 * time.Minute},
+		{"default cap", RetryConfig{}, 20, 6 * time.Hour},
+		{"configured", RetryConfig{InitialBackoff: Duration(time.Minute), MaxBackoff: Duration(3 * time.Minute)}, 2, 2 * time.Minute},
+		{"configured cap", RetryConfig{InitialBackoff: Duration(time.Minute), MaxBackoff: Duration(3 * time.Minute)}, 3, 3 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := tt.retry.Backoff(tt.attempts); got != tt.want {
+			t.Errorf("%s: Backoff(%d) = %s, want %s", tt.name, tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestMarkFailed(t *testing.T) {
+	retry := RetryConfig{MaxAttempts: 3, InitialBackoff: Duration(time.Minute)}
+	now := time.Date(2025, 12, 13, 10, 0, 0, 0, time.UTC)
+	n := &Notification{ID: "n1", Status: StatusPending, NextAttempt: now}
+
+	for attempt, wantWait := range []time.Duration{time.Minute, 2 * time.Minute} {
+		if dead := n.MarkFailed(errors.New("timeout"), retry, now); dead {
+			t.Fatalf("attempt %d dead-lettered; max is 3", attempt+1)
+		}
+		if n.Status != StatusFailed || n.Attempts != attempt+1 || n.LastError != "timeout" {
+			t.Errorf("attempt %d: status %s, attempts %d, error %q", attempt+1, n.Status, n.Attempts, n.LastError)
+		}
+		if got := n.NextAttempt.Sub(now); got != wantWait {
+			t.Errorf("attempt %d: retry after %s, want %s", attempt+1, got, wantWait)
+		}
+	}
+
+	if dead := n.MarkFailed(errors.New("timeout"), retry, now); !dead {
+		t.Fatal("third failure wasn't dead-lettered")
+	}
+	if n.Status != StatusDead || !n.NextAttempt.IsZero() {
+		t.Errorf("status %s, next attempt %s; want dead with no retry", n.Status, n.NextAttempt)
+	}
+
+	outbox := &Outbox{notifications: []Notification{*n}}
+	if due := outbox.Due(now.Add(24 * time.Hour)); len(due) != 0 {
+		t.Errorf("dead notification is due: %v", due)
+	}
+}
+
+func TestRequeue(t *testing.T) {
+	now := time.Date(2025, 12, 13, 10, 0, 0, 0, time.UTC)
+	outbox := &Outbox{notifications: []Notification{
+		{ID: "aaa111", Status: StatusDead, Attempts: 5, LastError: "gone"},
+		{ID: "bbb222", Status: StatusSent, Attempts: 1, SentAt: now},
+	}}
+
+	n, err := outbox.Find("aaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Requeue(now); err != nil {
+		t.Fatal(err)
+	}
+	due := outbox.Due(now)
+	if len(due) != 1 || due[0].ID != "aaa111" || due[0].Attempts != 0 || due[0].Status != StatusPending {
+		t.Errorf("due after requeue = %+v, want aaa111 pending with no attempts", due)
+	}
+
+	sent, err := outbox.Find("bbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sent.Requeue(now); err == nil {
+		t.Error("Requeue accepted a sent notification")
+	}
+	if _, err := outbox.Find(""); err == nil {
+		t.Error("Find accepted an ambiguous prefix")
+	}
+}
+
+func TestRetain(t *testing.T) {
+	outbox := &Outbox{
+		entries: []OutboxEntry{{Subscriber: "kept"}, {Subscriber: "gone"}},
+		notifications: []Notification{
+			{ID: "1", Subscriber: "kept", Status: StatusPending},
+			{ID: "2", Subscriber: "gone", Status: StatusPending},
+			{ID: "3", Subscriber: "gone", Status: StatusFailed},
+			{ID: "4", Subscriber: "gone", Status: StatusSent},
+			{ID: "5", Subscriber: "gone", Status: StatusDead},
+		},
+	}
+
+	if dropped := outbox.Retain([]Subscriber{{ID: "kept"}}); dropped != 3 {
+		t.Errorf("Retain dropped %d, want 3", dropped)
+	}
+	if len(outbox.Pending("gone")) != 0 || len(outbox.Pending("kept")) != 1 {
+		t.Errorf("entries = %+v, want only kept's", outbox.entries)
+	}
+	var ids []string
+	for _, n := range outbox.Notifications() {
+		ids = append(ids, n.ID)
+	}
+	// Sent and dead notifications stay for reporting
+	if want := []string{"1", "4", "5"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("notifications = %v, want %v", ids, want)
+	}
+}
+
+func TestMergeAlertSets(t *testing.T) {
+	item := func(product, store string, quantity int) tracker.InventoryItem {
+		return tracker.InventoryItem{ProductID: product, StoreID: store, Quantity: quantity}
+	}
+	restock := func(product, store string, old, new int) QuantityChange {
+		return QuantityChange{Item: item(product, store, new), OldQuantity: old, NewQuantity: new, Delta: new - old}
+	}
+
+	merged := MergeAlertSets([]AlertSet{
+		{
+			NewItems: []tracker.InventoryItem{item("p1", "s1", 2), item("p2", "s1", 1)},
+			Restocks: []QuantityChange{restock("p3", "s1", 1, 4)},
+			SoldOut:  []tracker.InventoryItem{item("p4", "s1", 0)},
+		},
+		{
+			NewItems: []tracker.InventoryItem{item("p1", "s1", 5)},
+			Restocks: []QuantityChange{restock("p3", "s1", 2, 9), restock("p3", "s2", 0, 3)},
+			SoldOut:  []tracker.InventoryItem{item("p4", "s1", 0)},
+		},
+	})
+
+	want := AlertSet{
+		NewItems: []tracker.InventoryItem{item("p1", "s1", 5), item("p2", "s1", 1)},
+		Restocks: []QuantityChange{restock("p3", "s1", 1, 9), restock("p3", "s2", 0, 3)},
+		SoldOut:  []tracker.InventoryItem{item("p4", "s1", 0)},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("MergeAlertSets =\n%+v\nwant\n%+v", merged, want)
+	}
+}
+
+func TestRunSavesOutboxBeforeSending(t *testing.T) {
+	dir := t.TempDir()
+	outboxPath := filepath.Join(dir, "outbox.json")
+	ledgerPath := filepath.Join(dir, "ledger.json")
+
+	// Each request sees what a crash at that moment would leave on disk
+	type onDisk struct {
+		statuses []string
+		ledger   int
+	}
+	var seen []onDisk
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var state onDisk
+		if outbox, err := LoadOutbox(outboxPath); err == nil {
+			for _, n := range outbox.Notifications() {
+				state.statuses = append(state.statuses, n.Status)
+			}
+		}
+		if ledger, err := LoadLedger(ledgerPath); err == nil {
+			state.ledger = ledger.Len()
+		}
+		seen = append(seen, state)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	outbox, err := LoadOutbox(outboxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger, err := LoadLedger(ledgerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{Subscribers: []Subscriber{{
+		ID:       "sub-1",
+		Email:    "sub@example.com",
+		Enabled:  true,
+		Channels: []Channel{{Type: ChannelWebhook, URL: server.URL + "/a"}, {Type: ChannelWebhook, URL: server.URL + "/b"}},
+	}}}
+	a := NewAlerter(config, false, io.Discard)
+	a.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	a.Outbox = outbox
+	a.Ledger = ledger
+
+	changes := &ComparisonResult{NewItems: []tracker.InventoryItem{{ProductID: "016850", StoreID: "247", Quantity: 3, State: "VA"}}}
+	if err := a.Run(changes); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []onDisk{
+		{statuses: []string{StatusPending, StatusPending}},
+		{statuses: []string{StatusSent, StatusPending}, ledger: 1},
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("saved state at each send = %+v, want %+v", seen, want)
+	}
+}
@@ -0,0 +1,122 @@
+package alerts
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultDigestAt is when daily digests go out if digest_at isn't set
+const defaultDigestAt = "08:00"
+
+// Due reports whether a subscriber's held alerts should be sent at now.
+// since is when the oldest of them was queued. Hourly digests go out an hour
+// after that; daily ones at the first digest time after it.
+func (d Delivery) Due(now, since time.Time) bool {
+	if d.Quiet(now) {
+		return false
+	}
+
+	switch d.Mode {
+	case DeliveryHourly:
+		return now.Sub(since) >= time.Hour
+	case DeliveryDaily:
+		// The most recent digest time at or before now
+		minutes, _ := parseClock(d.digestAt())
+		local := now.In(d.location())
+		last := time.Date(local.Year(), local.Month(), local.Day(), minutes/60, minutes%60, 0, 0, local.Location())
+		if local.Before(last) {
+			last = last.AddDate(0, 0, -1)
+		}
+		return since.Before(last)
+	}
+	return true
+}
+
+// Quiet reports whether t falls within the subscriber's quiet hours
+func (d Delivery) Quiet(t time.Time) bool {
+	if d.QuietHours == nil {
+		return false
+	}
+	start, err := parseClock(d.QuietHours.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(d.QuietHours.End)
+	if err != nil {
+		return false
+	}
+
+	local := t.In(d.location())
+	minute := local.Hour()*60 + local.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end // Spans midnight
+}
+
+// Period names the digest schedule for subjects and templates, e.g. "Daily"
+func (d Delivery) Period() string {
+	switch d.Mode {
+	case DeliveryHourly:
+		return "Hourly"
+	case DeliveryDaily:
+		return "Daily"
+	}
+	return ""
+}
+
+// validate checks the mode, times and time zone
+func (d Delivery) validate() error {
+	switch d.Mode {
+	case "", DeliveryInstant, DeliveryHourly, DeliveryDaily:
+	default:
+		return fmt.Errorf("invalid mode: %s (must be instant, hourly or daily)", d.Mode)
+	}
+	if _, err := parseClock(d.digestAt()); err != nil {
+		return fmt.Errorf("invalid digest_at: %w", err)
+	}
+	if d.Timezone != "" {
+		if _, err := time.LoadLocation(d.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+	if d.QuietHours != nil {
+		if _, err := parseClock(d.QuietHours.Start); err != nil {
+			return fmt.Errorf("invalid quiet_hours.start: %w", err)
+		}
+		if _, err := parseClock(d.QuietHours.End); err != nil {
+			return fmt.Errorf("invalid quiet_hours.end: %w", err)
+		}
+	}
+	return nil
+}
+
+// digestAt returns the daily digest time, defaulting to 08:00
+func (d Delivery) digestAt() string {
+	if d.DigestAt == "" {
+		return defaultDigestAt
+	}
+	return d.DigestAt
+}
+
+// location returns the subscriber's time zone. Unknown zones are rejected
+// when the config loads, so UTC is only a fallback.
+func (d Delivery) location() *time.Location {
+	if d.Timezone == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
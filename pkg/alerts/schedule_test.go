@@ -0,0 +1,104 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // The tests use America/New_York
+)
+
+// utc returns a UTC time on the given day
+func utc(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestDeliveryQuiet(t *testing.T) {
+	overnight := Delivery{Timezone: "America/New_York", QuietHours: &QuietHours{Start: "22:00", End: "07:00"}}
+	daytime := Delivery{QuietHours: &QuietHours{Start: "09:00", End: "17:00"}}
+
+	tests := []struct {
+		name     string
+		delivery Delivery
+		at       time.Time
+		want     bool
+	}{
+		{"before the window", overnight, utc(2025, 7, 1, 1, 59), false},       // 21:59 EDT
+		{"window starts", overnight, utc(2025, 7, 1, 2, 0), true},             // 22:00 EDT
+		{"after midnight", overnight, utc(2025, 7, 1, 8, 30), true},           // 04:30 EDT
+		{"window ends", overnight, utc(2025, 7, 1, 11, 0), false},             // 07:00 EDT
+		{"winter offset", overnight, utc(2025, 1, 15, 11, 30), true},          // 06:30 EST
+		{"summer offset", overnight, utc(2025, 7, 15, 11, 30), false},         // 07:30 EDT
+		{"fall back, still quiet", overnight, utc(2025, 11, 2, 11, 30), true}, // 06:30 EST
+		{"fall back, window ends", overnight, utc(2025, 11, 2, 12, 0), false}, // 07:00 EST
+		{"spring forward, quiet", overnight, utc(2025, 3, 9, 10, 59), true},   // 06:59 EDT
+		{"spring forward, ends", overnight, utc(2025, 3, 9, 11, 0), false},    // 07:00 EDT
+		{"same-day window", daytime, utc(2025, 7, 1, 12, 0), true},
+		{"same-day window ends", daytime, utc(2025, 7, 1, 17, 0), false},
+		{"no quiet hours", Delivery{}, utc(2025, 7, 1, 3, 0), false},
+		{"unparseable window", Delivery{QuietHours: &QuietHours{Start: "late", End: "07:00"}}, utc(2025, 7, 1, 3, 0), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.delivery.Quiet(tt.at); got != tt.want {
+			t.Errorf("%s: Quiet(%s) = %v, want %v", tt.name, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestDeliveryDue(t *testing.T) {
+	hourly := Delivery{Mode: DeliveryHourly}
+	daily := Delivery{Mode: DeliveryDaily, Timezone: "America/New_York"} // 08:00 local
+	evening := Delivery{Mode: DeliveryDaily, DigestAt: "18:30"}
+	quietHourly := Delivery{Mode: DeliveryHourly, Timezone: "America/New_York", QuietHours: &QuietHours{Start: "22:00", End: "07:00"}}
+
+	tests := []struct {
+		name       string
+		delivery   Delivery
+		since, now time.Time
+		want       bool
+	}{
+		{"instant", Delivery{}, utc(2025, 7, 1, 10, 0), utc(2025, 7, 1, 10, 0), true},
+		{"hourly, too soon", hourly, utc(2025, 7, 1, 10, 0), utc(2025, 7, 1, 10, 59), false},
+		{"hourly, an hour later", hourly, utc(2025, 7, 1, 10, 0), utc(2025, 7, 1, 11, 0), true},
+		{"hourly, held over quiet hours", quietHourly, utc(2025, 7, 1, 2, 0), utc(2025, 7, 1, 10, 59), false}, // 06:59 EDT
+		{"hourly, quiet hours end", quietHourly, utc(2025, 7, 1, 2, 0), utc(2025, 7, 1, 11, 0), true},
+
+		{"daily, before digest time", daily, utc(2025, 7, 1, 2, 0), utc(2025, 7, 1, 11, 59), false}, // 07:59 EDT
+		{"daily, at digest time", daily, utc(2025, 7, 1, 2, 0), utc(2025, 7, 1, 12, 0), true},       // 08:00 EDT
+		{"daily, queued after today's digest", daily, utc(2025, 7, 1, 12, 30), utc(2025, 7, 1, 20, 0), false},
+		{"daily, next day", daily, utc(2025, 7, 1, 12, 30), utc(2025, 7, 2, 12, 0), true},
+		{"daily, winter offset", daily, utc(2025, 1, 15, 2, 0), utc(2025, 1, 15, 12, 0), false},  // 07:00 EST
+		{"daily, winter digest", daily, utc(2025, 1, 15, 2, 0), utc(2025, 1, 15, 13, 0), true},   // 08:00 EST
+		{"daily, spring forward", daily, utc(2025, 3, 8, 14, 0), utc(2025, 3, 9, 11, 59), false}, // 07:59 EDT
+		{"daily, spring forward digest", daily, utc(2025, 3, 8, 14, 0), utc(2025, 3, 9, 12, 0), true},
+		{"daily, fall back", daily, utc(2025, 11, 1, 13, 0), utc(2025, 11, 2, 12, 59), false}, // 07:59 EST
+		{"daily, fall back digest", daily, utc(2025, 11, 1, 13, 0), utc(2025, 11, 2, 13, 0), true},
+		{"daily in UTC", evening, utc(2025, 7, 1, 9, 0), utc(2025, 7, 1, 18, 30), true},
+		{"daily in UTC, early", evening, utc(2025, 7, 1, 9, 0), utc(2025, 7, 1, 18, 29), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.delivery.Due(tt.now, tt.since); got != tt.want {
+			t.Errorf("%s: Due(%s, since %s) = %v, want %v", tt.name, tt.now, tt.since, got, tt.want)
+		}
+	}
+}
+
+func TestDeliveryValidate(t *testing.T) {
+	tests := []struct {
+		delivery Delivery
+		valid    bool
+	}{
+		{Delivery{}, true},
+		{Delivery{Mode: DeliveryDaily, DigestAt: "07:15", Timezone: "America/New_York"}, true},
+		{Delivery{Mode: "weekly"}, false},
+		{Delivery{Mode: DeliveryDaily, DigestAt: "7am"}, false},
+		{Delivery{Timezone: "Mars/Olympus_Mons"}, false},
+		{Delivery{QuietHours: &QuietHours{Start: "22:00", End: "25:00"}}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.delivery.validate(); (err == nil) != tt.valid {
+			t.Errorf("validate(%+v) = %v, want valid %v", tt.delivery, err, tt.valid)
+		}
+	}
+}
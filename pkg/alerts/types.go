@@ -4,19 +4,34 @@ import (
 	"github.com/jeffspahr/bourbontracker/pkg/tracker"
 )
 
+// Snapshot is an inventory file together with what it actually covered
+type Snapshot struct {
+	Items    []tracker.InventoryItem
+	Coverage *tracker.Coverage // nil when unknown; treated as covering everything
+}
+
 // ComparisonResult holds detected changes between inventory snapshots
 type ComparisonResult struct {
 	NewItems        []tracker.InventoryItem // Product appeared at store for first time
 	RemovedItems    []tracker.InventoryItem // Product disappeared from store
 	QuantityChanges []QuantityChange        // Quantity increased/decreased
+	Uncovered       []tracker.InventoryItem // Not compared: pair wasn't scanned in both runs
+}
+
+// Merge appends the changes from other into r
+func (r *ComparisonResult) Merge(other *ComparisonResult) {
+	r.NewItems = append(r.NewItems, other.NewItems...)
+	r.RemovedItems = append(r.RemovedItems, other.RemovedItems...)
+	r.QuantityChanges = append(r.QuantityChanges, other.QuantityChanges...)
+	r.Uncovered = append(r.Uncovered, other.Uncovered...)
 }
 
 // QuantityChange represents a change in quantity for an existing product-store combination
 type QuantityChange struct {
-	Item        tracker.InventoryItem
-	OldQuantity int
-	NewQuantity int
-	Delta       int // NewQuantity - OldQuantity
+	Item        tracker.InventoryItem `json:"item"`
+	OldQuantity int                   `json:"old_quantity"`
+	NewQuantity int                   `json:"new_quantity"`
+	Delta       int                   `json:"delta"` // NewQuantity - OldQuantity
 }
 
 // Subscriber represents a user subscription configuration
@@ -25,6 +40,67 @@ type Subscriber struct {
 	Email       string      `json:"email"`
 	Enabled     bool        `json:"enabled"`
 	Preferences Preferences `json:"preferences"`
+	Channels    []Channel   `json:"channels"` // Where alerts go (default: email to Email)
+	Delivery    Delivery    `json:"delivery"` // When alerts go (default: instantly)
+}
+
+// Delivery modes
+const (
+	DeliveryInstant = "instant" // Whenever changes are found
+	DeliveryHourly  = "hourly"  // At most one digest an hour
+	DeliveryDaily   = "daily"   // One digest a day, at DigestAt
+)
+
+// Delivery is when a subscriber's alerts are sent. Alerts held back by a
+// digest schedule or quiet hours wait in the outbox and are sent together as
+// one digest.
+type Delivery struct {
+	Mode       string      `json:"mode,omitempty"`        // instant (default), hourly or daily
+	DigestAt   string      `json:"digest_at,omitempty"`   // Local "HH:MM" for daily digests (default 08:00)
+	Timezone   string      `json:"timezone,omitempty"`    // IANA name, e.g. America/New_York (default UTC)
+	QuietHours *QuietHours `json:"quiet_hours,omitempty"` // Local times when nothing is sent
+}
+
+// QuietHours is a daily window in the subscriber's time zone. If End is
+// before Start the window spans midnight.
+type QuietHours struct {
+	Start string `json:"start"` // "HH:MM"
+	End   string `json:"end"`   // "HH:MM"
+}
+
+// Notification channel types
+const (
+	ChannelEmail    = "email"    // SMTP if configured, otherwise Mailgun
+	ChannelSMTP     = "smtp"     // Generic SMTP server
+	ChannelMailgun  = "mailgun"  // Mailgun API
+	ChannelWebhook  = "webhook"  // Signed JSON POST
+	ChannelSlack    = "slack"    // Slack incoming webhook
+	ChannelDiscord  = "discord"  // Discord incoming webhook
+	ChannelNtfy     = "ntfy"     // ntfy topic
+	ChannelTelegram = "telegram" // Telegram bot API
+)
+
+// Channel is one destination for a subscriber's alerts. Which fields apply
+// depends on Type. Secrets (webhook URLs, signing secrets, tokens) can be
+// given through environment variables instead of the config file.
+type Channel struct {
+	Type      string `json:"type"`
+	To        string `json:"to,omitempty"`         // Email address (email, smtp, mailgun; default: subscriber email)
+	URL       string `json:"url,omitempty"`        // Webhook URL (webhook, slack, discord) or server (ntfy, default https://ntfy.sh; telegram, default https://api.telegram.org)
+	URLEnv    string `json:"url_env,omitempty"`    // Environment variable holding URL
+	SecretEnv string `json:"secret_env,omitempty"` // Environment variable holding the webhook signing secret
+	Topic     string `json:"topic,omitempty"`      // ntfy topic
+	TokenEnv  string `json:"token_env,omitempty"`  // Environment variable holding the ntfy access token or Telegram bot token (default TELEGRAM_BOT_TOKEN)
+	ChatID    string `json:"chat_id,omitempty"`    // Telegram chat ID
+}
+
+// AlertChannels returns the subscriber's channels, or an email channel if
+// none are configured
+func (s Subscriber) AlertChannels() []Channel {
+	if len(s.Channels) == 0 {
+		return []Channel{{Type: ChannelEmail}}
+	}
+	return s.Channels
 }
 
 // Preferences defines user filtering preferences
@@ -36,24 +112,80 @@ type Preferences struct {
 	ProductIDs   []string `json:"product_ids"`   // Explicit product code filters
 	MinQuantity  int      `json:"min_quantity"`  // Minimum quantity to trigger alert
 	AlertOn      AlertOn  `json:"alert_on"`      // What changes trigger alerts
+
+	// Items must be within a home point's radius or inside the polygon, if
+	// either is given. Alerts show distance to the nearest home point.
+	Near    []HomePoint        `json:"near,omitempty"`
+	Polygon []tracker.Location `json:"polygon,omitempty"` // Vertices in order; the last joins the first
+}
+
+// HomePoint is a place a subscriber wants alerts around
+type HomePoint struct {
+	Name string `json:"name,omitempty"` // e.g. "Home", shown next to distances
+	tracker.Location
+	RadiusMiles float64 `json:"radius_miles"` // Default 25
 }
 
-// AlertOn defines what types of changes trigger alerts
+// AlertOn defines what types of changes trigger alerts.
+// If none are enabled, NewProductAtStore is assumed.
 type AlertOn struct {
 	NewProductAtStore bool `json:"new_product_at_store"` // Alert when product appears at new store
 	QuantityIncrease  bool `json:"quantity_increase"`    // Alert when quantity increases
+	MinIncrease       int  `json:"min_increase"`         // Minimum increase that counts as a restock (default 1)
+	SoldOut           bool `json:"sold_out"`             // Alert when product disappears from store
+}
+
+// AlertSet holds the changes a single subscriber should be alerted about
+type AlertSet struct {
+	NewItems []tracker.InventoryItem `json:"new_items,omitempty"` // Product appeared at store
+	Restocks []QuantityChange        `json:"restocks,omitempty"`  // Quantity increased at store
+	SoldOut  []tracker.InventoryItem `json:"sold_out,omitempty"`  // Product disappeared from store
+}
+
+// Total returns the number of changes in the set
+func (s AlertSet) Total() int {
+	return len(s.NewItems) + len(s.Restocks) + len(s.SoldOut)
+}
+
+// IsEmpty reports whether the set has nothing to send
+func (s AlertSet) IsEmpty() bool {
+	return s.Total() == 0
 }
 
 // Config represents the top-level subscriptions configuration
 type Config struct {
 	Version     string        `json:"version"`
 	Mailgun     MailgunConfig `json:"mailgun"`
+	SMTP        SMTPConfig    `json:"smtp"`
+	Cooldowns   Cooldowns     `json:"cooldowns"` // Used with an alert ledger
+	Retry       RetryConfig   `json:"retry"`     // Used with an outbox
 	Subscribers []Subscriber  `json:"subscribers"`
 }
 
-// MailgunConfig holds Mailgun API configuration
+// RetryConfig controls how failed notifications in the outbox are retried.
+// The wait doubles after each failed attempt, up to MaxBackoff.
+type RetryConfig struct {
+	MaxAttempts    int      `json:"max_attempts,omitempty"`    // Attempts before giving up (default 5)
+	InitialBackoff Duration `json:"initial_backoff,omitempty"` // Wait after the first failure (default 5m)
+	MaxBackoff     Duration `json:"max_backoff,omitempty"`     // Longest wait (default 6h)
+}
+
+// MailgunConfig holds Mailgun API configuration. The domain and API key come
+// from MAILGUN_DOMAIN and MAILGUN_API_KEY.
 type MailgunConfig struct {
 	Enabled   bool   `json:"enabled"`
 	FromEmail string `json:"from_email"`
 	FromName  string `json:"from_name"`
+	APIBase   string `json:"api_base,omitempty"` // Override the API URL (e.g. the EU region)
+}
+
+// SMTPConfig holds SMTP server configuration. The password comes from
+// SMTP_PASSWORD. Email channels use SMTP instead of Mailgun when Host is set.
+type SMTPConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Host      string `json:"host"`
+	Port      int    `json:"port"` // Default 587; 465 uses implicit TLS
+	Username  string `json:"username"`
+	FromEmail string `json:"from_email"`
+	FromName  string `json:"from_name"`
 }
@@ -0,0 +1,217 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// Chat services cap message length; summaries are trimmed to fit
+const (
+	slackMessageLimit    = 3000 // Slack truncates long text in notifications
+	discordMessageLimit  = 2000
+	ntfyMessageLimit     = 4096
+	telegramMessageLimit = 4096
+)
+
+// Webhook signature headers. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the channel's secret, so receivers can
+// verify the sender and reject replays.
+const (
+	WebhookTimestampHeader = "X-Bourbontracker-Timestamp"
+	WebhookSignatureHeader = "X-Bourbontracker-Signature"
+)
+
+// IdempotencyHeader carries an outbox notification's ID on every attempt, so
+// receivers that support it can drop repeated deliveries
+const IdempotencyHeader = "Idempotency-Key"
+
+// WebhookPayload is the JSON body posted by WebhookNotifier
+type WebhookPayload struct {
+	ID           string                  `json:"id,omitempty"` // Same as the Idempotency-Key header
+	SubscriberID string                  `json:"subscriber_id"`
+	Subject      string                  `json:"subject"`
+	Time         time.Time               `json:"time"`
+	NewItems     []tracker.InventoryItem `json:"new_items"`
+	Restocks     []QuantityChange        `json:"restocks"`
+	SoldOut      []tracker.InventoryItem `json:"sold_out"`
+}
+
+// WebhookNotifier posts alerts as signed JSON to a URL
+type WebhookNotifier struct {
+	URL    string
+	Secret string // Signing secret; requests are unsigned if empty
+	Client *http.Client
+}
+
+// Notify posts the alert set as a WebhookPayload
+func (n *WebhookNotifier) Notify(ctx context.Context, msg *Message) error {
+	payload := WebhookPayload{
+		ID:           msg.ID,
+		SubscriberID: msg.Subscriber.ID,
+		Subject:      msg.Subject,
+		Time:         msg.Time,
+		NewItems:     nonNil(msg.Set.NewItems),
+		Restocks:     msg.Set.Restocks,
+		SoldOut:      nonNil(msg.Set.SoldOut),
+	}
+	if payload.Restocks == nil {
+		payload.Restocks = []QuantityChange{}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	headers := requestHeaders(msg)
+	headers["Content-Type"] = "application/json"
+	if n.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		headers[WebhookTimestampHeader] = timestamp
+		headers[WebhookSignatureHeader] = "sha256=" + SignWebhook(n.Secret, timestamp, body)
+	}
+	return post(ctx, n.Client, n.URL, body, headers)
+}
+
+// SignWebhook returns the signature of a webhook body sent at timestamp
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SlackNotifier posts alerts to a Slack incoming webhook
+type SlackNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts the subject and a summary of the changes
+func (n *SlackNotifier) Notify(ctx context.Context, msg *Message) error {
+	text := "*" + msg.Subject + "*\n" + msg.Summary(slackMessageLimit-len(msg.Subject)-3)
+	return postJSON(ctx, n.Client, n.URL, msg, map[string]string{"text": text})
+}
+
+// DiscordNotifier posts alerts to a Discord incoming webhook
+type DiscordNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts the subject and a summary of the changes
+func (n *DiscordNotifier) Notify(ctx context.Context, msg *Message) error {
+	content := "**" + msg.Subject + "**\n" + msg.Summary(discordMessageLimit-len(msg.Subject)-5)
+	return postJSON(ctx, n.Client, n.URL, msg, map[string]string{"content": content, "username": "Cask Watch"})
+}
+
+// NtfyNotifier publishes alerts to an ntfy topic
+type NtfyNotifier struct {
+	Server string // e.g. https://ntfy.sh
+	Topic  string
+	Token  string // Access token for protected topics, if any
+	Client *http.Client
+}
+
+// Notify publishes a summary of the changes with the subject as the title
+func (n *NtfyNotifier) Notify(ctx context.Context, msg *Message) error {
+	headers := requestHeaders(msg)
+	headers["Title"] = msg.Subject
+	headers["Tags"] = "tumbler_glass"
+	if n.Token != "" {
+		headers["Authorization"] = "Bearer " + n.Token
+	}
+	target := strings.TrimSuffix(n.Server, "/") + "/" + n.Topic
+	return post(ctx, n.Client, target, []byte(msg.Summary(ntfyMessageLimit)), headers)
+}
+
+// TelegramNotifier sends alerts through the Telegram bot API
+type TelegramNotifier struct {
+	BaseURL string // Bot API server, https://api.telegram.org by default
+	Token   string
+	ChatID  string
+	Client  *http.Client
+}
+
+// Notify sends the subject and a summary of the changes to the chat
+func (n *TelegramNotifier) Notify(ctx context.Context, msg *Message) error {
+	baseURL := n.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.telegram.org"
+	}
+	text := msg.Subject + "\n\n" + msg.Summary(telegramMessageLimit-len(msg.Subject)-2)
+	return postJSON(ctx, n.Client, strings.TrimSuffix(baseURL, "/")+"/bot"+n.Token+"/sendMessage", msg, map[string]interface{}{
+		"chat_id":                  n.ChatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+}
+
+// postJSON posts value as JSON
+func postJSON(ctx context.Context, client *http.Client, target string, msg *Message, value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	headers := requestHeaders(msg)
+	headers["Content-Type"] = "application/json"
+	return post(ctx, client, target, body, headers)
+}
+
+// requestHeaders returns the headers every notifier request carries
+func requestHeaders(msg *Message) map[string]string {
+	headers := make(map[string]string)
+	if msg.ID != "" {
+		headers[IdempotencyHeader] = msg.ID
+	}
+	return headers
+}
+
+// post sends body to url, treating any non-2xx response as an error
+func post(ctx context.Context, client *http.Client, target string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL may hold a secret (webhook path, bot token), so don't log it
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// nonNil returns items, or an empty slice if it is nil, so JSON has [] not null
+func nonNil(items []tracker.InventoryItem) []tracker.InventoryItem {
+	if items == nil {
+		return []tracker.InventoryItem{}
+	}
+	return items
+}
@@ -0,0 +1,245 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// received is a request captured by a stand-in server
+type received struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// newStandIn starts a server that records each request and answers with status
+func newStandIn(t *testing.T, status int) (*httptest.Server, *[]received) {
+	var requests []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, received{path: r.URL.Path, header: r.Header.Clone(), body: body})
+		w.WriteHeader(status)
+		if status >= 300 {
+			w.Write([]byte("upstream said no"))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func testMessage(t *testing.T) *Message {
+	t.Helper()
+	set := AlertSet{NewItems: []tracker.InventoryItem{{
+		ProductName: "Blanton's Single Barrel",
+		ProductID:   "016850",
+		StoreID:     "247",
+		StoreName:   "Richmond",
+		Quantity:    3,
+		State:       "VA",
+	}}}
+	msg, err := NewMessage(Subscriber{ID: "sub-1", Email: "sub@example.com"}, set, time.Date(2025, 12, 13, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.ID = "0123456789abcdef"
+	return msg
+}
+
+func TestWebhookNotifierSigned(t *testing.T) {
+	server, requests := newStandIn(t, http.StatusNoContent)
+	msg := testMessage(t)
+
+	notifier := &WebhookNotifier{URL: server.URL + "/hook", Secret: "s3cret", Client: server.Client()}
+	if err := notifier.Notify(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(*requests))
+	}
+	req := (*requests)[0]
+
+	timestamp := req.header.Get(WebhookTimestampHeader)
+	if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+		t.Fatalf("timestamp header %q is not a Unix time", timestamp)
+	}
+	want := "sha256=" + SignWebhook("s3cret", timestamp, req.body)
+	if got := req.header.Get(WebhookSignatureHeader); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if got := req.header.Get(IdempotencyHeader); got != msg.ID {
+		t.Errorf("%s = %q, want %q", IdempotencyHeader, got, msg.ID)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ID != msg.ID || payload.SubscriberID != "sub-1" || len(payload.NewItems) != 1 {
+		t.Errorf("payload = %+v, want the message's ID, subscriber and item", payload)
+	}
+	if payload.Restocks == nil || payload.SoldOut == nil {
+		t.Error("empty change lists should be [] rather than null")
+	}
+}
+
+func TestWebhookNotifierUnsigned(t *testing.T) {
+	server, requests := newStandIn(t, http.StatusOK)
+
+	notifier := &WebhookNotifier{URL: server.URL, Client: server.Client()}
+	if err := notifier.Notify(context.Background(), testMessage(t)); err != nil {
+		t.Fatal(err)
+	}
+	if got := (*requests)[0].header.Get(WebhookSignatureHeader); got != "" {
+		t.Errorf("signature = %q, want none without a secret", got)
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// printf '1700000000.{}' | openssl dgst -sha256 -hmac key
+	const want = "9d713ed406bb7076d4123f0dc2c39d2df5c654ed4b0cd56b52c8b4c940bd63ae"
+	if got := SignWebhook("key", "1700000000", []byte("{}")); got != want {
+		t.Errorf("SignWebhook = %q, want %q", got, want)
+	}
+}
+
+func TestChatNotifierPayloads(t *testing.T) {
+	tests := []struct {
+		name     string
+		notifier func(url string, client *http.Client) Notifier
+		path     string
+		check    func(t *testing.T, req received)
+	}{
+		{
+			name: "slack",
+			notifier: func(url string, client *http.Client) Notifier {
+				return &SlackNotifier{URL: url + "/services/T0/B0/x", Client: client}
+			},
+			path: "/services/T0/B0/x",
+			check: func(t *testing.T, req received) {
+				var body map[string]string
+				decodeJSON(t, req, &body)
+				if !strings.HasPrefix(body["text"], "*") || !strings.Contains(body["text"], "Blanton's") {
+					t.Errorf("text = %q, want a bold subject and the item", body["text"])
+				}
+			},
+		},
+		{
+			name: "discord",
+			notifier: func(url string, client *http.Client) Notifier {
+				return &DiscordNotifier{URL: url + "/api/webhooks/1/x", Client: client}
+			},
+			path: "/api/webhooks/1/x",
+			check: func(t *testing.T, req received) {
+				var body map[string]string
+				decodeJSON(t, req, &body)
+				if !strings.HasPrefix(body["content"], "**") || !strings.Contains(body["content"], "Blanton's") {
+					t.Errorf("content = %q, want a bold subject and the item", body["content"])
+				}
+				if body["username"] == "" {
+					t.Error("username not set")
+				}
+			},
+		},
+		{
+			name: "ntfy",
+			notifier: func(url string, client *http.Client) Notifier {
+				return &NtfyNotifier{Server: url + "/", Topic: "bourbon", Token: "tk", Client: client}
+			},
+			path: "/bourbon",
+			check: func(t *testing.T, req received) {
+				if req.header.Get("Title") == "" {
+					t.Error("Title header not set")
+				}
+				if got := req.header.Get("Authorization"); got != "Bearer tk" {
+					t.Errorf("Authorization = %q, want Bearer tk", got)
+				}
+				if !strings.Contains(string(req.body), "Blanton's") {
+					t.Errorf("body = %q, want the item", req.body)
+				}
+			},
+		},
+		{
+			name: "telegram",
+			notifier: func(url string, client *http.Client) Notifier {
+				return &TelegramNotifier{BaseURL: url, Token: "123:abc", ChatID: "-100", Client: client}
+			},
+			path: "/bot123:abc/sendMessage",
+			check: func(t *testing.T, req received) {
+				var body struct {
+					ChatID string `json:"chat_id"`
+					Text   string `json:"text"`
+				}
+				decodeJSON(t, req, &body)
+				if body.ChatID != "-100" || !strings.Contains(body.Text, "Blanton's") {
+					t.Errorf("body = %+v, want chat -100 and the item", body)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newStandIn(t, http.StatusOK)
+			msg := testMessage(t)
+
+			if err := tt.notifier(server.URL, server.Client()).Notify(context.Background(), msg); err != nil {
+				t.Fatal(err)
+			}
+			if len(*requests) != 1 {
+				t.Fatalf("requests = %d, want 1", len(*requests))
+			}
+			req := (*requests)[0]
+			if req.path != tt.path {
+				t.Errorf("path = %q, want %q", req.path, tt.path)
+			}
+			if got := req.header.Get(IdempotencyHeader); got != msg.ID {
+				t.Errorf("%s = %q, want %q", IdempotencyHeader, got, msg.ID)
+			}
+			tt.check(t, req)
+		})
+
+		t.Run(tt.name+" error", func(t *testing.T) {
+			server, _ := newStandIn(t, http.StatusInternalServerError)
+
+			err := tt.notifier(server.URL, server.Client()).Notify(context.Background(), testMessage(t))
+			if err == nil {
+				t.Fatal("Notify succeeded against a 500")
+			}
+			if !strings.Contains(err.Error(), "500") || !strings.Contains(err.Error(), "upstream said no") {
+				t.Errorf("error = %q, want the status and response body", err)
+			}
+		})
+	}
+}
+
+func TestNotifierErrorHidesURL(t *testing.T) {
+	// Nothing listens here, so the request fails before any response
+	notifier := &TelegramNotifier{BaseURL: "http://127.0.0.1:1", Token: "123:secret", ChatID: "1", Client: http.DefaultClient}
+
+	err := notifier.Notify(context.Background(), testMessage(t))
+	if err == nil {
+		t.Fatal("Notify succeeded without a server")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error %q leaks the bot token", err)
+	}
+}
+
+func decodeJSON(t *testing.T, req received, v interface{}) {
+	t.Helper()
+	if ct := req.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if err := json.Unmarshal(req.body, v); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+const (
+	// DefaultLimit is the page size when no limit is given
+	DefaultLimit = 100
+
+	// MaxLimit caps the page size a client can request
+	MaxLimit = 5000
+
+	// DefaultRadiusMiles applies when near is given without radius
+	DefaultRadiusMiles = 25
+)
+
+// BoundingBox is a lat/lon rectangle
+type BoundingBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+// Contains reports whether loc is inside the box
+func (b BoundingBox) Contains(loc tracker.Location) bool {
+	return loc.Longitude >= b.MinLon && loc.Longitude <= b.MaxLon &&
+		loc.Latitude >= b.MinLat && loc.Latitude <= b.MaxLat
+}
+
+// Filter selects inventory items. Empty fields match everything.
+type Filter struct {
+	State       string
+	County      string
+	ListingType string
+	Product     string // Case-insensitive substring of the product name
+	ProductID   string
+	StoreID     string
+	BBox        *BoundingBox
+	Near        *tracker.Location
+	RadiusMiles float64
+}
+
+// ParseFilter reads a Filter from query parameters:
+//
+//	state, county, listing_type, product, product_id, store
+//	bbox=minLon,minLat,maxLon,maxLat
+//	near=lat,lon and radius (miles, default 25)
+func ParseFilter(query url.Values) (Filter, error) {
+	filter := Filter{
+		State:       query.Get("state"),
+		County:      query.Get("county"),
+		ListingType: query.Get("listing_type"),
+		Product:     strings.ToLower(strings.TrimSpace(query.Get("product"))),
+		ProductID:   query.Get("product_id"),
+		StoreID:     query.Get("store"),
+	}
+
+	if raw := query.Get("bbox"); raw != "" {
+		values, err := parseFloats(raw, 4)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid bbox %q: %w", raw, err)
+		}
+		filter.BBox = &BoundingBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	}
+
+	if raw := query.Get("near"); raw != "" {
+		values, err := parseFloats(raw, 2)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid near %q: %w", raw, err)
+		}
+		filter.Near = &tracker.Location{Latitude: values[0], Longitude: values[1]}
+		filter.RadiusMiles = DefaultRadiusMiles
+
+		if raw := query.Get("radius"); raw != "" {
+			radius, err := strconv.ParseFloat(raw, 64)
+			if err != nil || radius <= 0 {
+				return Filter{}, fmt.Errorf("invalid radius %q", raw)
+			}
+			filter.RadiusMiles = radius
+		}
+	} else if query.Get("radius") != "" {
+		return Filter{}, fmt.Errorf("radius requires near")
+	}
+
+	return filter, nil
+}
+
+// Match reports whether item passes the filter
+func (f Filter) Match(item tracker.InventoryItem) bool {
+	if f.State != "" && !strings.EqualFold(item.State, f.State) {
+		return false
+	}
+	if f.County != "" && !strings.EqualFold(item.County, f.County) {
+		return false
+	}
+	if f.ListingType != "" && !strings.EqualFold(item.ListingType, f.ListingType) {
+		return false
+	}
+	if f.Product != "" && !strings.Contains(strings.ToLower(item.ProductName), f.Product) {
+		return false
+	}
+	if f.ProductID != "" && item.ProductID != f.ProductID {
+		return false
+	}
+	if f.StoreID != "" && item.StoreID != f.StoreID {
+		return false
+	}
+	if f.BBox != nil && !f.BBox.Contains(item.Location) {
+		return false
+	}
+	if f.Near != nil && f.Near.DistanceMiles(item.Location) > f.RadiusMiles {
+		return false
+	}
+	return true
+}
+
+// Apply returns the matching items. With Near set they are ordered nearest first.
+func (f Filter) Apply(items []tracker.InventoryItem) []tracker.InventoryItem {
+	matched := []tracker.InventoryItem{}
+	for _, item := range items {
+		if f.Match(item) {
+			matched = append(matched, item)
+		}
+	}
+
+	if f.Near != nil {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return f.Near.DistanceMiles(matched[i].Location) < f.Near.DistanceMiles(matched[j].Location)
+		})
+	}
+	return matched
+}
+
+// Page is a window into a result list
+type Page struct {
+	Offset int
+	Limit  int
+}
+
+// ParsePage reads offset and limit query parameters
+func ParsePage(query url.Values) (Page, error) {
+	page := Page{Limit: DefaultLimit}
+
+	if raw := query.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return Page{}, fmt.Errorf("invalid offset %q", raw)
+		}
+		page.Offset = offset
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return Page{}, fmt.Errorf("invalid limit %q", raw)
+		}
+		if limit > MaxLimit {
+			limit = MaxLimit
+		}
+		page.Limit = limit
+	}
+
+	return page, nil
+}
+
+// Bounds returns the slice bounds of the page within n results. Pages past
+// the end, and pages with a negative offset or a limit below 1 that
+// ParsePage would have rejected, are clamped rather than out of range.
+func (p Page) Bounds(n int) (int, int) {
+	start := p.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > n {
+		start = n
+	}
+	end := start
+	if p.Limit > 0 {
+		end += p.Limit
+	}
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+// parseFloats parses exactly n comma-separated numbers
+func parseFloats(raw string, n int) ([]float64, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d comma-separated numbers", n)
+	}
+
+	values := make([]float64, n)
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    Filter
+		wantErr bool
+	}{
+		{"", Filter{}, false},
+		{"state=VA&product=+Blanton%27s+&store=247", Filter{State: "VA", Product: "blanton's", StoreID: "247"}, false},
+		{"bbox=-78,35,-77,36", Filter{BBox: &BoundingBox{MinLon: -78, MinLat: 35, MaxLon: -77, MaxLat: 36}}, false},
+		{"near=35.78,-78.64", Filter{Near: &tracker.Location{Latitude: 35.78, Longitude: -78.64}, RadiusMiles: DefaultRadiusMiles}, false},
+		{"near=35.78,%20-78.64&radius=2.5", Filter{Near: &tracker.Location{Latitude: 35.78, Longitude: -78.64}, RadiusMiles: 2.5}, false},
+
+		{"bbox=-78,35,-77", Filter{}, true},
+		{"bbox=west,35,-77,36", Filter{}, true},
+		{"near=35.78", Filter{}, true},
+		{"near=35.78,-78.64,1", Filter{}, true},
+		{"near=35.78,-78.64&radius=0", Filter{}, true},
+		{"near=35.78,-78.64&radius=-5", Filter{}, true},
+		{"near=35.78,-78.64&radius=far", Filter{}, true},
+		{"radius=10", Filter{}, true},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseFilter(query)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFilter(%q) error = %v, want error %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseFilter(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFilterApply(t *testing.T) {
+	raleigh := tracker.Location{Latitude: 35.78, Longitude: -78.64}
+	items := []tracker.InventoryItem{
+		{ProductID: "1", ProductName: "Blanton's Single Barrel", State: "NC", County: "Wake", ListingType: "Allocation", StoreID: "far",
+			Location: tracker.Location{Latitude: 35.95, Longitude: -78.64}}, // ~11.7 mi north
+		{ProductID: "1", ProductName: "Blanton's Single Barrel", State: "NC", County: "Wake", ListingType: "Allocation", StoreID: "near",
+			Location: tracker.Location{Latitude: 35.80, Longitude: -78.64}}, // ~1.4 mi north
+		{ProductID: "2", ProductName: "Buffalo Trace", State: "NC", County: "Wake", ListingType: "Listed", StoreID: "near",
+			Location: tracker.Location{Latitude: 35.80, Longitude: -78.64}},
+		{ProductID: "1", ProductName: "Blanton's Single Barrel", State: "VA", ListingType: "Allocation", StoreID: "247",
+			Location: tracker.Location{Latitude: 37.54, Longitude: -77.44}},
+		{ProductID: "3", ProductName: "BLANTON'S GOLD", State: "NC", County: "Durham", ListingType: "Allocation", StoreID: "durham"},
+	}
+
+	stores := func(items []tracker.InventoryItem) []string {
+		ids := []string{}
+		for _, item := range items {
+			ids = append(ids, item.StoreID+"/"+item.ProductID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"everything", Filter{}, []string{"far/1", "near/1", "near/2", "247/1", "durham/3"}},
+		{"state, case-insensitive", Filter{State: "va"}, []string{"247/1"}},
+		{"product substring", Filter{Product: "blanton"}, []string{"far/1", "near/1", "247/1", "durham/3"}},
+		{"combined", Filter{State: "NC", County: "wake", ListingType: "allocation", Product: "blanton"}, []string{"far/1", "near/1"}},
+		{"product and store", Filter{ProductID: "1", StoreID: "near"}, []string{"near/1"}},
+		{"bbox", Filter{BBox: &BoundingBox{MinLon: -79, MinLat: 35.7, MaxLon: -78, MaxLat: 35.9}}, []string{"near/1", "near/2"}},
+		{"near, nearest first", Filter{Near: &raleigh, RadiusMiles: 25, ListingType: "Allocation"}, []string{"near/1", "far/1"}},
+		{"near, small radius", Filter{Near: &raleigh, RadiusMiles: 5}, []string{"near/1", "near/2"}},
+		{"nothing matches", Filter{State: "VA", County: "Wake"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := stores(tt.filter.Apply(items)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Apply = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    Page
+		wantErr bool
+	}{
+		{"", Page{Limit: DefaultLimit}, false},
+		{"offset=20&limit=10", Page{Offset: 20, Limit: 10}, false},
+		{"limit=999999", Page{Limit: MaxLimit}, false},
+		{"limit=0", Page{}, true},
+		{"limit=-1", Page{}, true},
+		{"limit=ten", Page{}, true},
+		{"offset=-1", Page{}, true},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := ParsePage(query)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParsePage(%q) = %+v, %v; want %+v, error %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPageBounds(t *testing.T) {
+	tests := []struct {
+		page       Page
+		n          int
+		start, end int
+	}{
+		{Page{Offset: 0, Limit: 10}, 25, 0, 10},
+		{Page{Offset: 20, Limit: 10}, 25, 20, 25},
+		{Page{Offset: 25, Limit: 10}, 25, 25, 25},
+		{Page{Offset: 100, Limit: 10}, 25, 25, 25},
+		{Page{Offset: 0, Limit: 10}, 0, 0, 0},
+		{Page{Offset: 5, Limit: 0}, 25, 5, 5},
+		{Page{Offset: 5, Limit: -3}, 25, 5, 5},
+		{Page{Offset: -5, Limit: 10}, 25, 0, 10},
+	}
+
+	for _, tt := range tests {
+		start, end := tt.page.Bounds(tt.n)
+		if start != tt.start || end != tt.end {
+			t.Errorf("%+v.Bounds(%d) = %d, %d; want %d, %d", tt.page, tt.n, start, end, tt.start, tt.end)
+		}
+	}
+}
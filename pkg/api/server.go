@@ -0,0 +1,313 @@
+// Package api serves inventory and history over a read-only REST API
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/history"
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// gzipThreshold is the smallest response body worth compressing
+const gzipThreshold = 1024
+
+// Source provides the latest inventory and when it last changed
+type Source interface {
+	Inventory() ([]tracker.InventoryItem, time.Time, error)
+}
+
+// Server handles API requests
+type Server struct {
+	source  Source
+	history *history.Log
+}
+
+// NewServer returns a server for the given inventory source. historyLog may be
+// nil, in which case the history endpoints return 404.
+func NewServer(source Source, historyLog *history.Log) *Server {
+	return &Server{source: source, history: historyLog}
+}
+
+// InventoryResponse is a page of inventory items
+type InventoryResponse struct {
+	Total   int                     `json:"total"`
+	Offset  int                     `json:"offset"`
+	Limit   int                     `json:"limit"`
+	Updated time.Time               `json:"updated"`
+	Items   []tracker.InventoryItem `json:"items"`
+}
+
+// ChangesResponse is a page of history changes
+type ChangesResponse struct {
+	Total   int              `json:"total"`
+	Offset  int              `json:"offset"`
+	Limit   int              `json:"limit"`
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Changes []history.Change `json:"changes"`
+}
+
+// TimelineResponse is the history of one product at one store
+type TimelineResponse struct {
+	ProductID string          `json:"product_id"`
+	StoreID   string          `json:"store_id"`
+	Points    []history.Point `json:"points"`
+}
+
+// Handler returns the HTTP handler for all API routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /api/v1/inventory", s.handleInventory)
+	mux.HandleFunc("GET /api/v1/history/state", s.handleHistoryState)
+	mux.HandleFunc("GET /api/v1/history/changes", s.handleHistoryChanges)
+	mux.HandleFunc("GET /api/v1/history/timeline", s.handleHistoryTimeline)
+	return mux
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleInventory serves the latest inventory, filtered and paginated
+func (s *Server) handleInventory(w http.ResponseWriter, r *http.Request) {
+	filter, page, ok := parseListQuery(w, r)
+	if !ok {
+		return
+	}
+
+	items, updated, err := s.source.Inventory()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to load inventory: %v", err))
+		return
+	}
+
+	if !updated.IsZero() {
+		w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	}
+	writeJSON(w, r, inventoryPage(filter.Apply(items), page, updated))
+}
+
+// handleHistoryState serves the inventory as it stood at ?at= (RFC 3339)
+func (s *Server) handleHistoryState(w http.ResponseWriter, r *http.Request) {
+	if !s.historyEnabled(w) {
+		return
+	}
+	filter, page, ok := parseListQuery(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	at, err := parseTime(query.Get("at"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid at: %v", err))
+		return
+	}
+
+	items, err := s.history.StateAt(query.Get("source"), at)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to read history: %v", err))
+		return
+	}
+
+	writeJSON(w, r, inventoryPage(filter.Apply(items), page, at))
+}
+
+// handleHistoryChanges serves net changes between ?from= and ?to=
+func (s *Server) handleHistoryChanges(w http.ResponseWriter, r *http.Request) {
+	if !s.historyEnabled(w) {
+		return
+	}
+	filter, page, ok := parseListQuery(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	now := time.Now()
+	to, err := parseTime(query.Get("to"), now)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid to: %v", err))
+		return
+	}
+	from, err := parseTime(query.Get("from"), to.Add(-24*time.Hour))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid from: %v", err))
+		return
+	}
+	if from.After(to) {
+		writeError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+
+	changes, err := s.history.Changes(query.Get("source"), from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to read history: %v", err))
+		return
+	}
+
+	matched := []history.Change{}
+	for _, change := range changes {
+		if filter.Match(change.Item) {
+			matched = append(matched, change)
+		}
+	}
+
+	start, end := page.Bounds(len(matched))
+	writeJSON(w, r, ChangesResponse{
+		Total:   len(matched),
+		Offset:  page.Offset,
+		Limit:   page.Limit,
+		From:    from,
+		To:      to,
+		Changes: matched[start:end],
+	})
+}
+
+// handleHistoryTimeline serves the recorded quantities for ?product_id= at ?store=
+func (s *Server) handleHistoryTimeline(w http.ResponseWriter, r *http.Request) {
+	if !s.historyEnabled(w) {
+		return
+	}
+
+	query := r.URL.Query()
+	productID, storeID := query.Get("product_id"), query.Get("store")
+	if productID == "" || storeID == "" {
+		writeError(w, http.StatusBadRequest, "product_id and store are required")
+		return
+	}
+
+	points, err := s.history.Timeline(productID, storeID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to read history: %v", err))
+		return
+	}
+	if points == nil {
+		points = []history.Point{}
+	}
+
+	writeJSON(w, r, TimelineResponse{ProductID: productID, StoreID: storeID, Points: points})
+}
+
+// historyEnabled writes a 404 if the server has no history log
+func (s *Server) historyEnabled(w http.ResponseWriter) bool {
+	if s.history == nil {
+		writeError(w, http.StatusNotFound, "history is not enabled on this server")
+		return false
+	}
+	return true
+}
+
+// parseListQuery reads the filter and page parameters, writing a 400 on error
+func parseListQuery(w http.ResponseWriter, r *http.Request) (Filter, Page, bool) {
+	query := r.URL.Query()
+
+	filter, err := ParseFilter(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return Filter{}, Page{}, false
+	}
+
+	page, err := ParsePage(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return Filter{}, Page{}, false
+	}
+
+	return filter, page, true
+}
+
+// inventoryPage slices matched items into a response
+func inventoryPage(matched []tracker.InventoryItem, page Page, updated time.Time) InventoryResponse {
+	start, end := page.Bounds(len(matched))
+	return InventoryResponse{
+		Total:   len(matched),
+		Offset:  page.Offset,
+		Limit:   page.Limit,
+		Updated: updated,
+		Items:   matched[start:end],
+	}
+}
+
+// parseTime parses an RFC 3339 timestamp, returning fallback when raw is empty
+func parseTime(raw string, fallback time.Time) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// writeJSON writes v with an ETag derived from the body, answering matching
+// If-None-Match requests with 304 and compressing for gzip-capable clients.
+// The compressed variant has its own ETag, since the two responses differ
+// byte for byte.
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	compress := len(body) >= gzipThreshold && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+
+	sum := sha256.Sum256(body)
+	tag := hex.EncodeToString(sum[:16])
+	if compress {
+		tag += "-gzip"
+	}
+	etag := `"` + tag + `"`
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Vary", "Accept-Encoding")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Access-Control-Allow-Origin", "*")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Type", "application/json")
+
+	if compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(body)
+		gz.Close()
+
+		header.Set("Content-Encoding", "gzip")
+		body = buf.Bytes()
+	}
+
+	w.Write(body)
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeError writes a JSON error body
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
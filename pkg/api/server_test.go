@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSONETagPerEncoding(t *testing.T) {
+	body := map[string]string{"padding": strings.Repeat("x", gzipThreshold)}
+
+	get := func(acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		rec := httptest.NewRecorder()
+		writeJSON(rec, req, body)
+		return rec
+	}
+
+	identity := get("", "")
+	compressed := get("gzip", "")
+	if compressed.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", compressed.Header().Get("Content-Encoding"))
+	}
+
+	identityTag, gzipTag := identity.Header().Get("ETag"), compressed.Header().Get("ETag")
+	if identityTag == gzipTag {
+		t.Fatalf("identity and gzip responses share ETag %s", identityTag)
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		ifNoneMatch    string
+		want           int
+	}{
+		{"identity revalidated", "", identityTag, http.StatusNotModified},
+		{"gzip revalidated", "gzip", gzipTag, http.StatusNotModified},
+		{"gzip tag on identity request", "", gzipTag, http.StatusOK},
+		{"identity tag on gzip request", "gzip", identityTag, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := get(tt.acceptEncoding, tt.ifNoneMatch).Code; got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
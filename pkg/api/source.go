@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// FileSource serves inventory from the JSON files written by cmd/tracker,
+// reloading them whenever one changes on disk
+type FileSource struct {
+	paths []string
+
+	mu       sync.Mutex
+	stamps   []fileStamp
+	items    []tracker.InventoryItem
+	modified time.Time
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewFileSource returns a source that reads the given inventory files
+func NewFileSource(paths []string) *FileSource {
+	return &FileSource{paths: paths}
+}
+
+// Inventory returns the combined inventory and when it last changed. Missing
+// files are treated as empty, since the tracker may not have run yet.
+func (s *FileSource) Inventory() ([]tracker.InventoryItem, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamps := make([]fileStamp, len(s.paths))
+	for i, path := range s.paths {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		stamps[i] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+	}
+
+	if s.items != nil && sameStamps(stamps, s.stamps) {
+		return s.items, s.modified, nil
+	}
+
+	items := []tracker.InventoryItem{}
+	var modified time.Time
+	for i, path := range s.paths {
+		if stamps[i].modTime.IsZero() {
+			continue
+		}
+
+		inventory, err := tracker.LoadInventory(path)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		items = append(items, inventory.Items...)
+
+		if stamps[i].modTime.After(modified) {
+			modified = stamps[i].modTime
+		}
+	}
+
+	s.items = items
+	s.stamps = stamps
+	s.modified = modified
+	return items, modified, nil
+}
+
+// sameStamps reports whether two sets of file stamps are identical
+func sameStamps(a, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].size != b[i].size || !a[i].modTime.Equal(b[i].modTime) {
+			return false
+		}
+	}
+	return true
+}
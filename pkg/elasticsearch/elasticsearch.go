@@ -0,0 +1,344 @@
+// Package elasticsearch writes tracker runs to Elasticsearch through the
+// _bulk API. It installs an index template mapping geo.location as a
+// geo_point and bt.* as keywords before the first write, and can target a
+// plain index or a data stream.
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// DefaultIndex is the index (or data stream) written to when none is set
+const DefaultIndex = "bourbontracker-inventory"
+
+// Config configures the Elasticsearch output
+type Config struct {
+	URL        string // e.g. https://bourbontracker-es-http:9200
+	Index      string // Index or data stream name
+	DataStream bool   // Write to a data stream instead of a plain index
+
+	Username string
+	Password string
+	APIKey   string // Base64 "id:key" API key, used instead of basic auth
+	CACert   string // PEM file to verify the server with (ECK's self-signed CA)
+
+	BatchSize  int           // Documents per _bulk request
+	MaxRetries int           // Attempts per batch before giving up
+	Backoff    time.Duration // Wait before the first retry, doubling after each
+	Timeout    time.Duration // Per-request timeout
+}
+
+// DefaultConfig returns sensible defaults for everything but the URL
+func DefaultConfig() Config {
+	return Config{
+		Index:      DefaultIndex,
+		BatchSize:  500,
+		MaxRetries: 5,
+		Backoff:    time.Second,
+		Timeout:    30 * time.Second,
+	}
+}
+
+// Client indexes tracker runs into Elasticsearch
+type Client struct {
+	config Config
+	url    string
+	client *http.Client
+	logger *slog.Logger
+
+	// Whether the index template has been installed by this client
+	templateInstalled bool
+}
+
+// BulkResult summarises a call to Index
+type BulkResult struct {
+	Indexed int // Documents written (or already present from an earlier attempt)
+	Failed  int // Documents rejected or still failing after all retries
+}
+
+// document is an inventory item as indexed, tagged with the run it came from
+type document struct {
+	tracker.InventoryItem
+	Tracker string    `json:"bt.tracker"`
+	Run     time.Time `json:"bt.run"`
+}
+
+// New creates a client. Unset batch, retry and timeout settings fall back to
+// DefaultConfig.
+func New(config Config) (*Client, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("elasticsearch URL is required")
+	}
+
+	defaults := DefaultConfig()
+	if config.Index == "" {
+		config.Index = defaults.Index
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = defaults.MaxRetries
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaults.Backoff
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+
+	client := &http.Client{Timeout: config.Timeout}
+	if config.CACert != "" {
+		pem, err := os.ReadFile(config.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CACert)
+		}
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+
+	return &Client{
+		config: config,
+		url:    strings.TrimRight(config.URL, "/"),
+		client: client,
+		logger: slog.Default(),
+	}, nil
+}
+
+// SetLogger sets the logger used for retries and partial failures
+func (c *Client) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
+// Index writes a tracker run's inventory. Each document carries the tracker
+// name (bt.tracker) and run time (bt.run), and its ID is derived from both,
+// so a retried or repeated write of the same run never duplicates documents.
+// The index template is installed first if this client has not done so yet.
+func (c *Client) Index(ctx context.Context, source string, run time.Time, items []tracker.InventoryItem) (*BulkResult, error) {
+	if !c.templateInstalled {
+		if err := c.EnsureTemplate(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &BulkResult{}
+	var firstErr error
+	for start := 0; start < len(items); start += c.config.BatchSize {
+		end := min(start+c.config.BatchSize, len(items))
+
+		docs := make([]document, 0, end-start)
+		for _, item := range items[start:end] {
+			docs = append(docs, document{InventoryItem: item, Tracker: source, Run: run})
+		}
+
+		indexed, err := c.sendBatch(ctx, docs)
+		result.Indexed += indexed
+		result.Failed += len(docs) - indexed
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if result.Failed > 0 {
+		return result, fmt.Errorf("%d of %d documents were not indexed: %w", result.Failed, len(items), firstErr)
+	}
+	return result, nil
+}
+
+// bulkResponse is the part of a _bulk response we look at
+type bulkResponse struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]bulkItemResponse `json:"items"`
+}
+
+type bulkItemResponse struct {
+	Status int `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// sendBatch indexes docs, retrying the whole request on transport errors,
+// 429s and 5xx responses, and retrying individual documents that were
+// rejected with those statuses. It returns how many documents made it.
+func (c *Client) sendBatch(ctx context.Context, docs []document) (int, error) {
+	pending := docs
+	indexed := 0
+	backoff := c.config.Backoff
+	var lastErr, rejectErr error
+
+	for attempt := 1; ; attempt++ {
+		body, err := c.bulkBody(pending)
+		if err != nil {
+			return indexed, err
+		}
+
+		status, respBody, err := c.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body)
+		switch {
+		case err != nil:
+			lastErr = err
+		case status == http.StatusTooManyRequests || status >= 500:
+			lastErr = fmt.Errorf("bulk request returned %d: %s", status, truncate(respBody))
+		case status != http.StatusOK:
+			// Bad auth, missing privileges or a malformed request won't improve with retries
+			return indexed, fmt.Errorf("bulk request returned %d: %s", status, truncate(respBody))
+		default:
+			var resp bulkResponse
+			if err := json.Unmarshal(respBody, &resp); err != nil {
+				return indexed, fmt.Errorf("failed to parse bulk response: %w", err)
+			}
+			if len(resp.Items) != len(pending) {
+				return indexed, fmt.Errorf("bulk response has %d items for %d documents", len(resp.Items), len(pending))
+			}
+
+			var retry []document
+			for i, item := range resp.Items {
+				outcome := firstValue(item)
+				switch {
+				case outcome.Status >= 200 && outcome.Status < 300:
+					indexed++
+				case outcome.Status == http.StatusConflict:
+					// Created by an earlier attempt whose response we never saw
+					indexed++
+				case outcome.Status == http.StatusTooManyRequests || outcome.Status >= 500:
+					retry = append(retry, pending[i])
+					lastErr = outcome.err()
+				default:
+					rejectErr = outcome.err()
+					c.logger.Warn("Document rejected by Elasticsearch",
+						logging.KeyProductID, pending[i].ProductID, logging.KeyStoreID, pending[i].StoreID,
+						logging.KeyStatus, outcome.Status, logging.KeyError, rejectErr)
+				}
+			}
+			if len(retry) == 0 {
+				if indexed < len(docs) {
+					return indexed, rejectErr
+				}
+				return indexed, nil
+			}
+			pending = retry
+		}
+
+		if attempt >= c.config.MaxRetries {
+			return indexed, fmt.Errorf("giving up after %d attempts: %w", attempt, lastErr)
+		}
+		c.logger.Warn("Retrying bulk request", "documents", len(pending), logging.KeyAttempt, attempt,
+			"backoff", backoff, logging.KeyError, lastErr)
+		if err := tracker.Sleep(ctx, backoff); err != nil {
+			return indexed, err
+		}
+		backoff *= 2
+	}
+}
+
+// bulkBody renders docs as _bulk NDJSON. Data streams only accept "create";
+// plain indices use "index" so a repeated write overwrites in place.
+func (c *Client) bulkBody(docs []document) ([]byte, error) {
+	op := "index"
+	if c.config.DataStream {
+		op = "create"
+	}
+
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		action := map[string]map[string]string{
+			op: {"_index": c.config.Index, "_id": documentID(doc)},
+		}
+		line, err := json.Marshal(action)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+
+		line, err = json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// documentID identifies a product at a store within one run of one tracker
+func documentID(doc document) string {
+	return fmt.Sprintf("%s-%d-%s-%s", doc.Tracker, doc.Run.UnixMilli(), doc.ProductID, doc.StoreID)
+}
+
+// do sends a request to Elasticsearch with the configured credentials
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	switch {
+	case c.config.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+c.config.APIKey)
+	case c.config.Username != "":
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// firstValue returns the single action result in a _bulk response item
+func firstValue(item map[string]bulkItemResponse) bulkItemResponse {
+	for _, value := range item {
+		return value
+	}
+	return bulkItemResponse{}
+}
+
+func (r bulkItemResponse) err() error {
+	if r.Error == nil {
+		return fmt.Errorf("status %d", r.Status)
+	}
+	return fmt.Errorf("%s: %s", r.Error.Type, r.Error.Reason)
+}
+
+// truncate shortens a response body for error messages
+func truncate(body []byte) string {
+	const limit = 512
+	if len(body) > limit {
+		return string(body[:limit]) + "..."
+	}
+	return string(body)
+}
@@ -0,0 +1,289 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// bulkRequest is one _bulk call received by fakeES: each action line's op
+// and document ID, in order
+type bulkRequest struct {
+	ops []string
+	ids []string
+}
+
+// fakeES stands in for Elasticsearch. Template PUTs are recorded and
+// acknowledged; each _bulk call is answered by respond, given the call number
+// (from 1) and the request.
+type fakeES struct {
+	t       *testing.T
+	respond func(call int, req bulkRequest) (int, interface{})
+
+	mu        sync.Mutex
+	templates map[string]map[string]interface{}
+	bulks     []bulkRequest
+}
+
+func newFakeES(t *testing.T, respond func(call int, req bulkRequest) (int, interface{})) (*fakeES, *httptest.Server) {
+	f := &fakeES{t: t, respond: respond, templates: make(map[string]map[string]interface{})}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeES) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_index_template/"):
+		var template map[string]interface{}
+		if err := json.Unmarshal(body, &template); err != nil {
+			f.t.Errorf("template is not JSON: %v", err)
+		}
+		f.templates[strings.TrimPrefix(r.URL.Path, "/_index_template/")] = template
+		w.Write([]byte(`{"acknowledged":true}`))
+
+	case r.Method == http.MethodPost && r.URL.Path == "/_bulk":
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			f.t.Errorf("bulk Content-Type = %q, want application/x-ndjson", ct)
+		}
+		req := parseBulk(f.t, body)
+		f.bulks = append(f.bulks, req)
+
+		status, resp := f.respond(len(f.bulks), req)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// parseBulk reads the action lines of a _bulk NDJSON body
+func parseBulk(t *testing.T, body []byte) bulkRequest {
+	var req bulkRequest
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, 1<<20)
+	for line := 0; scanner.Scan(); line++ {
+		if line%2 == 1 {
+			continue // Document source
+		}
+		var action map[string]map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+			t.Fatalf("bad action line %q: %v", scanner.Text(), err)
+		}
+		for op, meta := range action {
+			req.ops = append(req.ops, op)
+			req.ids = append(req.ids, meta["_id"])
+		}
+	}
+	return req
+}
+
+// statuses builds a _bulk response with one item per status
+func statuses(op string, codes ...int) map[string]interface{} {
+	items := make([]map[string]interface{}, len(codes))
+	failed := false
+	for i, code := range codes {
+		result := map[string]interface{}{"status": code}
+		if code >= 300 {
+			failed = true
+			result["error"] = map[string]string{"type": "test_error", "reason": fmt.Sprintf("status %d", code)}
+		}
+		items[i] = map[string]interface{}{op: result}
+	}
+	return map[string]interface{}{"errors": failed, "items": items}
+}
+
+func testItems(n int) []tracker.InventoryItem {
+	items := make([]tracker.InventoryItem, n)
+	for i := range items {
+		items[i] = tracker.InventoryItem{ProductID: fmt.Sprintf("p%d", i), StoreID: "s1", Quantity: 1}
+	}
+	return items
+}
+
+func testClient(t *testing.T, url string, dataStream bool) *Client {
+	client, err := New(Config{URL: url, Index: "bt-test", DataStream: dataStream, MaxRetries: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestEnsureTemplate(t *testing.T) {
+	for _, dataStream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("data_stream=%v", dataStream), func(t *testing.T) {
+			fake, server := newFakeES(t, nil)
+			client := testClient(t, server.URL, dataStream)
+
+			if err := client.EnsureTemplate(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			template, ok := fake.templates["bt-test"]
+			if !ok {
+				t.Fatalf("no template installed at /_index_template/bt-test (got %v)", fake.templates)
+			}
+			if _, ok := template["data_stream"]; ok != dataStream {
+				t.Errorf("template has data_stream = %v, want %v", ok, dataStream)
+			}
+
+			mappings := template["template"].(map[string]interface{})["mappings"].(map[string]interface{})
+			geo := mappings["properties"].(map[string]interface{})["geo"].(map[string]interface{})
+			location := geo["properties"].(map[string]interface{})["location"].(map[string]interface{})
+			if location["type"] != "geo_point" {
+				t.Errorf("geo.location type = %v, want geo_point", location["type"])
+			}
+		})
+	}
+}
+
+func TestEnsureTemplateError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	client := testClient(t, server.URL, false)
+	if err := client.EnsureTemplate(context.Background()); err == nil {
+		t.Fatal("EnsureTemplate succeeded against a 403")
+	}
+	if _, err := client.Index(context.Background(), "va", time.Now(), testItems(1)); err == nil {
+		t.Fatal("Index succeeded without a template")
+	}
+}
+
+func TestIndexBulkOp(t *testing.T) {
+	tests := []struct {
+		dataStream bool
+		op         string
+	}{
+		{false, "index"},
+		{true, "create"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			fake, server := newFakeES(t, func(call int, req bulkRequest) (int, interface{}) {
+				codes := make([]int, len(req.ops))
+				for i := range codes {
+					codes[i] = http.StatusCreated
+				}
+				return http.StatusOK, statuses(tt.op, codes...)
+			})
+			client := testClient(t, server.URL, tt.dataStream)
+
+			result, err := client.Index(context.Background(), "va", time.Now(), testItems(3))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Indexed != 3 || result.Failed != 0 {
+				t.Errorf("result = %+v, want 3 indexed", result)
+			}
+			for _, op := range fake.bulks[0].ops {
+				if op != tt.op {
+					t.Errorf("bulk op = %q, want %q", op, tt.op)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexRetriesRequestOn429And5xx(t *testing.T) {
+	fake, server := newFakeES(t, func(call int, req bulkRequest) (int, interface{}) {
+		switch call {
+		case 1:
+			return http.StatusTooManyRequests, map[string]string{"error": "slow down"}
+		case 2:
+			return http.StatusServiceUnavailable, map[string]string{"error": "unavailable"}
+		}
+		return http.StatusOK, statuses("index", http.StatusCreated, http.StatusCreated)
+	})
+	client := testClient(t, server.URL, false)
+
+	result, err := client.Index(context.Background(), "va", time.Now(), testItems(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Indexed != 2 {
+		t.Errorf("indexed = %d, want 2", result.Indexed)
+	}
+	if len(fake.bulks) != 3 {
+		t.Errorf("bulk calls = %d, want 3", len(fake.bulks))
+	}
+}
+
+func TestIndexGivesUpAfterMaxRetries(t *testing.T) {
+	fake, server := newFakeES(t, func(call int, req bulkRequest) (int, interface{}) {
+		return http.StatusBadGateway, map[string]string{"error": "bad gateway"}
+	})
+	client := testClient(t, server.URL, false)
+
+	result, err := client.Index(context.Background(), "va", time.Now(), testItems(2))
+	if err == nil {
+		t.Fatal("Index succeeded against a failing server")
+	}
+	if result.Failed != 2 {
+		t.Errorf("failed = %d, want 2", result.Failed)
+	}
+	if len(fake.bulks) != 3 {
+		t.Errorf("bulk calls = %d, want MaxRetries (3)", len(fake.bulks))
+	}
+}
+
+func TestIndexNoRetryOnClientError(t *testing.T) {
+	fake, server := newFakeES(t, func(call int, req bulkRequest) (int, interface{}) {
+		return http.StatusUnauthorized, map[string]string{"error": "unauthorized"}
+	})
+	client := testClient(t, server.URL, false)
+
+	if _, err := client.Index(context.Background(), "va", time.Now(), testItems(1)); err == nil {
+		t.Fatal("Index succeeded against a 401")
+	}
+	if len(fake.bulks) != 1 {
+		t.Errorf("bulk calls = %d, want 1", len(fake.bulks))
+	}
+}
+
+func TestIndexRetriesOnlyFailedDocuments(t *testing.T) {
+	fake, server := newFakeES(t, func(call int, req bulkRequest) (int, interface{}) {
+		if call == 1 {
+			// 0 created, 1 throttled, 2 rejected, 3 server error, 4 already present
+			return http.StatusOK, statuses("index", http.StatusCreated, http.StatusTooManyRequests,
+				http.StatusBadRequest, http.StatusInternalServerError, http.StatusConflict)
+		}
+		return http.StatusOK, statuses("index", http.StatusCreated, http.StatusCreated)
+	})
+	client := testClient(t, server.URL, false)
+
+	result, err := client.Index(context.Background(), "va", time.Now(), testItems(5))
+	if err == nil {
+		t.Error("Index reported success with a rejected document")
+	}
+	if result.Indexed != 4 || result.Failed != 1 {
+		t.Errorf("result = %+v, want 4 indexed and 1 failed", result)
+	}
+
+	if len(fake.bulks) != 2 {
+		t.Fatalf("bulk calls = %d, want 2", len(fake.bulks))
+	}
+	first, retried := fake.bulks[0].ids, fake.bulks[1].ids
+	if len(retried) != 2 || retried[0] != first[1] || retried[1] != first[3] {
+		t.Errorf("retried documents = %v, want %v", retried, []string{first[1], first[3]})
+	}
+}
@@ -0,0 +1,83 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Template returns the index template for the configured index. Dotted
+// field names in InventoryItem (geo.location, bt.productId) are stored as
+// objects by Elasticsearch, so the mapping nests them the same way.
+func (c *Client) Template() map[string]interface{} {
+	keyword := map[string]interface{}{"type": "keyword"}
+
+	template := map[string]interface{}{
+		"index_patterns": []string{c.config.Index + "*"},
+		"priority":       200,
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				// Any bt.* string added later is a keyword too
+				"dynamic_templates": []map[string]interface{}{
+					{"bt_keywords": map[string]interface{}{
+						"path_match":         "bt.*",
+						"match_mapping_type": "string",
+						"mapping":            keyword,
+					}},
+				},
+				"properties": map[string]interface{}{
+					"@timestamp": map[string]interface{}{"type": "date"},
+					"geo": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"location": map[string]interface{}{"type": "geo_point"},
+						},
+					},
+					"bt": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"productName": map[string]interface{}{
+								"type":   "keyword",
+								"fields": map[string]interface{}{"text": map[string]interface{}{"type": "text"}},
+							},
+							"productId":   keyword,
+							"quantity":    map[string]interface{}{"type": "integer"},
+							"storeId":     keyword,
+							"storeurl":    keyword,
+							"state":       keyword,
+							"county":      keyword,
+							"listingType": keyword,
+							"tracker":     keyword,
+							"run":         map[string]interface{}{"type": "date"},
+						},
+					},
+				},
+			},
+		},
+		"_meta": map[string]interface{}{"managed_by": "bourbontracker"},
+	}
+	if c.config.DataStream {
+		template["data_stream"] = map[string]interface{}{}
+	}
+	return template
+}
+
+// EnsureTemplate installs (or updates) the index template. It must run
+// before the first write, since an index or data stream created without it
+// gets dynamic mappings that can't be changed afterwards.
+func (c *Client) EnsureTemplate(ctx context.Context) error {
+	body, err := json.Marshal(c.Template())
+	if err != nil {
+		return err
+	}
+
+	status, respBody, err := c.do(ctx, http.MethodPut, "/_index_template/"+c.config.Index, "application/json", body)
+	if err != nil {
+		return fmt.Errorf("failed to install index template: %w", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to install index template: status %d: %s", status, truncate(respBody))
+	}
+
+	c.templateInstalled = true
+	return nil
+}
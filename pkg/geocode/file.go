@@ -0,0 +1,203 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// Overrides are hand-entered coordinates for addresses a geocoder gets wrong
+// or can't find. The file is a JSON object of address to location:
+//
+//	{"4501 Vineyrd Pine Ln. Rolesville, NC 27571": {"lat": 35.9319, "lon": -78.4466}}
+type Overrides map[string]tracker.Location
+
+// LoadOverrides reads an overrides file. A missing file yields no overrides.
+func LoadOverrides(path string) (Overrides, error) {
+	entries, err := readLocations(path)
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(Overrides, len(entries))
+	for address, location := range entries {
+		overrides[normalize(address)] = location
+	}
+	return overrides, nil
+}
+
+// Geocode returns the override for address, or ErrNotFound
+func (o Overrides) Geocode(ctx context.Context, address string) (tracker.Location, error) {
+	if location, ok := o[normalize(address)]; ok {
+		return location, nil
+	}
+	return tracker.Location{}, ErrNotFound
+}
+
+// Cache remembers geocoding results between runs, so each address is only
+// looked up once. It uses the same file format as Overrides.
+type Cache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]tracker.Location // Keyed by the address as given
+	keys    map[string]string           // Normalized address to entries key
+	dirty   bool
+}
+
+// LoadCache reads a cache file. A missing file yields an empty cache, which
+// Save creates.
+func LoadCache(path string) (*Cache, error) {
+	entries, err := readLocations(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string, len(entries))
+	for address := range entries {
+		keys[normalize(address)] = address
+	}
+	return &Cache{path: path, entries: entries, keys: keys}, nil
+}
+
+// Wrap returns a geocoder that answers from the cache, falling back to
+// geocoder and caching what it finds
+func (c *Cache) Wrap(geocoder Geocoder) Geocoder {
+	return cachedGeocoder{cache: c, geocoder: geocoder}
+}
+
+// Len returns the number of cached addresses
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Save writes the cache file if anything was added since it was loaded
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+	if err := writeLocations(c.path, c.entries); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+func (c *Cache) get(address string) (tracker.Location, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[normalize(address)]
+	if !ok {
+		return tracker.Location{}, false
+	}
+	return c.entries[key], true
+}
+
+func (c *Cache) put(address string, location tracker.Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[address] = location
+	c.keys[normalize(address)] = address
+	c.dirty = true
+}
+
+// cachedGeocoder is a geocoder backed by a Cache
+type cachedGeocoder struct {
+	cache    *Cache
+	geocoder Geocoder
+}
+
+func (g cachedGeocoder) Geocode(ctx context.Context, address string) (tracker.Location, error) {
+	if location, ok := g.cache.get(address); ok {
+		return location, nil
+	}
+
+	location, err := g.geocoder.Geocode(ctx, address)
+	if err != nil {
+		return location, err
+	}
+	g.cache.put(address, location)
+	return location, nil
+}
+
+// readLocations reads a JSON object of address to location. A missing file
+// is empty.
+func readLocations(path string) (map[string]tracker.Location, error) {
+	entries := make(map[string]tracker.Location)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// writeLocations atomically writes a JSON object of address to location,
+// sorted by address so the file diffs cleanly
+func writeLocations(path string, entries map[string]tracker.Location) error {
+	addresses := make([]string, 0, len(entries))
+	for address := range entries {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	// encoding/json sorts map keys, but build the object explicitly so the
+	// file gets one address per line
+	var data []byte
+	data = append(data, "{\n"...)
+	for i, address := range addresses {
+		key, err := json.Marshal(address)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(entries[address])
+		if err != nil {
+			return err
+		}
+		data = append(data, "  "...)
+		data = append(data, key...)
+		data = append(data, ": "...)
+		data = append(data, value...)
+		if i < len(addresses)-1 {
+			data = append(data, ',')
+		}
+		data = append(data, '\n')
+	}
+	data = append(data, "}\n"...)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,41 @@
+// Package geocode turns store addresses into coordinates
+package geocode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// ErrNotFound is returned when a geocoder has no result for an address
+var ErrNotFound = errors.New("address not found")
+
+// Geocoder looks up the coordinates of an address
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (tracker.Location, error)
+}
+
+// Chain tries each geocoder in turn, returning the first result. Geocoders
+// that return ErrNotFound are skipped; any other error stops the chain.
+type Chain []Geocoder
+
+// Geocode returns the first geocoder's result for address
+func (c Chain) Geocode(ctx context.Context, address string) (tracker.Location, error) {
+	for _, geocoder := range c {
+		location, err := geocoder.Geocode(ctx, address)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return location, err
+	}
+	return tracker.Location{}, fmt.Errorf("%q: %w", address, ErrNotFound)
+}
+
+// normalize makes addresses that differ only in case or spacing equal, for
+// use as cache and override keys
+func normalize(address string) string {
+	return strings.ToLower(strings.Join(strings.Fields(address), " "))
+}
@@ -0,0 +1,205 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// fakeNominatim stands in for a Nominatim server, answering /search with
+// places[q] (an empty list if q is unknown) and recording each request
+type fakeNominatim struct {
+	places map[string]string // Query to JSON response body
+
+	mu         sync.Mutex
+	times      []time.Time
+	userAgents []string
+}
+
+func (f *fakeNominatim) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.times = append(f.times, time.Now())
+	f.userAgents = append(f.userAgents, r.Header.Get("User-Agent"))
+	f.mu.Unlock()
+
+	if r.URL.Path != "/search" || r.URL.Query().Get("format") != "json" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	body, ok := f.places[r.URL.Query().Get("q")]
+	if !ok {
+		body = "[]"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(body))
+}
+
+func (f *fakeNominatim) requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.times)
+}
+
+func newFakeNominatim(t *testing.T, places map[string]string) (*fakeNominatim, *httptest.Server) {
+	fake := &fakeNominatim{places: places}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+const raleigh = "7200 Sandy Fork Rd. Raleigh, NC 27609"
+
+func TestNominatimGeocode(t *testing.T) {
+	fake, server := newFakeNominatim(t, map[string]string{
+		raleigh: `[{"lat": "35.8801", "lon": "-78.6276", "display_name": "Sandy Fork Road"}]`,
+	})
+	n := NewNominatim(server.URL+"/", "bourbontracker-test/1.0")
+	n.Interval = 50 * time.Millisecond
+
+	first := time.Now()
+	location, err := n.Geocode(context.Background(), raleigh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location != (tracker.Location{Latitude: 35.8801, Longitude: -78.6276}) {
+		t.Errorf("location = %+v, want 35.8801,-78.6276", location)
+	}
+
+	if _, err := n.Geocode(context.Background(), "nowhere"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("empty result error = %v, want ErrNotFound", err)
+	}
+	// Measured on our side: the server sees the first request late by its
+	// connection setup, so arrival times can land slightly under Interval
+	elapsed := time.Since(first)
+
+	if fake.requests() != 2 {
+		t.Fatalf("requests = %d, want 2", fake.requests())
+	}
+	for _, ua := range fake.userAgents {
+		if ua != "bourbontracker-test/1.0" {
+			t.Errorf("User-Agent = %q, want bourbontracker-test/1.0", ua)
+		}
+	}
+	if elapsed < n.Interval {
+		t.Errorf("two requests took %v, want at least %v", elapsed, n.Interval)
+	}
+}
+
+func TestNominatimErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"server error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}},
+		{"malformed body", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<html>"))
+		}},
+		{"bad coordinates", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"lat": "north", "lon": "-78.6"}]`))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			_, err := NewNominatim(server.URL, "test").Geocode(context.Background(), raleigh)
+			if err == nil || errors.Is(err, ErrNotFound) {
+				t.Errorf("error = %v, want a failure other than ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestCacheSkipsLookup(t *testing.T) {
+	fake, server := newFakeNominatim(t, map[string]string{
+		raleigh: `[{"lat": "35.8801", "lon": "-78.6276"}]`,
+	})
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	cache, err := LoadCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := NewNominatim(server.URL, "test")
+	n.Interval = 0
+	geocoder := cache.Wrap(n)
+
+	// Case and spacing don't matter to the cache
+	for _, address := range []string{raleigh, "7200 SANDY FORK RD.  Raleigh, NC 27609"} {
+		if _, err := geocoder.Geocode(context.Background(), address); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fake.requests() != 1 {
+		t.Errorf("requests = %d, want 1 (second lookup cached)", fake.requests())
+	}
+
+	// A saved cache answers in the next run too
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.Wrap(n).Geocode(context.Background(), raleigh); err != nil {
+		t.Fatal(err)
+	}
+	if fake.requests() != 1 {
+		t.Errorf("requests = %d after reload, want 1", fake.requests())
+	}
+}
+
+func TestOverridesTakePrecedence(t *testing.T) {
+	fake, server := newFakeNominatim(t, map[string]string{
+		raleigh: `[{"lat": "35.8801", "lon": "-78.6276"}]`,
+	})
+	dir := t.TempDir()
+
+	overridesPath := filepath.Join(dir, "overrides.json")
+	if err := os.WriteFile(overridesPath, []byte(`{"7200 Sandy Fork Rd. Raleigh, NC 27609": {"lat": 35.9, "lon": -78.6}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	overrides, err := LoadOverrides(overridesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache already holds the geocoder's (wrong) answer
+	cache, err := LoadCache(filepath.Join(dir, "cache.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.put(raleigh, tracker.Location{Latitude: 1, Longitude: 1})
+
+	n := NewNominatim(server.URL, "test")
+	n.Interval = 0
+	chain := Chain{overrides, cache.Wrap(n)}
+
+	location, err := chain.Geocode(context.Background(), raleigh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location != (tracker.Location{Latitude: 35.9, Longitude: -78.6}) {
+		t.Errorf("location = %+v, want the override", location)
+	}
+
+	// Addresses without an override fall through to the geocoder
+	if _, err := chain.Geocode(context.Background(), "nowhere"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("error = %v, want ErrNotFound", err)
+	}
+	if fake.requests() != 1 {
+		t.Errorf("requests = %d, want 1", fake.requests())
+	}
+}
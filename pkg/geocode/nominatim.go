@@ -0,0 +1,111 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// DefaultNominatimURL is the public OpenStreetMap Nominatim server
+const DefaultNominatimURL = "https://nominatim.openstreetmap.org"
+
+// Nominatim geocodes with a Nominatim-compatible /search endpoint. The public
+// server's usage policy allows one request per second and requires a
+// User-Agent that identifies the application.
+type Nominatim struct {
+	BaseURL   string        // Server URL, without /search
+	UserAgent string        // Sent with every request
+	Interval  time.Duration // Minimum time between requests
+	Client    *http.Client
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewNominatim returns a geocoder for the Nominatim server at baseURL, limited
+// to one request per second
+func NewNominatim(baseURL, userAgent string) *Nominatim {
+	return &Nominatim{
+		BaseURL:   strings.TrimSuffix(baseURL, "/"),
+		UserAgent: userAgent,
+		Interval:  time.Second,
+		Client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// nominatimPlace is the part of a Nominatim search result we use. Coordinates
+// are strings in Nominatim's JSON.
+type nominatimPlace struct {
+	Lat         string `json:"lat"`
+	Lon         string `json:"lon"`
+	DisplayName string `json:"display_name"`
+}
+
+// Geocode returns the coordinates of the best match for address
+func (n *Nominatim) Geocode(ctx context.Context, address string) (tracker.Location, error) {
+	if err := n.wait(ctx); err != nil {
+		return tracker.Location{}, err
+	}
+
+	query := url.Values{}
+	query.Set("q", address)
+	query.Set("format", "json")
+	query.Set("limit", "1")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", n.BaseURL+"/search?"+query.Encode(), nil)
+	if err != nil {
+		return tracker.Location{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", n.UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return tracker.Location{}, fmt.Errorf("failed to geocode %q: %w", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return tracker.Location{}, fmt.Errorf("failed to geocode %q: unexpected status code: %d", address, resp.StatusCode)
+	}
+
+	var places []nominatimPlace
+	if err := json.NewDecoder(resp.Body).Decode(&places); err != nil {
+		return tracker.Location{}, fmt.Errorf("failed to parse geocoding response for %q: %w", address, err)
+	}
+	if len(places) == 0 {
+		return tracker.Location{}, fmt.Errorf("%q: %w", address, ErrNotFound)
+	}
+
+	lat, err := strconv.ParseFloat(places[0].Lat, 64)
+	if err != nil {
+		return tracker.Location{}, fmt.Errorf("invalid latitude %q for %q", places[0].Lat, address)
+	}
+	lon, err := strconv.ParseFloat(places[0].Lon, 64)
+	if err != nil {
+		return tracker.Location{}, fmt.Errorf("invalid longitude %q for %q", places[0].Lon, address)
+	}
+	return tracker.Location{Latitude: lat, Longitude: lon}, nil
+}
+
+// wait blocks until Interval has passed since the previous request
+func (n *Nominatim) wait(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if !n.last.IsZero() {
+		if err := tracker.Sleep(ctx, n.Interval-time.Since(n.last)); err != nil {
+			return err
+		}
+	}
+	n.last = time.Now()
+	return nil
+}
@@ -0,0 +1,549 @@
+// Package history keeps a compact, append-only record of inventory over time.
+//
+// Each tracker run is stored as a delta against the previous state for the
+// same source: items that appeared or changed are written in full, items that
+// disappeared are written as keys. The log is a file of concatenated JSON
+// records, so it needs no database and can be copied or inspected with jq.
+// Queries replay the log from the start. Append instead starts from a
+// checkpoint of the latest state saved next to the log, so runs don't get
+// slower as the log grows.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// Key identifies a product at a store
+type Key struct {
+	ProductID string `json:"p"`
+	StoreID   string `json:"s"`
+}
+
+// keyOf returns the key for an inventory item
+func keyOf(item tracker.InventoryItem) Key {
+	return Key{ProductID: item.ProductID, StoreID: item.StoreID}
+}
+
+// Record is a single run's delta for one source. Moves are applied before
+// upserts and removals.
+type Record struct {
+	Time    time.Time               `json:"time"`
+	Source  string                  `json:"source"` // Tracker name, e.g. "va"
+	RunID   string                  `json:"run_id,omitempty"`
+	Moved   []Move                  `json:"moved,omitempty"`
+	Upserts []tracker.InventoryItem `json:"upserts,omitempty"`
+	Removed []Key                   `json:"removed,omitempty"`
+}
+
+// Move re-keys an item whose identity changed between releases (see
+// tracker.Canonicalizer) without recording it as removed and re-added
+type Move struct {
+	From Key                   `json:"from"`
+	Item tracker.InventoryItem `json:"item"` // The item under its new identity
+}
+
+// ChangeKind describes how a product/store pair changed between two times
+type ChangeKind string
+
+const (
+	Added    ChangeKind = "added"
+	Removed  ChangeKind = "removed"
+	Modified ChangeKind = "changed"
+)
+
+// Change is a net difference between the state at two points in time
+type Change struct {
+	Kind        ChangeKind            `json:"kind"`
+	Source      string                `json:"source"`
+	Item        tracker.InventoryItem `json:"item"` // Latest known item (the old one for removals)
+	OldQuantity int                   `json:"old_quantity"`
+	NewQuantity int                   `json:"new_quantity"`
+}
+
+// Point is one entry in a product/store timeline
+type Point struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`
+	Quantity int       `json:"quantity"` // 0 once the product is gone
+	InStock  bool      `json:"in_stock"`
+}
+
+// Log is an inventory history file
+type Log struct {
+	path string
+	mu   sync.Mutex
+}
+
+// checkpoint is the latest state of every source, saved alongside the log so
+// Append only has to replay the records written after it
+type checkpoint struct {
+	Offset  int64                              `json:"offset"` // Size of the log the state reflects
+	Sources map[string][]tracker.InventoryItem `json:"sources"`
+}
+
+// Open returns the history log at path. The file is created on first Append.
+func Open(path string) *Log {
+	return &Log{path: path}
+}
+
+// checkpointPath returns the file the log's checkpoint is kept in
+func (l *Log) checkpointPath() string {
+	return l.path + ".checkpoint"
+}
+
+// Path returns the file backing the log
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append records a run for source, storing only what changed since the last
+// run. Pairs outside coverage are left as they were rather than marked
+// removed, so a store that failed to scan keeps its history intact. A nil
+// coverage covers everything. Append returns the written record, or nil if
+// nothing changed.
+func (l *Log) Append(source string, at time.Time, items []tracker.InventoryItem, coverage *tracker.Coverage) (*Record, error) {
+	return l.append(&Record{Time: at, Source: source}, items, coverage, nil)
+}
+
+// AppendEnvelope records a run read from (or about to be written as) an
+// inventory envelope, taking the source, time, run ID and coverage from its
+// metadata. Legacy arrays carry no metadata and must go through Append.
+//
+// If canonicalizer is non-nil, the recorded state is rewritten to the
+// tracker's current item identities before diffing, and any items whose key
+// changed are recorded as moved rather than removed and re-added.
+func (l *Log) AppendEnvelope(envelope *tracker.Envelope, canonicalizer tracker.Canonicalizer) (*Record, error) {
+	if envelope.Legacy() || envelope.Tracker == "" {
+		return nil, fmt.Errorf("inventory has no run metadata; use Append with a source and time")
+	}
+	record := &Record{Time: envelope.Finished, Source: envelope.Tracker, RunID: envelope.RunID}
+	return l.append(record, envelope.Items, envelope.Coverage, canonicalizer)
+}
+
+// append fills in record's delta against the previous state of its source
+// and writes it, returning nil if nothing changed
+func (l *Log) append(record *Record, items []tracker.InventoryItem, coverage *tracker.Coverage, canonicalizer tracker.Canonicalizer) (*Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	states, end, stale, err := l.latest()
+	if err != nil {
+		return nil, err
+	}
+	previous := states[record.Source]
+	if canonicalizer != nil {
+		record.Moved = canonicalize(previous, canonicalizer)
+	}
+
+	current := make(map[Key]tracker.InventoryItem, len(items))
+	for _, item := range items {
+		key := keyOf(item)
+		current[key] = item
+
+		if old, ok := previous[key]; !ok || !sameStock(old, item) {
+			record.Upserts = append(record.Upserts, item)
+		}
+	}
+
+	for key := range previous {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		if coverage.Covers(key.ProductID, key.StoreID) {
+			record.Removed = append(record.Removed, key)
+		}
+	}
+
+	if len(record.Moved) == 0 && len(record.Upserts) == 0 && len(record.Removed) == 0 {
+		if stale {
+			l.saveCheckpoint(states, end)
+		}
+		return nil, nil
+	}
+
+	sort.Slice(record.Removed, func(i, j int) bool {
+		if record.Removed[i].StoreID != record.Removed[j].StoreID {
+			return record.Removed[i].StoreID < record.Removed[j].StoreID
+		}
+		return record.Removed[i].ProductID < record.Removed[j].ProductID
+	})
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+
+	if end, err := file.Seek(0, io.SeekCurrent); err == nil {
+		apply(states, record)
+		l.saveCheckpoint(states, end)
+	}
+
+	return record, nil
+}
+
+// StateAt returns the inventory as it stood at time at. An empty source
+// returns every source's inventory.
+func (l *Log) StateAt(source string, at time.Time) ([]tracker.InventoryItem, error) {
+	states, err := l.replay(func(r *Record) bool {
+		return (source == "" || r.Source == source) && !r.Time.After(at)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return flatten(states), nil
+}
+
+// Changes returns the net changes between the states at from and to
+func (l *Log) Changes(source string, from, to time.Time) ([]Change, error) {
+	before, err := l.replay(func(r *Record) bool {
+		return (source == "" || r.Source == source) && !r.Time.After(from)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := l.replay(func(r *Record) bool {
+		return (source == "" || r.Source == source) && !r.Time.After(to)
+	}, func(r *Record) {
+		// Carry items that moved during the window over to their new keys,
+		// so a move alone isn't reported as a removal and an addition
+		if !r.Time.After(from) {
+			return
+		}
+		var moved []tracker.InventoryItem
+		for _, m := range r.Moved {
+			if old, ok := before[r.Source][m.From]; ok {
+				delete(before[r.Source], m.From)
+				item := m.Item
+				item.Quantity = old.Quantity
+				moved = append(moved, item)
+			}
+		}
+		for _, item := range moved {
+			before[r.Source][keyOf(item)] = item
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for src, items := range after {
+		for key, item := range items {
+			old, existed := before[src][key]
+			switch {
+			case !existed:
+				changes = append(changes, Change{Kind: Added, Source: src, Item: item, NewQuantity: item.Quantity})
+			case !sameStock(old, item):
+				changes = append(changes, Change{Kind: Modified, Source: src, Item: item, OldQuantity: old.Quantity, NewQuantity: item.Quantity})
+			}
+		}
+	}
+	for src, items := range before {
+		for key, item := range items {
+			if _, ok := after[src][key]; !ok {
+				changes = append(changes, Change{Kind: Removed, Source: src, Item: item, OldQuantity: item.Quantity})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i].Item, changes[j].Item
+		if a.StoreID != b.StoreID {
+			return a.StoreID < b.StoreID
+		}
+		return a.ProductID < b.ProductID
+	})
+	return changes, nil
+}
+
+// Timeline returns every recorded change for a product at a store, oldest
+// first, including changes recorded under the pair's keys before it moved
+func (l *Log) Timeline(productID, storeID string) ([]Point, error) {
+	type keyedPoint struct {
+		key   Key
+		point Point
+	}
+	type move struct {
+		from Key
+		at   time.Time
+	}
+
+	var recorded []keyedPoint
+	movedInto := make(map[Key][]move)
+
+	_, err := l.replay(func(r *Record) bool { return true }, func(r *Record) {
+		for _, m := range r.Moved {
+			to := keyOf(m.Item)
+			movedInto[to] = append(movedInto[to], move{from: m.From, at: r.Time})
+		}
+		for _, item := range r.Upserts {
+			recorded = append(recorded, keyedPoint{keyOf(item), Point{Time: r.Time, Source: r.Source, Quantity: item.Quantity, InStock: true}})
+		}
+		for _, removed := range r.Removed {
+			recorded = append(recorded, keyedPoint{removed, Point{Time: r.Time, Source: r.Source}})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Follow the pair back through its moves. An old key only belongs to the
+	// pair until it moved; a zero time means no limit.
+	until := make(map[Key]time.Time)
+	var follow func(key Key, limit time.Time)
+	follow = func(key Key, limit time.Time) {
+		if _, seen := until[key]; seen {
+			return
+		}
+		until[key] = limit
+		for _, m := range movedInto[key] {
+			if limit.IsZero() || !m.at.After(limit) {
+				follow(m.from, m.at)
+			}
+		}
+	}
+	follow(Key{ProductID: productID, StoreID: storeID}, time.Time{})
+
+	var points []Point
+	for _, kp := range recorded {
+		limit, ok := until[kp.key]
+		if ok && (limit.IsZero() || !kp.point.Time.After(limit)) {
+			points = append(points, kp.point)
+		}
+	}
+	return points, nil
+}
+
+// replay folds every record accepted by include into per-source state, calling
+// visit (if non-nil) for each accepted record in file order
+func (l *Log) replay(include func(*Record) bool, visit func(*Record)) (map[string]map[Key]tracker.InventoryItem, error) {
+	states := make(map[string]map[Key]tracker.InventoryItem)
+	if _, err := l.replayFrom(states, 0, include, visit); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// replayFrom folds the records from byte offset onwards into states, like
+// replay, and returns the offset of the end of the log
+func (l *Log) replayFrom(states map[string]map[Key]tracker.InventoryItem, offset int64, include func(*Record) bool, visit func(*Record)) (int64, error) {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	decoder := json.NewDecoder(file)
+	for n := 1; ; n++ {
+		var record Record
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to read history record %d in %s: %w", n, l.path, err)
+		}
+
+		if !include(&record) {
+			continue
+		}
+		if visit != nil {
+			visit(&record)
+		}
+		apply(states, &record)
+	}
+
+	// The decoder has read to the end of the file
+	return file.Seek(0, io.SeekCurrent)
+}
+
+// apply folds a record into per-source state
+func apply(states map[string]map[Key]tracker.InventoryItem, record *Record) {
+	state := states[record.Source]
+	if state == nil {
+		state = make(map[Key]tracker.InventoryItem)
+		states[record.Source] = state
+	}
+	for _, move := range record.Moved {
+		delete(state, move.From)
+	}
+	for _, move := range record.Moved {
+		state[keyOf(move.Item)] = move.Item
+	}
+	for _, item := range record.Upserts {
+		state[keyOf(item)] = item
+	}
+	for _, key := range record.Removed {
+		delete(state, key)
+	}
+}
+
+// latest returns the current state of every source and the size of the log
+// it reflects. It starts from the checkpoint and replays only the records
+// written after it, falling back to the whole log if the checkpoint is
+// missing or doesn't match the log. stale reports whether the checkpoint
+// needs rewriting.
+func (l *Log) latest() (states map[string]map[Key]tracker.InventoryItem, end int64, stale bool, err error) {
+	all := func(*Record) bool { return true }
+
+	states, offset := l.loadCheckpoint()
+	if states != nil {
+		end, err = l.replayFrom(states, offset, all, nil)
+		if err == nil {
+			return states, end, end != offset, nil
+		}
+	}
+
+	// No usable checkpoint (the log may have been truncated or replaced)
+	states = make(map[string]map[Key]tracker.InventoryItem)
+	end, err = l.replayFrom(states, 0, all, nil)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return states, end, true, nil
+}
+
+// loadCheckpoint reads the saved state and the log offset it reflects, or
+// returns nil states if there is no readable checkpoint
+func (l *Log) loadCheckpoint() (map[string]map[Key]tracker.InventoryItem, int64) {
+	data, err := os.ReadFile(l.checkpointPath())
+	if err != nil {
+		return nil, 0
+	}
+
+	var saved checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Offset < 0 {
+		return nil, 0
+	}
+	if info, err := os.Stat(l.path); err != nil || info.Size() < saved.Offset {
+		return nil, 0
+	}
+
+	states := make(map[string]map[Key]tracker.InventoryItem, len(saved.Sources))
+	for source, items := range saved.Sources {
+		state := make(map[Key]tracker.InventoryItem, len(items))
+		for _, item := range items {
+			state[keyOf(item)] = item
+		}
+		states[source] = state
+	}
+	return states, saved.Offset
+}
+
+// saveCheckpoint writes the state of every source as of log offset end. The
+// checkpoint is only a cache, so a failed write is ignored: the next Append
+// replays whatever it is missing.
+func (l *Log) saveCheckpoint(states map[string]map[Key]tracker.InventoryItem, end int64) {
+	saved := checkpoint{Offset: end, Sources: make(map[string][]tracker.InventoryItem, len(states))}
+	for source, state := range states {
+		saved.Sources[source] = flatten(map[string]map[Key]tracker.InventoryItem{source: state})
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return
+	}
+
+	path := l.checkpointPath()
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return
+	}
+	os.Rename(tmp.Name(), path)
+}
+
+// canonicalize rewrites state to canonicalizer's current item identities in
+// place, returning a Move for every item whose key changed
+func canonicalize(state map[Key]tracker.InventoryItem, canonicalizer tracker.Canonicalizer) []Move {
+	keys := make([]Key, 0, len(state))
+	items := make([]tracker.InventoryItem, 0, len(state))
+	for _, item := range flatten(map[string]map[Key]tracker.InventoryItem{"": state}) {
+		keys = append(keys, keyOf(item))
+		items = append(items, item)
+	}
+
+	var moves []Move
+	for i, item := range canonicalizer.Canonicalize(items) {
+		if keyOf(item) != keys[i] {
+			moves = append(moves, Move{From: keys[i], Item: item})
+		}
+	}
+
+	// Remove every old key before adding the new ones, in case one item moves
+	// to a key another item is moving away from
+	for _, move := range moves {
+		delete(state, move.From)
+	}
+	for _, move := range moves {
+		state[keyOf(move.Item)] = move.Item
+	}
+	return moves
+}
+
+// flatten returns the items in states sorted by store then product
+func flatten(states map[string]map[Key]tracker.InventoryItem) []tracker.InventoryItem {
+	items := []tracker.InventoryItem{}
+	for _, state := range states {
+		for _, item := range state {
+			items = append(items, item)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].StoreID != items[j].StoreID {
+			return items[i].StoreID < items[j].StoreID
+		}
+		return items[i].ProductID < items[j].ProductID
+	})
+	return items
+}
+
+// sameStock reports whether two items describe the same stock, ignoring the
+// scan timestamp which changes on every run
+func sameStock(a, b tracker.InventoryItem) bool {
+	a.Timestamp = time.Time{}
+	b.Timestamp = time.Time{}
+	return a == b
+}
@@ -0,0 +1,181 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+func item(productID, storeID string, quantity int) tracker.InventoryItem {
+	return tracker.InventoryItem{ProductID: productID, StoreID: storeID, Quantity: quantity, State: "VA"}
+}
+
+func TestAppendUsesCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	log := Open(path)
+	start := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := log.Append("va", start, []tracker.InventoryItem{item("1", "a", 3), item("2", "a", 1)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(log.checkpointPath()); err != nil {
+		t.Fatalf("checkpoint not written: %v", err)
+	}
+
+	record, err := log.Append("va", start.Add(time.Hour), []tracker.InventoryItem{item("1", "a", 2)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Upserts) != 1 || record.Upserts[0].Quantity != 2 {
+		t.Errorf("upserts = %+v, want product 1 at quantity 2", record.Upserts)
+	}
+	if len(record.Removed) != 1 || record.Removed[0] != (Key{ProductID: "2", StoreID: "a"}) {
+		t.Errorf("removed = %+v, want product 2", record.Removed)
+	}
+
+	// The checkpoint must agree with a full replay of the log
+	states, end, stale, err := log.latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale || end != info.Size() {
+		t.Errorf("latest() end = %d stale = %v, want %d and fresh", end, stale, info.Size())
+	}
+	replayed, err := log.replay(func(*Record) bool { return true }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states["va"]) != 1 || len(replayed["va"]) != 1 || states["va"][Key{"1", "a"}] != replayed["va"][Key{"1", "a"}] {
+		t.Errorf("checkpoint state %+v does not match replayed state %+v", states, replayed)
+	}
+}
+
+func TestAppendCatchesUpStaleCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	log := Open(path)
+	start := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := log.Append("va", start, []tracker.InventoryItem{item("1", "a", 3)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	behind, err := os.ReadFile(log.checkpointPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Append("wake", start, []tracker.InventoryItem{item("9", "z", 1)}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Roll the checkpoint back, as if the second write had failed to save it
+	if err := os.WriteFile(log.checkpointPath(), behind, 0644); err != nil {
+		t.Fatal(err)
+	}
+	record, err := log.Append("wake", start.Add(time.Hour), []tracker.InventoryItem{item("9", "z", 1)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record != nil {
+		t.Errorf("record = %+v, want nil (the wake record was replayed from the log)", record)
+	}
+
+	states, offset := log.loadCheckpoint()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != info.Size() || len(states["wake"]) != 1 {
+		t.Errorf("checkpoint offset = %d states = %+v, want %d with the wake item", offset, states, info.Size())
+	}
+}
+
+func TestAppendIgnoresCheckpointForReplacedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	log := Open(path)
+	start := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := log.Append("va", start, []tracker.InventoryItem{item("1", "a", 3)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := log.Append("va", start.Add(time.Hour), []tracker.InventoryItem{item("1", "a", 3)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || len(record.Upserts) != 1 {
+		t.Errorf("record = %+v, want the item re-added to the emptied log", record)
+	}
+}
+
+// renamer moves every item at store "old" to store "new"
+type renamer struct{}
+
+func (renamer) Canonicalize(items []tracker.InventoryItem) []tracker.InventoryItem {
+	canonical := make([]tracker.InventoryItem, len(items))
+	for i, item := range items {
+		if item.StoreID == "old" {
+			item.StoreID = "new"
+		}
+		canonical[i] = item
+	}
+	return canonical
+}
+
+func TestAppendEnvelopeMovesCanonicalizedKeys(t *testing.T) {
+	log := Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	start := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := log.Append("wake", start, []tracker.InventoryItem{item("1", "old", 3)}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	run := &tracker.Envelope{
+		SchemaVersion: tracker.SchemaVersion,
+		Tracker:       "wake",
+		Finished:      start.Add(time.Hour),
+		Items:         []tracker.InventoryItem{item("1", "new", 3)},
+	}
+	record, err := log.AppendEnvelope(run, renamer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || len(record.Upserts) != 0 || len(record.Removed) != 0 {
+		t.Fatalf("record = %+v, want only a move", record)
+	}
+	if len(record.Moved) != 1 || record.Moved[0].From != (Key{"1", "old"}) || record.Moved[0].Item.StoreID != "new" {
+		t.Errorf("moved = %+v, want 1/old moved to 1/new", record.Moved)
+	}
+
+	state, err := log.StateAt("wake", start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state) != 1 || state[0].StoreID != "new" {
+		t.Errorf("state = %+v, want the item under its new key only", state)
+	}
+
+	changes, err := log.Changes("wake", start, start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("changes = %+v, want none for a move", changes)
+	}
+
+	points, err := log.Timeline("1", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || !points[0].Time.Equal(start) || points[0].Quantity != 3 {
+		t.Errorf("timeline = %+v, want the point recorded under the old key", points)
+	}
+}
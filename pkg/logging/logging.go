@@ -0,0 +1,98 @@
+// Package logging builds the structured logger shared by every command.
+//
+// Output goes to stderr as text or JSON (for Filebeat), at a level set by
+// -log-format/-log-level or the LOG_FORMAT/LOG_LEVEL environment variables.
+// Field names are shared across packages so logs can be queried uniformly.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Common field names
+const (
+	KeyTracker    = "tracker"
+	KeyRunID      = "run_id"
+	KeyStoreID    = "store_id"
+	KeyProductID  = "product_id"
+	KeyAttempt    = "attempt"
+	KeyStatus     = "status"
+	KeyDuration   = "duration"
+	KeyError      = "error"
+	KeyItems      = "items"
+	KeySubscriber = "subscriber"
+)
+
+// Options selects the log format and level
+type Options struct {
+	Format string // "text" or "json"
+	Level  string // "debug", "info", "warn" or "error"
+}
+
+// BindFlags registers -log-format and -log-level, defaulting to the
+// LOG_FORMAT and LOG_LEVEL environment variables
+func BindFlags(fs *flag.FlagSet) *Options {
+	opts := &Options{
+		Format: envOr("LOG_FORMAT", "text"),
+		Level:  envOr("LOG_LEVEL", "info"),
+	}
+	fs.StringVar(&opts.Format, "log-format", opts.Format, "Log format: text or json (env LOG_FORMAT)")
+	fs.StringVar(&opts.Level, "log-level", opts.Level, "Log level: debug, info, warn or error (env LOG_LEVEL)")
+	return opts
+}
+
+// New builds a logger writing to w
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", opts.Level)
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(opts.Format) {
+	case "text", "":
+		return slog.New(slog.NewTextHandler(w, handlerOpts)), nil
+	case "json":
+		// Filebeat (k8s/filebeat*.yml) reads the log line from "message"
+		handlerOpts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.MessageKey {
+				a.Key = "message"
+			}
+			return a
+		}
+		return slog.New(slog.NewJSONHandler(w, handlerOpts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q (want text or json)", opts.Format)
+	}
+}
+
+// Setup builds a stderr logger and installs it as the slog default, which
+// also routes the standard log package through it. Invalid options are fatal.
+func Setup(opts *Options) *slog.Logger {
+	logger, err := New(os.Stderr, *opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+	return logger
+}
+
+// Fatal logs msg at error level and exits
+func Fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// envOr returns the environment variable key, or fallback if unset
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
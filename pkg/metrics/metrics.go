@@ -0,0 +1,210 @@
+// Package metrics keeps counters and gauges and renders them in the Prometheus
+// text exposition format, for scraping over HTTP or for node_exporter's
+// textfile collector
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type is a Prometheus metric type
+type Type string
+
+const (
+	Counter Type = "counter"
+	Gauge   Type = "gauge"
+)
+
+// Registry holds metric families. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families []*Family
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Family is a metric with a fixed set of label names and one value per
+// combination of label values
+type Family struct {
+	name   string
+	help   string
+	typ    Type
+	labels []string
+
+	mu     *sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounter registers a counter family
+func (r *Registry) NewCounter(name, help string, labels ...string) *Family {
+	return r.register(name, help, Counter, labels)
+}
+
+// NewGauge registers a gauge family
+func (r *Registry) NewGauge(name, help string, labels ...string) *Family {
+	return r.register(name, help, Gauge, labels)
+}
+
+func (r *Registry) register(name, help string, typ Type, labels []string) *Family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, f := range r.families {
+		if f.name == name {
+			panic(fmt.Sprintf("metrics: %s registered twice", name))
+		}
+	}
+
+	f := &Family{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		mu:     &r.mu,
+		series: make(map[string]*series),
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// Add adds delta to the series with the given label values
+func (f *Family) Add(delta float64, labelValues ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.get(labelValues).value += delta
+}
+
+// Inc adds one to the series with the given label values
+func (f *Family) Inc(labelValues ...string) {
+	f.Add(1, labelValues...)
+}
+
+// Set sets the series with the given label values. It is meant for gauges.
+func (f *Family) Set(value float64, labelValues ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.get(labelValues).value = value
+}
+
+// Reset removes every series, so a gauge can be rebuilt from scratch without
+// leaving stale label combinations behind
+func (f *Family) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.series = make(map[string]*series)
+}
+
+// get returns the series for labelValues, creating it if needed. The caller
+// must hold the lock.
+func (f *Family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// WriteTo renders every family in the text exposition format, with series
+// sorted by label values so output is stable
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	var buf bytes.Buffer
+	for _, f := range r.families {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", f.name, f.typ)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			buf.WriteString(f.name)
+			if len(f.labels) > 0 {
+				buf.WriteByte('{')
+				for i, label := range f.labels {
+					if i > 0 {
+						buf.WriteByte(',')
+					}
+					fmt.Fprintf(&buf, "%s=\"%s\"", label, escapeLabel(s.labelValues[i]))
+				}
+				buf.WriteByte('}')
+			}
+			buf.WriteByte(' ')
+			buf.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+			buf.WriteByte('\n')
+		}
+	}
+	r.mu.Unlock()
+
+	return buf.WriteTo(w)
+}
+
+// Handler serves the registry for Prometheus scrapes
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// WriteFile writes the registry to path via a temporary file and rename, so
+// a textfile collector never reads a half-written file
+func (r *Registry) WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := r.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
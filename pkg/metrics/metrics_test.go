@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("bt_requests_total", "HTTP requests by tracker and status", "tracker", "status")
+	items := r.NewGauge("bt_items", `Items in stock; "quoted", a \ backslash`+"\nand a second line")
+	ratio := r.NewGauge("bt_coverage_ratio", "Share of stores covered", "tracker")
+	r.NewCounter("bt_unused_total", "Registered but never set")
+
+	requests.Inc("wake", "200")
+	requests.Add(2, "va", "200")
+	requests.Inc("va", "429")
+	requests.Inc(`odd "name"`+"\n"+`with \ slash`, "0")
+	items.Set(1520)
+	ratio.Set(0.75, "va")
+	ratio.Set(1e-7, "wake")
+
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	// Families in registration order, series sorted by label values
+	want := `# HELP bt_requests_total HTTP requests by tracker and status
+# TYPE bt_requests_total counter
+bt_requests_total{tracker="odd \"name\"\nwith \\ slash",status="0"} 1
+bt_requests_total{tracker="va",status="200"} 2
+bt_requests_total{tracker="va",status="429"} 1
+bt_requests_total{tracker="wake",status="200"} 1
+# HELP bt_items Items in stock; "quoted", a \\ backslash\nand a second line
+# TYPE bt_items gauge
+bt_items 1520
+# HELP bt_coverage_ratio Share of stores covered
+# TYPE bt_coverage_ratio gauge
+bt_coverage_ratio{tracker="va"} 0.75
+bt_coverage_ratio{tracker="wake"} 1e-07
+# HELP bt_unused_total Registered but never set
+# TYPE bt_unused_total counter
+`
+	if out.String() != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestReset(t *testing.T) {
+	r := NewRegistry()
+	stock := r.NewGauge("bt_stock", "Stock by store", "store")
+	stock.Set(3, "old-store")
+	stock.Reset()
+	stock.Set(1, "new-store")
+
+	var out strings.Builder
+	r.WriteTo(&out)
+	if strings.Contains(out.String(), "old-store") || !strings.Contains(out.String(), `bt_stock{store="new-store"} 1`) {
+		t.Errorf("after Reset:\n%s", out.String())
+	}
+}
+
+func TestHandlerAndWriteFile(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("bt_runs_total", "Runs").Inc()
+	want := "# HELP bt_runs_total Runs\n# TYPE bt_runs_total counter\nbt_runs_total 1\n"
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %s", got)
+	}
+	if rec.Body.String() != want {
+		t.Errorf("body = %q, want %q", rec.Body.String(), want)
+	}
+
+	path := filepath.Join(t.TempDir(), "bourbontracker.prom")
+	if err := r.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+}
+
+func TestMisuse(t *testing.T) {
+	mustPanic := func(name string, fn func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s did not panic", name)
+			}
+		}()
+		fn()
+	}
+
+	r := NewRegistry()
+	family := r.NewCounter("bt_total", "Total", "tracker")
+	mustPanic("registering a name twice", func() { r.NewGauge("bt_total", "Again") })
+	mustPanic("too few label values", func() { family.Inc() })
+	mustPanic("too many label values", func() { family.Inc("va", "extra") })
+}
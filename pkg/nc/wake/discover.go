@@ -0,0 +1,76 @@
+package wake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// DefaultDiscoveryTerms are searches for widely stocked products, whose
+// results list nearly every store
+var DefaultDiscoveryTerms = []string{"Buffalo Trace", "Weller", "Eagle Rare"}
+
+// DiscoverAddresses searches wakeabc.com for each term and returns every
+// store address listed in the results, sorted and without duplicates
+func DiscoverAddresses(ctx context.Context, client *http.Client, terms []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for i, term := range terms {
+		// Same pacing as the tracker, to avoid 429 errors
+		if i > 0 {
+			if err := tracker.Sleep(ctx, 1000*time.Millisecond); err != nil {
+				return nil, err
+			}
+		}
+
+		body, _, err := search(ctx, client, term)
+		if err != nil {
+			return nil, fmt.Errorf("search for %q: %w", term, err)
+		}
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse HTML: %w", err)
+		}
+		doc.Find("span.address").Each(func(_ int, s *goquery.Selection) {
+			addressHTML, _ := s.Html()
+			if address := parseAddress(addressHTML); address != "" {
+				seen[address] = true
+			}
+		})
+	}
+
+	addresses := make([]string, 0, len(seen))
+	for address := range seen {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+// UnknownAddresses returns the addresses of stores in an inventory that the
+// registry doesn't know. The tracker names such stores by their address.
+func (s *Stores) UnknownAddresses(items []tracker.InventoryItem) []string {
+	seen := make(map[string]bool)
+	var addresses []string
+	for _, item := range items {
+		if !isWakeItem(item) || item.StoreName == "" || seen[item.StoreName] {
+			continue
+		}
+		seen[item.StoreName] = true
+
+		if _, ok := s.Lookup(item.StoreID); ok {
+			continue
+		}
+		if _, ok := s.Resolve(item.StoreName); ok {
+			continue
+		}
+		addresses = append(addresses, item.StoreName)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
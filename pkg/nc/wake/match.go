@@ -0,0 +1,127 @@
+package wake
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// A search for one NC code can return several product blocks (size
+// variants, similarly named products). Each block is attributed by:
+//
+//  1. PLU: the searched product if it matches the searched NC code, another
+//     catalog product (searched separately) if it matches that one, and
+//     unmatched if it matches neither
+//  2. Size and normalized name against the searched product, for blocks
+//     without a PLU
+//
+// Anything else is unmatched and left out of the results.
+
+// matchKind is the outcome of attributing a search result block
+type matchKind int
+
+const (
+	matchSearched matchKind = iota // The product that was searched for
+	matchOther                     // A different catalog product
+	matchNone                      // Not in the catalog
+)
+
+// resultBlock is what a search result block says about its product
+type resultBlock struct {
+	name   string
+	plu    string // "" if the block has no PLU
+	sizeML int    // 0 if the block has no size
+}
+
+// matchBlock attributes a result block for a search of ncCode. For
+// matchOther it also returns the catalog code the block belongs to.
+func (t *Tracker) matchBlock(ncCode string, product NCProduct, block resultBlock) (matchKind, string) {
+	if block.plu != "" {
+		if sameCode(block.plu, ncCode) {
+			return matchSearched, ncCode
+		}
+		for code := range t.products {
+			if sameCode(block.plu, code) {
+				return matchOther, code
+			}
+		}
+		// A PLU identifies the product; don't guess from its name
+		return matchNone, ""
+	}
+
+	if wantML := parseSizeML(product.Size); wantML != 0 && block.sizeML != 0 && wantML != block.sizeML {
+		return matchNone, ""
+	}
+	if sameProductName(block.name, product.BrandName) {
+		return matchSearched, ncCode
+	}
+	return matchNone, ""
+}
+
+// sameCode compares PLU/NC codes, ignoring leading zeros
+func sameCode(a, b string) bool {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	return a != "" && a == b
+}
+
+var sizePattern = regexp.MustCompile(`(?i)(\d*\.?\d+)\s*(ml|l)\b`)
+
+// parseSizeML converts sizes like ".75L", "1.75 L" or "750ml" to
+// milliliters, returning 0 if text has no size
+func parseSizeML(text string) int {
+	matches := sizePattern.FindStringSubmatch(text)
+	if matches == nil {
+		return 0
+	}
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0
+	}
+	if strings.EqualFold(matches[2], "l") {
+		value *= 1000
+	}
+	return int(value + 0.5)
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// nameTokens returns the words of a product name, normalized, without its size
+func nameTokens(name string) []string {
+	name = strings.ToLower(tracker.NormalizeProductName(name))
+	name = sizePattern.ReplaceAllString(name, " ")
+	name = strings.NewReplacer("'", "", "’", "").Replace(name)
+	return strings.Fields(nonAlphanumeric.ReplaceAllString(name, " "))
+}
+
+// nameNoise are words that product listings add or leave out of the same
+// product's name
+var nameNoise = map[string]bool{"bourbon": true, "whiskey": true, "whisky": true}
+
+// sameProductName reports whether two names have the same words, ignoring
+// size and nameNoise, so "Blanton's Single Barrel" matches "Blantons Single
+// Barrel Bourbon" but not "Blanton's Single Barrel Gold" or "Blanton's"
+func sameProductName(a, b string) bool {
+	wordsA, wordsB := nameWords(a), nameWords(b)
+	if len(wordsA) == 0 || len(wordsA) != len(wordsB) {
+		return false
+	}
+	for word := range wordsA {
+		if !wordsB[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// nameWords returns the set of a name's words that identify the product
+func nameWords(name string) map[string]bool {
+	words := make(map[string]bool)
+	for _, token := range nameTokens(name) {
+		if !nameNoise[token] {
+			words[token] = true
+		}
+	}
+	return words
+}
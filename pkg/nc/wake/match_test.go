@@ -0,0 +1,82 @@
+package wake
+
+import "testing"
+
+func TestMatchBlock(t *testing.T) {
+	blantons := NCProduct{NCCode: "00026", BrandName: "Blanton's Single Barrel", Size: ".75L"}
+	wt := &Tracker{products: map[string]NCProduct{
+		"00026": blantons,
+		"00027": {NCCode: "00027", BrandName: "Blanton's Gold", Size: ".75L"},
+	}}
+
+	tests := []struct {
+		name     string
+		block    resultBlock
+		wantKind matchKind
+		wantCode string
+	}{
+		{"searched PLU", resultBlock{name: "Anything", plu: "26"}, matchSearched, "00026"},
+		{"other catalog PLU", resultBlock{name: "Blanton's Gold", plu: "27"}, matchOther, "00027"},
+		{"unknown PLU with the searched name", resultBlock{name: "Blanton's Single Barrel", plu: "99999"}, matchNone, ""},
+		{"unknown PLU of a variant", resultBlock{name: "Blanton's Single Barrel Gold", plu: "99999", sizeML: 750}, matchNone, ""},
+		{"no PLU, same name and size", resultBlock{name: "BLANTONS SINGLE BARREL BOURBON", sizeML: 750}, matchSearched, "00026"},
+		{"no PLU, no size", resultBlock{name: "Blanton's Single Barrel"}, matchSearched, "00026"},
+		{"no PLU, other size", resultBlock{name: "Blanton's Single Barrel", sizeML: 375}, matchNone, ""},
+		{"no PLU, variant name", resultBlock{name: "Blanton's Single Barrel Gold", sizeML: 750}, matchNone, ""},
+		{"no PLU, shorter name", resultBlock{name: "Blanton's", sizeML: 750}, matchNone, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, code := wt.matchBlock("00026", blantons, tt.block)
+			if kind != tt.wantKind || code != tt.wantCode {
+				t.Errorf("matchBlock = %d, %q; want %d, %q", kind, code, tt.wantKind, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestParseSizeML(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{".75L", 750},
+		{"1.75 L", 1750},
+		{"750ml", 750},
+		{"Size: 375 ML | PLU: 26", 375},
+		{"1L", 1000},
+		{"50ml", 50},
+		{"Limited", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseSizeML(tt.text); got != tt.want {
+			t.Errorf("parseSizeML(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSameProductName(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Blanton's Single Barrel", "Blantons Single Barrel", true},
+		{"Blanton's Single Barrel", "BLANTON'S SINGLE BARREL BOURBON", true},
+		{"Blanton's Single Barrel", "Blanton's Single Barrel 750ml", true},
+		{"Eagle Rare 10 Year", "Eagle Rare 10 Year Kentucky Straight Bourbon Whiskey", false},
+		{"Blanton's Single Barrel", "Blanton's Single Barrel Gold", false},
+		{"Blanton's Single Barrel", "Blanton's", false},
+		{"Blanton's Single Barrel", "Blanton's Gold", false},
+		{"Bourbon", "Whiskey", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := sameProductName(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameProductName(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package wake
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// Ensure Tracker refreshes incrementally
+var _ tracker.Incremental = (*Tracker)(nil)
+
+// Prepare limits the next run to products whose cached data is stale. If
+// nothing is stale, the run searches nothing.
+func (t *Tracker) Prepare(previous *tracker.Envelope) {
+	stale := t.productsNeedingUpdate(previous, time.Now())
+
+	// Not SetProductsToTrack, which treats an empty list as "track everything"
+	t.productsToTrack = make(map[string]bool, len(stale))
+	for _, ncCode := range stale {
+		t.productsToTrack[ncCode] = true
+	}
+}
+
+// Merge replaces cached Wake items for every product searched successfully
+// this run, so a product that sold out everywhere is dropped rather than kept
+// with stale stock. Products that were not searched (still fresh) or whose
+// search failed keep their cached items. Unsearched products still count as
+// covered; failed ones do not. The time each product was last searched is
+// carried forward in the coverage, so a product with nothing in stock isn't
+// searched again until it goes stale.
+func (t *Tracker) Merge(previous *tracker.Envelope, result *tracker.Result) []tracker.InventoryItem {
+	// Collect records each successful EventProduct as covered
+	searched := result.Coverage.Products
+
+	failed := make(map[string]bool)
+	for _, failure := range result.Failures {
+		failed[failure.ProductID] = true
+	}
+
+	covered := []string{}
+	for ncCode := range t.products {
+		if !failed[ncCode] {
+			covered = append(covered, ncCode)
+		}
+	}
+	sort.Strings(covered)
+
+	lastSearched := make(map[string]time.Time)
+	if previous.Coverage != nil {
+		for ncCode, at := range previous.Coverage.Searched {
+			if _, ok := t.products[ncCode]; ok {
+				lastSearched[ncCode] = at
+			}
+		}
+	}
+	for _, ncCode := range searched {
+		lastSearched[ncCode] = result.Started
+	}
+	result.Coverage = tracker.Coverage{Products: covered, Searched: lastSearched}
+
+	return tracker.MergeRefreshed(previous.Items, result.Items, searched, isWakeItem)
+}
+
+// productsNeedingUpdate determines which NC products need updating, by when
+// each was last searched. Snapshots written before search times were recorded
+// fall back to the newest item timestamp for the product.
+func (t *Tracker) productsNeedingUpdate(previous *tracker.Envelope, now time.Time) []string {
+	// Build map of product ID -> latest search
+	lastSearched := make(map[string]time.Time)
+	if previous.Coverage != nil {
+		for ncCode, at := range previous.Coverage.Searched {
+			lastSearched[ncCode] = at
+		}
+	}
+
+	for _, item := range previous.Items {
+		// Only consider NC Wake County items
+		if !isWakeItem(item) {
+			continue
+		}
+
+		productID := item.ProductID
+		if ts, exists := lastSearched[productID]; !exists || item.Timestamp.After(ts) {
+			lastSearched[productID] = item.Timestamp
+		}
+	}
+
+	// Determine which products need updating
+	var productsToUpdate []string
+
+	for ncCode, product := range t.products {
+		timestamp, exists := lastSearched[ncCode]
+		if !exists {
+			// Never searched before, needs update
+			productsToUpdate = append(productsToUpdate, ncCode)
+			continue
+		}
+
+		age := now.Sub(timestamp)
+
+		// "Listed" products: update every 24 hours
+		// Other types (Limited, Allocation, Barrel, Christmas): update every hour
+		needsUpdate := false
+		if product.ListingType == "Listed" {
+			needsUpdate = age > 24*time.Hour
+		} else {
+			needsUpdate = age > 1*time.Hour
+		}
+
+		if needsUpdate {
+			productsToUpdate = append(productsToUpdate, ncCode)
+		}
+	}
+
+	sort.Strings(productsToUpdate)
+	return productsToUpdate
+}
+
+// isWakeItem reports whether an item came from this tracker
+func isWakeItem(item tracker.InventoryItem) bool {
+	return item.State == "NC" && item.County == "Wake"
+}
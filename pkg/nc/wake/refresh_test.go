@@ -0,0 +1,80 @@
+package wake
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+func TestMergeRecordsSearchTimes(t *testing.T) {
+	wt := &Tracker{products: map[string]NCProduct{
+		"empty":  {NCCode: "empty", ListingType: "Limited"},
+		"failed": {NCCode: "failed", ListingType: "Limited"},
+		"fresh":  {NCCode: "fresh", ListingType: "Listed"},
+	}}
+	earlier := time.Date(2025, 12, 1, 8, 0, 0, 0, time.UTC)
+	started := earlier.Add(2 * time.Hour)
+
+	previous := &tracker.Envelope{Coverage: &tracker.Coverage{Searched: map[string]time.Time{
+		"failed":  earlier,
+		"fresh":   earlier,
+		"dropped": earlier, // No longer in the catalog
+	}}}
+	result := &tracker.Result{
+		Started:  started,
+		Coverage: tracker.Coverage{Products: []string{"empty"}},
+		Failures: []tracker.Failure{{ProductID: "failed"}},
+	}
+	wt.Merge(previous, result)
+
+	want := map[string]time.Time{"empty": started, "failed": earlier, "fresh": earlier}
+	if !reflect.DeepEqual(result.Coverage.Searched, want) {
+		t.Errorf("searched = %v, want %v", result.Coverage.Searched, want)
+	}
+	if !reflect.DeepEqual(result.Coverage.Products, []string{"empty", "fresh"}) {
+		t.Errorf("covered = %v, want [empty fresh]", result.Coverage.Products)
+	}
+}
+
+func TestProductsNeedingUpdate(t *testing.T) {
+	wt := &Tracker{products: map[string]NCProduct{
+		"limited": {NCCode: "limited", ListingType: "Limited"},
+		"listed":  {NCCode: "listed", ListingType: "Listed"},
+	}}
+	now := time.Date(2025, 12, 1, 12, 0, 0, 0, time.UTC)
+	searched := func(ages map[string]time.Duration) *tracker.Envelope {
+		times := make(map[string]time.Time)
+		for code, age := range ages {
+			times[code] = now.Add(-age)
+		}
+		return &tracker.Envelope{Coverage: &tracker.Coverage{Searched: times}}
+	}
+
+	tests := []struct {
+		name     string
+		previous *tracker.Envelope
+		want     []string
+	}{
+		{"never searched", &tracker.Envelope{}, []string{"limited", "listed"}},
+		{"searched empty, still fresh", searched(map[string]time.Duration{"limited": 30 * time.Minute, "listed": 2 * time.Hour}), nil},
+		{"hourly window passed", searched(map[string]time.Duration{"limited": 2 * time.Hour, "listed": 2 * time.Hour}), []string{"limited"}},
+		{"listed window passed", searched(map[string]time.Duration{"limited": time.Minute, "listed": 25 * time.Hour}), []string{"listed"}},
+		{
+			name: "legacy snapshot uses item timestamps",
+			previous: &tracker.Envelope{Items: []tracker.InventoryItem{
+				{ProductID: "limited", State: "NC", County: "Wake", Timestamp: now.Add(-10 * time.Minute)},
+			}},
+			want: []string{"listed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wt.productsNeedingUpdate(tt.previous, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("productsNeedingUpdate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
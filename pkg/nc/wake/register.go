@@ -0,0 +1,42 @@
+package wake
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// Config is the "wake" config block
+type Config struct {
+	Products string `json:"products"` // Path to NC products file
+	Stores   string `json:"stores"`   // Path to the store registry ("" for the built-in one)
+}
+
+// BindFlags registers the Wake County flags
+func (c *Config) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Products, "nc-products", c.Products, "Path to NC products file (Wake County)")
+	fs.StringVar(&c.Stores, "wake-stores", c.Stores, "Path to the Wake County store registry (default: built in)")
+}
+
+func init() {
+	tracker.Register(tracker.Definition{
+		Name:        "wake",
+		Description: "Wake County NC",
+		Output:      "inventory-nc.json",
+		Interval:    time.Hour, // Prepare only refreshes products past their staleness window
+		NewConfig: func() interface{} {
+			return &Config{
+				Products: "nc-products.json",
+			}
+		},
+		New: func(config interface{}) (tracker.StreamTracker, error) {
+			c, ok := config.(*Config)
+			if !ok {
+				return nil, fmt.Errorf("unexpected config type %T", config)
+			}
+			return New(c.Products, c.Stores)
+		},
+	})
+}
@@ -1,43 +1,360 @@
 package wake
 
-import "github.com/jeffspahr/bourbontracker/pkg/tracker"
-
-// Store coordinates for Wake County ABC stores
-var storeCoordinates = map[string]tracker.Location{
-	"7200 Sandy Fork Rd. Raleigh, NC 27609":              {Latitude: 35.8719206, Longitude: -78.6232906},
-	"3320 Olympia Dr. Raleigh, NC 27603":                 {Latitude: 35.7345287, Longitude: -78.6517657},
-	"1793 West Williams St. Apex, NC 27502":              {Latitude: 35.7593587, Longitude: -78.8765183},
-	"1940 Cinema Dr. Fuquay Varina, NC 27526":            {Latitude: 35.6018657, Longitude: -78.7531983},
-	"11360 Capital Blvd. Wake Forest, NC 27587":          {Latitude: 35.9541197, Longitude: -78.5395367},
-	"6301 Town Center Dr. Raleigh, NC 27614":             {Latitude: 35.870012, Longitude: -78.5776628},
-	"200 New Rand Road Garner, NC 27529":                 {Latitude: 35.7017438, Longitude: -78.60232},
-	"1601-61 Cross Link Rd. Raleigh, NC 27610":           {Latitude: 35.7461643, Longitude: -78.6230024},
-	"7336 Creedmoor Rd. Raleigh, NC 27613":               {Latitude: 35.8867296, Longitude: -78.6793864},
-	"1415 E. Williams St. Apex, NC 27617":                {Latitude: 35.7134437, Longitude: -78.8395803},
-	"7911 ACC Blvd. Raleigh, NC 27617":                   {Latitude: 35.9169256, Longitude: -78.7800074},
-	"100 Village Walk Dr Holly Springs, NC 27540":        {Latitude: 35.6389072, Longitude: -78.8353853},
-	"1505 Banyon Pl. Wendell, NC 27571":                  {Latitude: 35.7794, Longitude: -78.3687},
-	"4009 Davis Dr. Morrisville, NC 27560":               {Latitude: 35.8349365, Longitude: -78.8556205},
-	"3615 SW Cary Parkway Cary, NC 27513":                {Latitude: 35.781112, Longitude: -78.8384748},
-	"665 Cary Towne Blvd. Cary, NC 27511":                {Latitude: 35.7766327, Longitude: -78.766272},
-	"6494 Tryon Rd. Cary, NC 27511":                      {Latitude: 35.7436372, Longitude: -78.7623834},
-	"704 Money Ct. Knightdale, NC 27545":                 {Latitude: 35.7982975, Longitude: -78.4731725},
-	"4501 Vineyrd Pine Ln. Rolesville, NC 27571":         {Latitude: 35.9319, Longitude: -78.4466},
-	"209 S Salisbury St Raleigh, NC 27601":               {Latitude: 35.7780803, Longitude: -78.6400923},
-	"4215 The Circle at North Hills Rd Raleigh, NC 27609": {Latitude: 35.8378959, Longitude: -78.642488},
-	"2109-106 Avent Ferry Rd. Raleigh, NC 27606":         {Latitude: 35.7796029, Longitude: -78.6756501},
-	"1420 N Ardendell Dr. Zebulon, NC 27597":             {Latitude: 35.840154, Longitude: -78.3252935},
-	"6809 Davis Circle Raleigh, NC 27612":                {Latitude: 35.862667, Longitude: -78.7099899},
-	"420 Woodburn Rd. Raleigh, NC 27605":                 {Latitude: 35.7899326, Longitude: -78.6586902},
-	"2645 Appliance Ct. Raleigh, NC 27604":               {Latitude: 35.8125293, Longitude: -78.6018258},
-	"1222 New Bern Ave. Raleigh, NC 27401":               {Latitude: 35.8083489, Longitude: -78.6432},
-}
-
-// getStoreLocation returns the coordinates for a store address
-func getStoreLocation(address string) (tracker.Location, bool) {
-	if loc, ok := storeCoordinates[address]; ok {
-		return loc, true
-	}
-	// Return zero coordinates if not found
-	return tracker.Location{Latitude: 0, Longitude: 0}, false
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// defaultStoresJSON is the store registry shipped with the binary, used
+// unless -wake-stores points somewhere else
+//
+//go:embed stores.json
+var defaultStoresJSON []byte
+
+// Store is a Wake County ABC store in the store registry
+type Store struct {
+	ID       string           `json:"id"`                // Stable ID, used as bt.storeId
+	Number   string           `json:"number,omitempty"`  // ABC board store number
+	Name     string           `json:"name"`              // Display name (e.g., "7200 Sandy Fork Rd, Raleigh")
+	Address  string           `json:"address"`           // Address as wakeabc.com lists it
+	Aliases  []string         `json:"aliases,omitempty"` // Other addresses or names the store has been listed under
+	Location tracker.Location `json:"location"`
+	Phone    string           `json:"phone,omitempty"`
+	Hours    string           `json:"hours,omitempty"`
+}
+
+// Stores is the store registry, indexed for resolving the addresses found in
+// search results. IDs are stable: when wakeabc.com changes how it formats an
+// address, the store keeps its ID as long as the new address still resolves,
+// and an alias can be added for anything that doesn't.
+type Stores struct {
+	stores []Store
+	byID   map[string]int
+	byKey  map[string]int // addressKey of each address, alias and name
+}
+
+// LoadStores reads a store registry file, or the embedded registry if path is ""
+func LoadStores(path string) (*Stores, error) {
+	if path == "" {
+		return ParseStores(defaultStoresJSON)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stores file: %w", err)
+	}
+	stores, err := ParseStores(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return stores, nil
+}
+
+// ParseStores parses and validates a store registry. Every store needs an ID
+// and an address, and no two stores may share an ID, address or alias.
+func ParseStores(data []byte) (*Stores, error) {
+	var list []Store
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse stores: %w", err)
+	}
+
+	s := &Stores{
+		byID:  make(map[string]int, len(list)),
+		byKey: make(map[string]int),
+	}
+	for i, store := range list {
+		if err := s.Add(store); err != nil {
+			return nil, fmt.Errorf("store %d: %w", i+1, err)
+		}
+	}
+	return s, nil
+}
+
+// Add adds a store to the registry, with the same checks as ParseStores
+func (s *Stores) Add(store Store) error {
+	if store.ID == "" || store.Address == "" {
+		return fmt.Errorf("id and address are required")
+	}
+	if _, dup := s.byID[store.ID]; dup {
+		return fmt.Errorf("duplicate store id %q", store.ID)
+	}
+
+	i := len(s.stores)
+	keys := make(map[string]bool)
+	for _, text := range append([]string{store.Address, store.Name}, store.Aliases...) {
+		key := addressKey(text)
+		if key == "" {
+			continue
+		}
+		if other, dup := s.byKey[key]; dup {
+			return fmt.Errorf("stores %q and %q both match %q", s.stores[other].ID, store.ID, text)
+		}
+		keys[key] = true
+	}
+
+	s.stores = append(s.stores, store)
+	s.byID[store.ID] = i
+	for key := range keys {
+		s.byKey[key] = i
+	}
+	return nil
+}
+
+// SetLocation sets the coordinates of the store with the given ID
+func (s *Stores) SetLocation(id string, location tracker.Location) bool {
+	i, ok := s.byID[id]
+	if ok {
+		s.stores[i].Location = location
+	}
+	return ok
+}
+
+// List returns the stores in registry order
+func (s *Stores) List() []Store {
+	return append([]Store(nil), s.stores...)
+}
+
+// Save writes the registry to path in the format LoadStores reads,
+// replacing the file atomically
+func (s *Stores) Save(path string) error {
+	data, err := json.MarshalIndent(s.stores, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// NewStore returns a registry entry for an address found on wakeabc.com, with
+// an ID and name derived from the street address. IDs that are already taken
+// get a numeric suffix.
+func (s *Stores) NewStore(address string, location tracker.Location) Store {
+	base := sanitizeStoreID(address)
+	id := base
+	for n := 2; ; n++ {
+		if _, taken := s.byID[id]; !taken {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	return Store{
+		ID:       id,
+		Name:     getStoreDisplayName(address),
+		Address:  address,
+		Location: location,
+	}
+}
+
+// Len returns the number of stores in the registry
+func (s *Stores) Len() int {
+	return len(s.stores)
+}
+
+// Lookup returns the store with the given ID
+func (s *Stores) Lookup(id string) (Store, bool) {
+	i, ok := s.byID[id]
+	if !ok {
+		return Store{}, false
+	}
+	return s.stores[i], true
+}
+
+// Resolve finds the store for an address. Addresses that match a store's
+// address, name or an alias after normalization (case, punctuation,
+// abbreviations like "Road"/"Rd", state and ZIP) resolve directly. Anything
+// else resolves to the one store whose address or aliases have the same
+// street: the same number, street name and suffix, and the same directional
+// if both give one. The city is not compared.
+func (s *Stores) Resolve(address string) (Store, bool) {
+	if i, ok := s.byKey[addressKey(address)]; ok {
+		return s.stores[i], true
+	}
+
+	street, ok := parseStreet(addressTokens(address))
+	if !ok {
+		return Store{}, false
+	}
+
+	match := -1
+	for i, store := range s.stores {
+		for _, text := range append([]string{store.Address}, store.Aliases...) {
+			candidate, ok := parseStreet(addressTokens(text))
+			if !ok || !street.matches(candidate) {
+				continue
+			}
+			if match >= 0 && match != i {
+				return Store{}, false // Ambiguous
+			}
+			match = i
+		}
+	}
+
+	if match < 0 {
+		return Store{}, false
+	}
+	return s.stores[match], true
+}
+
+// Canonicalize rewrites Wake items from an older snapshot to registry
+// identities: store IDs that aren't registry IDs (such as the addresses used
+// before the registry existed, or stores added to it since) are resolved like
+// addresses, and store names are filled in, so the same store compares equal across releases.
+// Items for stores that don't resolve are left as they are.
+func (s *Stores) Canonicalize(items []tracker.InventoryItem) []tracker.InventoryItem {
+	canonical := make([]tracker.InventoryItem, len(items))
+	for i, item := range items {
+		canonical[i] = item
+		if !isWakeItem(item) {
+			continue
+		}
+
+		store, ok := s.Lookup(item.StoreID)
+		if !ok {
+			store, ok = s.Resolve(item.StoreID)
+		}
+		if !ok && item.StoreName != "" {
+			// Stores missing from the registry are named by their address
+			store, ok = s.Resolve(item.StoreName)
+		}
+		if !ok {
+			continue
+		}
+		canonical[i].StoreID = store.ID
+		canonical[i].StoreName = store.Name
+		canonical[i].Location = store.Location
+	}
+	return canonical
+}
+
+// addressAbbreviations maps words to the abbreviation used when comparing
+// addresses
+var addressAbbreviations = map[string]string{
+	"road": "rd", "street": "st", "drive": "dr", "boulevard": "blvd",
+	"parkway": "pkwy", "pky": "pkwy", "lane": "ln", "place": "pl",
+	"court": "ct", "circle": "cir", "avenue": "ave", "highway": "hwy",
+	"north": "n", "south": "s", "east": "e", "west": "w",
+	"northeast": "ne", "northwest": "nw", "southeast": "se", "southwest": "sw",
+}
+
+// streetSuffixes are the (abbreviated) words that end a street name
+var streetSuffixes = map[string]bool{
+	"rd": true, "st": true, "dr": true, "blvd": true, "pkwy": true, "ln": true,
+	"pl": true, "ct": true, "cir": true, "ave": true, "hwy": true, "way": true,
+}
+
+// directionals are the (abbreviated) compass points that prefix or follow
+// a street name
+var directionals = map[string]bool{
+	"n": true, "s": true, "e": true, "w": true, "ne": true, "nw": true, "se": true, "sw": true,
+}
+
+var zipCode = regexp.MustCompile(`^\d{5}$`)
+
+// addressTokens returns the normalized words of an address, without the
+// state and ZIP code
+func addressTokens(address string) []string {
+	words := strings.Fields(nonAlphanumeric.ReplaceAllString(strings.ToLower(address), " "))
+	tokens := make([]string, 0, len(words))
+	for i, word := range words {
+		if word == "nc" || (i > 0 && zipCode.MatchString(word)) {
+			continue
+		}
+		if abbreviation, ok := addressAbbreviations[word]; ok {
+			word = abbreviation
+		}
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// street is the street part of an address: everything from the number up to
+// the last street suffix, which leaves out the city
+type street struct {
+	number      string
+	name        string // Street name words other than directionals, sorted
+	directional string // Directionals in the street, in order
+	suffix      string
+}
+
+// parseStreet splits address tokens into a street. Addresses without a
+// number or a street suffix can't be split from their city and don't parse.
+func parseStreet(tokens []string) (street, bool) {
+	last := -1
+	for i, token := range tokens {
+		if i > 0 && streetSuffixes[token] {
+			last = i
+		}
+	}
+	if last < 1 || !isDigits(tokens[0]) {
+		return street{}, false
+	}
+
+	var name, directional []string
+	for _, token := range tokens[1:last] {
+		if directionals[token] {
+			directional = append(directional, token)
+		} else {
+			name = append(name, token)
+		}
+	}
+	if len(name) == 0 {
+		return street{}, false
+	}
+	sort.Strings(name)
+	return street{
+		number:      tokens[0],
+		name:        strings.Join(name, " "),
+		directional: strings.Join(directional, " "),
+		suffix:      tokens[last],
+	}, true
+}
+
+// matches reports whether two streets are the same. A directional only
+// tells streets apart when both have one: "W Williams St" and "Williams St"
+// match, but "W Williams St" and "E Williams St" don't.
+func (s street) matches(other street) bool {
+	if s.number != other.number || s.name != other.name || s.suffix != other.suffix {
+		return false
+	}
+	return s.directional == "" || other.directional == "" || s.directional == other.directional
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// addressKey returns the normalized form of an address for exact matching
+func addressKey(address string) string {
+	return strings.Join(addressTokens(address), " ")
 }
@@ -0,0 +1,67 @@
+package wake
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	stores, err := LoadStores("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		address string
+		want    string // Store ID, or "" if the address shouldn't resolve
+	}{
+		// Exact matches after normalization
+		{"7200 Sandy Fork Rd. Raleigh, NC 27609", "7200-sandy-fork-rd"},
+		{"7200 SANDY FORK ROAD, Raleigh NC", "7200-sandy-fork-rd"},
+		{"1793 W. Williams Street Apex, NC 27502", "1793-west-williams-st"},
+
+		// Same street, different city or extra words after the street
+		{"7200 Sandy Fork Rd. North Raleigh, NC 27615", "7200-sandy-fork-rd"},
+		{"4215 The Circle at North Hills Rd Suite 100 Raleigh", "4215-the-circle-at-north-hills-rd"},
+		{"1940 Cinema Drive, Fuquay-Varina NC", "1940-cinema-dr"},
+
+		// A directional on only one side is ignored
+		{"3615 Cary Parkway, Cary NC 27513", "3615-sw-cary-parkway"},
+		{"1415 Williams St. Apex, NC", "1415-e-williams-st"},
+
+		// Other stores that share a house number
+		{"7200 Falls Rd. Raleigh, NC 27609", ""},
+		{"1415 W. Williams St. Apex, NC 27502", ""},
+		{"200 New Hope Rd Garner, NC 27529", ""},
+
+		// Same street name with a different suffix
+		{"7200 Sandy Fork Dr. Raleigh, NC 27609", ""},
+		// No street suffix to separate the street from the city
+		{"7200 Sandy Fork Raleigh", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		store, ok := stores.Resolve(tt.address)
+		got := ""
+		if ok {
+			got = store.ID
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestResolveAmbiguous(t *testing.T) {
+	stores, err := ParseStores([]byte(`[
+		{"id": "a", "address": "100 Main St. Apex, NC"},
+		{"id": "b", "address": "100 Main St. Cary, NC"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store, ok := stores.Resolve("100 Main Street Raleigh"); ok {
+		t.Errorf("Resolve matched %q; two stores are on that street", store.ID)
+	}
+	if store, ok := stores.Resolve("100 Main St. Cary, NC 27511"); !ok || store.ID != "b" {
+		t.Errorf("Resolve = %q, %v; want the exact match", store.ID, ok)
+	}
+}
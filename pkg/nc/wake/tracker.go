@@ -1,10 +1,12 @@
 package wake
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -14,6 +16,7 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
 	"github.com/jeffspahr/bourbontracker/pkg/tracker"
 )
 
@@ -32,11 +35,27 @@ type Tracker struct {
 	config          tracker.Config
 	products        map[string]NCProduct // map of NC code to product info
 	productsToTrack map[string]bool      // specific products to track (nil = track all)
+	stores          *Stores
 	client          *http.Client
+	logger          *slog.Logger
 }
 
-// New creates a new Wake County ABC tracker
-func New(productsFile string) (*Tracker, error) {
+// Ensure Tracker satisfies the legacy and streaming interfaces and takes a logger
+var (
+	_ tracker.Tracker       = (*Tracker)(nil)
+	_ tracker.StreamTracker = (*Tracker)(nil)
+	_ tracker.LoggerSetter  = (*Tracker)(nil)
+	_ tracker.Canonicalizer = (*Tracker)(nil)
+)
+
+// New creates a new Wake County ABC tracker. storesFile is the store registry,
+// or "" for the registry built into the binary.
+func New(productsFile, storesFile string) (*Tracker, error) {
+	stores, err := LoadStores(storesFile)
+	if err != nil {
+		return nil, err
+	}
+
 	// Load NC products from JSON
 	file, err := os.Open(productsFile)
 	if err != nil {
@@ -63,10 +82,17 @@ func New(productsFile string) (*Tracker, error) {
 		config:          tracker.DefaultConfig(),
 		products:        products,
 		productsToTrack: nil, // nil means track all products
+		stores:          stores,
 		client:          client,
+		logger:          slog.Default(),
 	}, nil
 }
 
+// SetLogger sets the logger for search progress and errors
+func (t *Tracker) SetLogger(logger *slog.Logger) {
+	t.logger = logger
+}
+
 // SetProductsToTrack sets specific products to track (by NC Code)
 // If nil or empty, all products will be tracked
 func (t *Tracker) SetProductsToTrack(ncCodes []string) {
@@ -94,16 +120,40 @@ func (t *Tracker) ProductCodes() []string {
 	return codes
 }
 
-// StoreCount returns the number of stores (15 Wake County ABC stores)
+// StoreCount returns the number of stores in the store registry
 func (t *Tracker) StoreCount() int {
-	return 15 // Wake County has 15 ABC store locations
+	return t.stores.Len()
+}
+
+// Canonicalize rewrites store IDs from older snapshots to registry IDs
+func (t *Tracker) Canonicalize(items []tracker.InventoryItem) []tracker.InventoryItem {
+	return t.stores.Canonicalize(items)
+}
+
+// CoverageScope reports that coverage is tracked per product
+func (t *Tracker) CoverageScope() tracker.Scope {
+	return tracker.ScopeProducts
 }
 
 // Track queries Wake County inventory and returns items
 func (t *Tracker) Track() ([]tracker.InventoryItem, error) {
+	result, err := tracker.Collect(context.Background(), t, nil)
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// TrackStream searches each product concurrently, emitting in-stock items and
+// a completion event per product. It stops starting new searches once ctx is
+// cancelled and returns after the in-flight ones finish.
+func (t *Tracker) TrackStream(ctx context.Context, fn tracker.EventFunc) error {
 	type result struct {
-		items []tracker.InventoryItem
-		err   error
+		ncCode string
+		items  []tracker.InventoryItem
+		status int  // HTTP status, 0 if no response
+		sent   bool // A request was made
+		err    error
 	}
 
 	// Count how many products we'll actually search
@@ -115,11 +165,11 @@ func (t *Tracker) Track() ([]tracker.InventoryItem, error) {
 	}
 
 	if productsToSearch == 0 {
-		fmt.Fprintf(log.Writer(), "  No products need updating (all data is fresh)\n")
-		return []tracker.InventoryItem{}, nil
+		t.logger.Info("No products need updating (all data is fresh)")
+		return nil
 	}
 
-	fmt.Fprintf(log.Writer(), "  Searching %d/%d products\n", productsToSearch, len(t.products))
+	t.logger.Info("Searching products", "searching", productsToSearch, "catalog", len(t.products))
 
 	// Create buffered channel for results
 	results := make(chan result, productsToSearch)
@@ -128,56 +178,124 @@ func (t *Tracker) Track() ([]tracker.InventoryItem, error) {
 	const maxConcurrent = 3
 	semaphore := make(chan struct{}, maxConcurrent)
 
-	// Search by NC Code for each product concurrently
-	for ncCode, product := range t.products {
-		// Skip if we have a specific product list and this product isn't in it
-		if t.productsToTrack != nil && !t.productsToTrack[ncCode] {
-			continue
-		}
+	// Launch searches in the background so results can be emitted as they arrive
+	started := make(chan int, 1)
+	go func() {
+		launched := 0
+		defer func() { started <- launched }()
+
+		// Search by NC Code for each product concurrently
+		for ncCode, product := range t.products {
+			// Skip if we have a specific product list and this product isn't in it
+			if t.productsToTrack != nil && !t.productsToTrack[ncCode] {
+				continue
+			}
 
-		ncCode := ncCode // capture for goroutine
-		product := product
+			ncCode := ncCode // capture for goroutine
+			product := product
 
-		semaphore <- struct{}{} // acquire semaphore
+			// acquire semaphore unless cancelled
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			launched++
 
-		go func() {
-			defer func() { <-semaphore }() // release semaphore
+			go func() {
+				defer func() { <-semaphore }() // release semaphore
 
-			// Rate limiting: 1 second delay per request to avoid 429 errors
-			time.Sleep(1000 * time.Millisecond)
+				// Rate limiting: 1 second delay per request to avoid 429 errors
+				if err := tracker.Sleep(ctx, 1000*time.Millisecond); err != nil {
+					results <- result{ncCode: ncCode, err: err}
+					return
+				}
 
-			items, err := t.searchProduct(ncCode, product)
-			if err != nil {
-				fmt.Fprintf(log.Writer(), "  ERROR searching %s: %v\n", ncCode, err)
-			} else if len(items) > 0 {
-				fmt.Fprintf(log.Writer(), "  Found %d items for %s (%s)\n", len(items), ncCode, product.BrandName)
+				items, status, err := t.searchProduct(ctx, ncCode, product)
+				if err != nil {
+					t.logger.Error("Product search failed", logging.KeyProductID, ncCode, logging.KeyStatus, status, logging.KeyError, err)
+				} else if len(items) > 0 {
+					t.logger.Debug("Found product", logging.KeyProductID, ncCode, "product", product.BrandName, logging.KeyItems, len(items))
+				}
+
+				results <- result{ncCode: ncCode, items: items, status: status, sent: true, err: err}
+			}()
+		}
+	}()
+
+	// Collect results until every launched search has reported back
+	total := productsToSearch
+	received := 0
+	for {
+		select {
+		case n := <-started:
+			total = n
+		case res := <-results:
+			received++
+			if ctx.Err() != nil && isCancellation(res.err) {
+				// Cancelled before the search finished; not a failure. Errors
+				// that happened before the shutdown are still reported below.
+				break
 			}
 
-			results <- result{items: items, err: err}
-		}()
-	}
+			if res.sent {
+				fn(tracker.Event{Kind: tracker.EventRequest, ProductID: res.ncCode, Status: res.status, Attempt: 1})
+			}
 
-	// Collect results
-	var allItems []tracker.InventoryItem
-	for i := 0; i < productsToSearch; i++ {
-		res := <-results
-		if res.err == nil {
-			allItems = append(allItems, res.items...)
+			ev := tracker.Event{
+				Kind:      tracker.EventProduct,
+				ProductID: res.ncCode,
+				Done:      received,
+				Total:     productsToSearch,
+			}
+			if res.err != nil {
+				ev.Err = &tracker.Failure{
+					ProductID: res.ncCode,
+					Attempts:  1,
+					LastError: res.err.Error(),
+				}
+			}
+			for _, item := range res.items {
+				fn(tracker.Event{Kind: tracker.EventItem, Item: item})
+			}
+			fn(ev)
+		}
+
+		if received >= total {
+			break
 		}
 	}
 
-	return allItems, nil
+	return ctx.Err()
 }
 
-// searchProduct searches for a specific product by NC Code and parses results
-func (t *Tracker) searchProduct(ncCode string, product NCProduct) ([]tracker.InventoryItem, error) {
-	// Try searching by NC Code first
+// isCancellation reports whether err came from the run being cancelled or timing out
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// searchProduct searches for a specific product by NC Code and parses results.
+// It also returns the HTTP status, or 0 if no response was received.
+func (t *Tracker) searchProduct(ctx context.Context, ncCode string, product NCProduct) ([]tracker.InventoryItem, int, error) {
+	body, status, err := search(ctx, t.client, ncCode)
+	if err != nil {
+		return nil, status, err
+	}
+
+	items, err := t.parseSearchResults(ncCode, product, body)
+	return items, status, err
+}
+
+// search runs a wakeabc.com inventory search for query (an NC code or product
+// name) and returns the results page. It also returns the HTTP status, or 0 if
+// no response was received.
+func search(ctx context.Context, client *http.Client, query string) (string, int, error) {
 	formData := url.Values{}
-	formData.Set("productSearch", ncCode)
+	formData.Set("productSearch", query)
 
-	req, err := http.NewRequest("POST", "https://wakeabc.com/search-results", strings.NewReader(formData.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://wakeabc.com/search-results", strings.NewReader(formData.Encode()))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers to mimic browser
@@ -185,26 +303,27 @@ func (t *Tracker) searchProduct(ncCode string, product NCProduct) ([]tracker.Inv
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36")
 	req.Header.Set("Referer", "https://wakeabc.com/search-our-inventory/")
 
-	resp, err := t.client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search product: %w", err)
+		return "", 0, fmt.Errorf("failed to search product: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return "", resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	// Read and parse HTML
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return "", resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
 	}
-
-	return t.parseSearchResults(ncCode, product, string(body))
+	return string(body), resp.StatusCode, nil
 }
 
-// parseSearchResults extracts inventory items from HTML
+// parseSearchResults extracts inventory items from HTML. Only product blocks
+// attributed to the searched product (see matchBlock) are returned; blocks
+// for other catalog products are left to their own search, and blocks for
+// products not in the catalog are logged and skipped.
 func (t *Tracker) parseSearchResults(ncCode string, product NCProduct, html string) ([]tracker.InventoryItem, error) {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
 	if err != nil {
@@ -212,6 +331,7 @@ func (t *Tracker) parseSearchResults(ncCode string, product NCProduct, html stri
 	}
 
 	var items []tracker.InventoryItem
+	var unmatched []string
 	now := time.Now()
 
 	// Find all product divs
@@ -219,6 +339,26 @@ func (t *Tracker) parseSearchResults(ncCode string, product NCProduct, html stri
 		// Extract product name
 		productName := strings.TrimSpace(s.Find("h4").Text())
 
+		// Attribute the block using its own details, not the store list
+		details := s.Clone()
+		details.Find("div.inventory-collapse").Remove()
+		detailsText := spacedText(details)
+		block := resultBlock{
+			name:   productName,
+			plu:    extractPLU(detailsText),
+			sizeML: parseSizeML(detailsText),
+		}
+
+		switch kind, code := t.matchBlock(ncCode, product, block); kind {
+		case matchOther:
+			t.logger.Debug("Search result belongs to another catalog product", logging.KeyProductID, ncCode,
+				"result_product_id", code, "result", productName)
+			return
+		case matchNone:
+			unmatched = append(unmatched, productName)
+			return
+		}
+
 		// Check if out of stock
 		outOfStock := s.Find("p.out-of-stock").Length() > 0
 		if outOfStock {
@@ -237,16 +377,19 @@ func (t *Tracker) parseSearchResults(ncCode string, product NCProduct, html stri
 			quantity := extractQuantity(quantityText)
 
 			if quantity > 0 {
-				// Get store coordinates
-				location, found := getStoreLocation(address)
+				// Identify the store; unknown addresses get an ID derived from the
+				// address and no coordinates until they're added to the registry.
+				// Their name is the full address, so cmd/stores can find them.
+				store, found := t.stores.Resolve(address)
 				if !found {
-					fmt.Fprintf(log.Writer(), "  WARNING: No coordinates found for address: %s\n", address)
-					fmt.Fprintf(log.Writer(), "  Run ./scripts/update-wake-geocoding.sh to update store coordinates\n")
+					t.logger.Warn("Store address not in the store registry; run cmd/stores to add it",
+						"address", address)
+					store = Store{
+						ID:   sanitizeStoreID(address),
+						Name: address,
+					}
 				}
 
-				// Extract street address for display (more readable than full address)
-				storeDisplayName := getStoreDisplayName(address)
-
 				// Wake ABC doesn't have individual product or store pages, and their search
 				// uses POST (not linkable). Link to search page where users can search manually.
 				storeURL := "https://wakeabc.com/search-our-inventory/"
@@ -256,9 +399,10 @@ func (t *Tracker) parseSearchResults(ncCode string, product NCProduct, html stri
 					Timestamp:   now,
 					ProductName: tracker.NormalizeProductName(productName),
 					ProductID:   ncCode, // Use NC Code as product ID
-					Location:    location,
+					Location:    store.Location,
 					Quantity:    quantity,
-					StoreID:     storeDisplayName, // Use readable street address
+					StoreID:     store.ID,
+					StoreName:   store.Name,
 					StoreURL:    storeURL,
 					State:       "NC",
 					County:      "Wake",
@@ -269,17 +413,34 @@ func (t *Tracker) parseSearchResults(ncCode string, product NCProduct, html stri
 		})
 	})
 
+	if len(unmatched) > 0 {
+		t.logger.Info("Skipped search results not in the product catalog", logging.KeyProductID, ncCode,
+			"searched", product.BrandName, "unmatched", strings.Join(unmatched, "; "))
+	}
 	return items, nil
 }
 
-// extractPLU extracts PLU number from text like "PLU: 18010"
+// spacedText returns the text of a selection with a space between the text of
+// each element, so "<p>PLU: 26</p><p>750ml</p>" doesn't run together
+func spacedText(sel *goquery.Selection) string {
+	var parts []string
+	sel.Find("*").AddSelection(sel).Each(func(_ int, e *goquery.Selection) {
+		own := e.Contents().FilterFunction(func(_ int, c *goquery.Selection) bool {
+			return goquery.NodeName(c) == "#text"
+		})
+		parts = append(parts, own.Text())
+	})
+	return strings.Join(parts, " ")
+}
+
+// extractPLU extracts PLU number from text like "PLU: 18010", or "" if there is none
 func extractPLU(text string) string {
 	re := regexp.MustCompile(`PLU:\s*(\d+)`)
 	matches := re.FindStringSubmatch(text)
 	if len(matches) > 1 {
 		return matches[1]
 	}
-	return "unknown"
+	return ""
 }
 
 // extractQuantity extracts quantity from text like "24 in stock"
@@ -0,0 +1,106 @@
+package output
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+func init() {
+	register(jsonFormat{})
+	register(envelopeFormat{})
+	register(ndjsonFormat{})
+	register(csvFormat{})
+	register(geoJSONFormat{})
+	register(kmlFormat{})
+}
+
+// jsonFormat is an indented JSON array, as read by index.html, the alerter
+// and the API server
+type jsonFormat struct{}
+
+func (jsonFormat) Name() string { return "json" }
+
+func (jsonFormat) Encode(w *bufio.Writer, run *tracker.Envelope) error {
+	items := run.Items
+	if items == nil {
+		items = []tracker.InventoryItem{}
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// envelopeFormat is an indented tracker.Envelope: the items plus run metadata
+type envelopeFormat struct{}
+
+func (envelopeFormat) Name() string { return "envelope" }
+
+func (envelopeFormat) Encode(w *bufio.Writer, run *tracker.Envelope) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ndjsonFormat is one JSON item per line
+type ndjsonFormat struct{}
+
+func (ndjsonFormat) Name() string { return "ndjson" }
+
+func (ndjsonFormat) Encode(w *bufio.Writer, run *tracker.Envelope) error {
+	encoder := json.NewEncoder(w)
+	for _, item := range run.Items {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvFormat is one row per item with a header row
+type csvFormat struct{}
+
+var csvHeader = []string{
+	"timestamp", "state", "county", "store_id", "store_name", "product_id", "product_name",
+	"listing_type", "quantity", "latitude", "longitude", "store_url",
+}
+
+func (csvFormat) Name() string { return "csv" }
+
+func (csvFormat) Encode(w *bufio.Writer, run *tracker.Envelope) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, item := range run.Items {
+		row := []string{
+			item.Timestamp.Format(time.RFC3339),
+			item.State,
+			item.County,
+			item.StoreID,
+			item.StoreName,
+			item.ProductID,
+			item.ProductName,
+			item.ListingType,
+			strconv.Itoa(item.Quantity),
+			strconv.FormatFloat(item.Location.Latitude, 'f', -1, 64),
+			strconv.FormatFloat(item.Location.Longitude, 'f', -1, 64),
+			item.StoreURL,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
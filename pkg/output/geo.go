@@ -0,0 +1,170 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// geoJSONFormat is a FeatureCollection with a Point feature per item. Items
+// without coordinates get a null geometry rather than a point at 0,0.
+type geoJSONFormat struct{}
+
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Type       string            `json:"type"`
+	Geometry   *point            `json:"geometry"`
+	Properties featureProperties `json:"properties"`
+}
+
+type point struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"` // lon, lat
+}
+
+type featureProperties struct {
+	Timestamp   time.Time `json:"timestamp"`
+	ProductID   string    `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	Quantity    int       `json:"quantity"`
+	StoreID     string    `json:"store_id"`
+	StoreName   string    `json:"store_name,omitempty"`
+	StoreURL    string    `json:"store_url,omitempty"`
+	State       string    `json:"state"`
+	County      string    `json:"county,omitempty"`
+	ListingType string    `json:"listing_type"`
+}
+
+func (geoJSONFormat) Name() string { return "geojson" }
+
+func (geoJSONFormat) Encode(w *bufio.Writer, run *tracker.Envelope) error {
+	collection := featureCollection{Type: "FeatureCollection", Features: make([]feature, 0, len(run.Items))}
+	for _, item := range run.Items {
+		f := feature{
+			Type: "Feature",
+			Properties: featureProperties{
+				Timestamp:   item.Timestamp,
+				ProductID:   item.ProductID,
+				ProductName: item.ProductName,
+				Quantity:    item.Quantity,
+				StoreID:     item.StoreID,
+				StoreName:   item.StoreName,
+				StoreURL:    item.StoreURL,
+				State:       item.State,
+				County:      item.County,
+				ListingType: item.ListingType,
+			},
+		}
+		if hasLocation(item.Location) {
+			f.Geometry = &point{Type: "Point", Coordinates: [2]float64{item.Location.Longitude, item.Location.Latitude}}
+		}
+		collection.Features = append(collection.Features, f)
+	}
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// kmlFormat is a KML document with one placemark per store, listing the
+// products in stock there, so Google Earth shows a single pin per store.
+// Stores without coordinates are left out.
+type kmlFormat struct{}
+
+type kmlDocument struct {
+	XMLName    xml.Name       `xml:"kml"`
+	Namespace  string         `xml:"xmlns,attr"`
+	Name       string         `xml:"Document>name"`
+	Placemarks []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	Coordinates string `xml:"Point>coordinates"`
+}
+
+func (kmlFormat) Name() string { return "kml" }
+
+func (kmlFormat) Encode(w *bufio.Writer, run *tracker.Envelope) error {
+	type store struct {
+		state, id string
+		name      string
+		location  tracker.Location
+		url       string
+		items     []tracker.InventoryItem
+	}
+
+	stores := make(map[string]*store)
+	var keys []string
+	for _, item := range run.Items {
+		if !hasLocation(item.Location) {
+			continue
+		}
+		key := item.State + "/" + item.StoreID
+		s, ok := stores[key]
+		if !ok {
+			s = &store{state: item.State, id: item.StoreID, name: item.StoreName, location: item.Location, url: item.StoreURL}
+			stores[key] = s
+			keys = append(keys, key)
+		}
+		s.items = append(s.items, item)
+	}
+	sort.Strings(keys)
+
+	doc := kmlDocument{Namespace: "http://www.opengis.net/kml/2.2", Name: "Bourbon inventory"}
+	for _, key := range keys {
+		s := stores[key]
+		sort.Slice(s.items, func(i, j int) bool { return s.items[i].ProductName < s.items[j].ProductName })
+
+		var description strings.Builder
+		for _, item := range s.items {
+			description.WriteString(item.ProductName)
+			if item.ListingType != "" {
+				fmt.Fprintf(&description, " (%s)", item.ListingType)
+			}
+			fmt.Fprintf(&description, ": %d\n", item.Quantity)
+		}
+		if s.url != "" {
+			description.WriteString(s.url)
+		}
+
+		name := fmt.Sprintf("%s store %s", s.state, s.id)
+		if s.name != "" {
+			name = fmt.Sprintf("%s (%s)", s.name, s.state)
+		}
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name:        name,
+			Description: strings.TrimSpace(description.String()),
+			Coordinates: fmt.Sprintf("%g,%g", s.location.Longitude, s.location.Latitude),
+		})
+	}
+
+	if _, err := w.WriteString(xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
+
+// hasLocation reports whether a location has been geocoded
+func hasLocation(location tracker.Location) bool {
+	return location.Latitude != 0 || location.Longitude != 0
+}
@@ -0,0 +1,104 @@
+// Package output writes inventory to files in the formats consumers want:
+// JSON for the map and API, NDJSON for log shippers, CSV for spreadsheets,
+// and GeoJSON and KML for GIS tools and Google Earth.
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// Format encodes inventory in one file format
+type Format interface {
+	// Name is the format's name in -output specs, e.g. "geojson"
+	Name() string
+
+	// Encode writes a run's inventory to w. Most formats only use its Items.
+	Encode(w *bufio.Writer, run *tracker.Envelope) error
+}
+
+var formats = map[string]Format{}
+
+func register(format Format) {
+	formats[format.Name()] = format
+}
+
+// Lookup returns the format called name
+func Lookup(name string) (Format, bool) {
+	format, ok := formats[strings.ToLower(name)]
+	return format, ok
+}
+
+// Names returns the names of all formats in sorted order
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sink is a file that inventory is written to in a given format
+type Sink struct {
+	Format Format
+	Path   string
+}
+
+// ParseSink parses a "format:path" spec, e.g. "geojson:inventory-va.geojson"
+func ParseSink(spec string) (Sink, error) {
+	name, path, ok := strings.Cut(spec, ":")
+	if !ok || name == "" || path == "" {
+		return Sink{}, fmt.Errorf("invalid output %q (want format:path)", spec)
+	}
+
+	format, ok := Lookup(name)
+	if !ok {
+		return Sink{}, fmt.Errorf("unknown output format %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return Sink{Format: format, Path: path}, nil
+}
+
+// String returns the sink as a "format:path" spec
+func (s Sink) String() string {
+	return s.Format.Name() + ":" + s.Path
+}
+
+// Write encodes a run into the sink's file. The file is written to a
+// temporary file in the same directory and renamed into place, so readers
+// never see a partial file and a crash leaves the previous one intact.
+func (s Sink) Write(run *tracker.Envelope) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), "."+filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := s.Format.Encode(w, run); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode %s: %w", s.Format.Name(), err)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
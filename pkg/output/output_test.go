@@ -0,0 +1,209 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+var testTime = time.Date(2025, 12, 13, 10, 0, 0, 0, time.UTC)
+
+// testRun has awkward names and one item without coordinates
+func testRun() *tracker.Envelope {
+	return &tracker.Envelope{Items: []tracker.InventoryItem{
+		{
+			Timestamp:   testTime,
+			State:       "NC",
+			County:      "Wake",
+			StoreID:     "7200-sandy-fork-rd",
+			StoreName:   `Smith & Sons <Sandy Fork>, "North"`,
+			ProductID:   "00026",
+			ProductName: "Blanton's Single Barrel, 93 Proof",
+			ListingType: "Allocation",
+			Quantity:    2,
+			Location:    tracker.Location{Latitude: 35.8719206, Longitude: -78.6232906},
+			StoreURL:    "https://wakeabc.com/?a=1&b=2",
+		},
+		{
+			Timestamp:   testTime,
+			State:       "VA",
+			StoreID:     "247",
+			ProductID:   "016850",
+			ProductName: "E.H. Taylor \"Small Batch\"\nBourbon",
+			Quantity:    5,
+		},
+	}}
+}
+
+// encode runs a format into a string
+func encode(t *testing.T, name string, run *tracker.Envelope) string {
+	t.Helper()
+	format, ok := Lookup(name)
+	if !ok {
+		t.Fatalf("no %s format", name)
+	}
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := format.Encode(w, run); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCSV(t *testing.T) {
+	out := encode(t, "csv", testRun())
+
+	header, _, _ := strings.Cut(out, "\n")
+	if want := "timestamp,state,county,store_id,store_name,product_id,product_name,listing_type,quantity,latitude,longitude,store_url"; header != want {
+		t.Errorf("header = %s, want %s", header, want)
+	}
+	// Fields with commas, quotes and newlines are quoted
+	if !strings.Contains(out, `"Smith & Sons <Sandy Fork>, ""North"""`) {
+		t.Errorf("store name not quoted:\n%s", out)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"2025-12-13T10:00:00Z", "NC", "Wake", "7200-sandy-fork-rd", `Smith & Sons <Sandy Fork>, "North"`, "00026",
+			"Blanton's Single Barrel, 93 Proof", "Allocation", "2", "35.8719206", "-78.6232906", "https://wakeabc.com/?a=1&b=2"},
+		{"2025-12-13T10:00:00Z", "VA", "", "247", "", "016850", "E.H. Taylor \"Small Batch\"\nBourbon", "", "5", "0", "0", ""},
+	}
+	if !reflect.DeepEqual(rows[1:], want) {
+		t.Errorf("rows =\n%q\nwant\n%q", rows[1:], want)
+	}
+}
+
+func TestGeoJSON(t *testing.T) {
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Type     string `json:"type"`
+			Geometry *struct {
+				Type        string    `json:"type"`
+				Coordinates []float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	out := encode(t, "geojson", testRun())
+	if err := json.Unmarshal([]byte(out), &collection); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 2 {
+		t.Fatalf("got a %s with %d features", collection.Type, len(collection.Features))
+	}
+	located := collection.Features[0]
+	if located.Type != "Feature" || located.Geometry == nil || located.Geometry.Type != "Point" {
+		t.Fatalf("first feature = %+v, want a Point feature", located)
+	}
+	// GeoJSON positions are longitude first
+	if want := []float64{-78.6232906, 35.8719206}; !reflect.DeepEqual(located.Geometry.Coordinates, want) {
+		t.Errorf("coordinates = %v, want %v (lon, lat)", located.Geometry.Coordinates, want)
+	}
+	if located.Properties["store_name"] != `Smith & Sons <Sandy Fork>, "North"` || located.Properties["quantity"] != 2.0 {
+		t.Errorf("properties = %v", located.Properties)
+	}
+	if collection.Features[1].Geometry != nil {
+		t.Errorf("item without coordinates has geometry %+v, want null", collection.Features[1].Geometry)
+	}
+	if !strings.Contains(out, `"geometry":null`) {
+		t.Errorf("missing geometry isn't written as null:\n%s", out)
+	}
+
+	// An empty run is still a valid collection
+	if out := encode(t, "geojson", &tracker.Envelope{}); out != `{"type":"FeatureCollection","features":[]}` {
+		t.Errorf("empty collection = %s", out)
+	}
+}
+
+func TestKML(t *testing.T) {
+	run := testRun()
+	run.Items = append(run.Items, tracker.InventoryItem{
+		State:       "NC",
+		StoreID:     "7200-sandy-fork-rd",
+		StoreName:   run.Items[0].StoreName,
+		ProductID:   "00100",
+		ProductName: "Angel's Envy",
+		Quantity:    1,
+		Location:    run.Items[0].Location,
+		StoreURL:    run.Items[0].StoreURL,
+	})
+	out := encode(t, "kml", run)
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+  <Document>
+    <name>Bourbon inventory</name>
+    <Placemark>
+      <name>Smith &amp; Sons &lt;Sandy Fork&gt;, &#34;North&#34; (NC)</name>
+      <description>Angel&#39;s Envy: 1&#xA;Blanton&#39;s Single Barrel, 93 Proof (Allocation): 2&#xA;https://wakeabc.com/?a=1&amp;b=2</description>
+      <Point>
+        <coordinates>-78.6232906,35.8719206</coordinates>
+      </Point>
+    </Placemark>
+  </Document>
+</kml>
+`
+	if out != want {
+		t.Errorf("KML =\n%s\nwant\n%s", out, want)
+	}
+
+	// And it parses back to the original text
+	var doc kmlDocument
+	if err := xml.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Placemarks) != 1 || doc.Placemarks[0].Name != `Smith & Sons <Sandy Fork>, "North" (NC)` {
+		t.Errorf("placemarks = %+v", doc.Placemarks)
+	}
+}
+
+func TestSinkWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.ndjson")
+	sink, err := ParseSink("NDJSON:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sink.String() != "ndjson:"+path {
+		t.Errorf("String() = %s", sink.String())
+	}
+	if err := sink.Write(testRun()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wrote %d lines, want 2", len(lines))
+	}
+	var item tracker.InventoryItem
+	if err := json.Unmarshal([]byte(lines[1]), &item); err != nil || item.ProductName != testRun().Items[1].ProductName {
+		t.Errorf("second line = %s (%v)", lines[1], err)
+	}
+
+	for _, spec := range []string{"geojson", "geojson:", ":out.json", "shapefile:out.shp"} {
+		if _, err := ParseSink(spec); err == nil {
+			t.Errorf("ParseSink(%q) succeeded", spec)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package tracker
+
+import "time"
+
+// Coverage describes which stores and products a snapshot actually scanned.
+// A nil list means the snapshot is not restricted along that dimension (for
+// example, VA scans every product at each store it reaches, so only Stores is
+// set). An empty, non-nil list means nothing was covered.
+type Coverage struct {
+	Stores   []string `json:"stores"`
+	Products []string `json:"products"`
+
+	// Searched records when each product was last searched successfully, for
+	// incremental trackers that decide what to refresh by age. It includes
+	// products whose search found nothing in stock.
+	Searched map[string]time.Time `json:"searched,omitempty"`
+
+	storeSet   map[string]bool
+	productSet map[string]bool
+}
+
+// Scope identifies the unit a tracker reports coverage in
+type Scope int
+
+const (
+	// ScopeStores trackers emit an EventStore for every store they scan
+	ScopeStores Scope = iota + 1
+
+	// ScopeProducts trackers emit an EventProduct for every product they search
+	ScopeProducts
+)
+
+// Scoped is implemented by trackers that declare their coverage unit, so that
+// a run which covered nothing is not mistaken for one that is unrestricted or
+// that attempted the whole catalog
+type Scoped interface {
+	CoverageScope() Scope
+}
+
+// Covers reports whether the product/store pair was scanned. A nil Coverage
+// covers everything, which is how legacy snapshots without coverage are
+// treated. Covers is not safe for concurrent use.
+func (c *Coverage) Covers(productID, storeID string) bool {
+	if c == nil {
+		return true
+	}
+
+	if c.Stores != nil {
+		if c.storeSet == nil {
+			c.storeSet = toSet(c.Stores)
+		}
+		if !c.storeSet[storeID] {
+			return false
+		}
+	}
+
+	if c.Products != nil {
+		if c.productSet == nil {
+			c.productSet = toSet(c.Products)
+		}
+		if !c.productSet[productID] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// toSet builds a lookup set from a list of IDs
+func toSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
@@ -0,0 +1,122 @@
+package tracker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SchemaVersion is the version of the Envelope format written by this build
+const SchemaVersion = 1
+
+// Envelope is the versioned inventory file format. It wraps a run's items
+// with enough metadata for consumers to know when and how they were
+// collected. Files written before the envelope existed are bare JSON arrays
+// of items; DecodeInventory reads both.
+type Envelope struct {
+	SchemaVersion int    `json:"schema_version"` // 0 for a legacy bare array
+	RunID         string `json:"run_id"`
+	Tracker       string `json:"tracker"`      // Registry name (e.g., "va")
+	TrackerName   string `json:"tracker_name"` // Display name (e.g., "VA ABC")
+
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+
+	StoresAttempted   int `json:"stores_attempted"`
+	StoresSucceeded   int `json:"stores_succeeded"`
+	ProductsAttempted int `json:"products_attempted"`
+
+	Failures []Failure       `json:"failures"`
+	Coverage *Coverage       `json:"coverage,omitempty"`
+	Items    []InventoryItem `json:"items"`
+}
+
+// NewEnvelope wraps the inventory a run produced. items may differ from
+// result.Items, e.g. when an incremental tracker merged in earlier data.
+func NewEnvelope(name, runID string, result *Result, items []InventoryItem) *Envelope {
+	failures := result.Failures
+	if failures == nil {
+		failures = []Failure{}
+	}
+	if items == nil {
+		items = []InventoryItem{}
+	}
+
+	return &Envelope{
+		SchemaVersion:     SchemaVersion,
+		RunID:             runID,
+		Tracker:           name,
+		TrackerName:       result.Tracker,
+		Started:           result.Started,
+		Finished:          result.Finished,
+		StoresAttempted:   result.StoresAttempted,
+		StoresSucceeded:   result.StoresSucceeded,
+		ProductsAttempted: result.ProductsAttempted,
+		Failures:          failures,
+		Coverage:          &result.Coverage,
+		Items:             items,
+	}
+}
+
+// Legacy reports whether the envelope was read from a bare array, in which
+// case only Items is set
+func (e *Envelope) Legacy() bool {
+	return e.SchemaVersion == 0
+}
+
+// randRead fills run ID suffixes; tests replace it to exercise the fallback
+var randRead = rand.Read
+
+// NewRunID returns an ID for a run started at started, unique enough to tell
+// runs apart in files, history and logs. If the system's random source fails
+// the suffix falls back to the clock's nanoseconds rather than all zeros.
+func NewRunID(started time.Time) string {
+	suffix := make([]byte, 4)
+	if _, err := randRead(suffix); err != nil {
+		binary.BigEndian.PutUint32(suffix, uint32(time.Now().UnixNano()))
+	}
+	return started.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// DecodeInventory parses an inventory file in either format. Envelopes from a
+// newer schema version than this build understands are rejected rather than
+// misread.
+func DecodeInventory(data []byte) (*Envelope, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var items []InventoryItem
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+		return &Envelope{Items: items}, nil
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.SchemaVersion < 1 || envelope.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("unsupported inventory schema version %d (this build reads up to %d)",
+			envelope.SchemaVersion, SchemaVersion)
+	}
+	return &envelope, nil
+}
+
+// LoadInventory reads an inventory file in either format
+func LoadInventory(filename string) (*Envelope, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, err := DecodeInventory(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	return envelope, nil
+}
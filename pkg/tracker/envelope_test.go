@@ -0,0 +1,29 @@
+package tracker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRunID(t *testing.T) {
+	started := time.Date(2024, 3, 9, 14, 5, 6, 0, time.FixedZone("EST", -5*3600))
+	const prefix = "20240309T190506Z-"
+
+	id := NewRunID(started)
+	if !strings.HasPrefix(id, prefix) || len(id) != len(prefix)+8 {
+		t.Errorf("NewRunID = %q, want %s followed by 8 hex digits", id, prefix)
+	}
+
+	defer func(original func([]byte) (int, error)) { randRead = original }(randRead)
+	randRead = func([]byte) (int, error) { return 0, errors.New("no entropy") }
+
+	id = NewRunID(started)
+	if !strings.HasPrefix(id, prefix) || len(id) != len(prefix)+8 {
+		t.Errorf("fallback NewRunID = %q, want %s followed by 8 hex digits", id, prefix)
+	}
+	if strings.HasSuffix(id, "-00000000") {
+		t.Errorf("fallback NewRunID = %q, want a non-zero suffix", id)
+	}
+}
@@ -0,0 +1,66 @@
+package tracker
+
+import "fmt"
+
+// SnapshotStats counts what an inventory snapshot covers
+type SnapshotStats struct {
+	Items    int `json:"items"`
+	Stores   int `json:"stores"`   // Stores with at least one item in stock
+	Products int `json:"products"` // Products in stock at one or more stores
+}
+
+// StatsOf counts the items, stores and products in a snapshot
+func StatsOf(items []InventoryItem) SnapshotStats {
+	stores := make(map[string]bool)
+	products := make(map[string]bool)
+	for _, item := range items {
+		stores[item.State+"/"+item.StoreID] = true
+		products[item.State+"/"+item.ProductID] = true
+	}
+	return SnapshotStats{Items: len(items), Stores: len(stores), Products: len(products)}
+}
+
+// GuardCheck is the outcome of comparing a new snapshot against the one it
+// would replace. A run that fails the check is not published unless
+// overridden, so an upstream outage can't wipe out a full map.
+type GuardCheck struct {
+	Previous   SnapshotStats `json:"previous"`
+	Current    SnapshotStats `json:"current"`
+	MaxDrop    float64       `json:"max_drop"`             // Largest allowed fractional drop
+	Violations []string      `json:"violations,omitempty"` // Why the check failed
+	Overridden bool          `json:"overridden,omitempty"` // Published anyway
+}
+
+// CheckDrop fails if the item count, store coverage or product coverage of
+// current has dropped by more than maxDrop (0.5 = 50%) from previous. An
+// empty previous snapshot always passes, and maxDrop <= 0 disables the check.
+func CheckDrop(previous, current []InventoryItem, maxDrop float64) *GuardCheck {
+	check := &GuardCheck{
+		Previous: StatsOf(previous),
+		Current:  StatsOf(current),
+		MaxDrop:  maxDrop,
+	}
+	if maxDrop <= 0 {
+		return check
+	}
+
+	compare := func(what string, before, after int) {
+		if before == 0 || after >= before {
+			return
+		}
+		drop := 1 - float64(after)/float64(before)
+		if drop > maxDrop {
+			check.Violations = append(check.Violations,
+				fmt.Sprintf("%s dropped %d%% (%d -> %d)", what, (before-after)*100/before, before, after))
+		}
+	}
+	compare("items", check.Previous.Items, check.Current.Items)
+	compare("stores", check.Previous.Stores, check.Current.Stores)
+	compare("products", check.Previous.Products, check.Current.Products)
+	return check
+}
+
+// Passed reports whether the snapshot may be published
+func (c *GuardCheck) Passed() bool {
+	return len(c.Violations) == 0 || c.Overridden
+}
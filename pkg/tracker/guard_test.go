@@ -0,0 +1,78 @@
+package tracker
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// stocked returns n items, spread over stores stores and products products
+func stocked(n, stores, products int) []InventoryItem {
+	items := make([]InventoryItem, n)
+	for i := range items {
+		items[i] = InventoryItem{
+			State:     "VA",
+			StoreID:   strconv.Itoa(i % stores),
+			ProductID: strconv.Itoa(i % products),
+		}
+	}
+	return items
+}
+
+func TestCheckDrop(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous, current []InventoryItem
+		maxDrop           float64
+		want              []string
+	}{
+		{"empty previous", nil, stocked(3, 1, 3), 0.5, nil},
+		{"empty previous and current", nil, nil, 0.5, nil},
+		{"growth", stocked(10, 5, 2), stocked(20, 10, 4), 0.5, nil},
+		{"drop at the threshold", stocked(10, 5, 2), stocked(5, 5, 2), 0.5, nil},
+		{"items over the threshold", stocked(10, 5, 2), stocked(4, 4, 2), 0.5, []string{"items dropped 60% (10 -> 4)"}},
+		{"stores over the threshold", stocked(8, 8, 2), stocked(8, 2, 2), 0.5, []string{"stores dropped 75% (8 -> 2)"}},
+		{"everything gone", stocked(10, 5, 2), nil, 0.5, []string{
+			"items dropped 100% (10 -> 0)", "stores dropped 100% (5 -> 0)", "products dropped 100% (2 -> 0)",
+		}},
+		{"lower threshold", stocked(10, 5, 2), stocked(8, 5, 2), 0.1, []string{"items dropped 20% (10 -> 8)"}},
+		{"disabled", stocked(10, 5, 2), nil, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := CheckDrop(tt.previous, tt.current, tt.maxDrop)
+			if !reflect.DeepEqual(check.Violations, tt.want) {
+				t.Errorf("violations = %q, want %q", check.Violations, tt.want)
+			}
+			if check.Passed() != (tt.want == nil) {
+				t.Errorf("Passed() = %v with violations %q", check.Passed(), check.Violations)
+			}
+			if check.Previous != StatsOf(tt.previous) || check.Current != StatsOf(tt.current) {
+				t.Errorf("stats = %+v -> %+v", check.Previous, check.Current)
+			}
+		})
+	}
+}
+
+func TestGuardOverride(t *testing.T) {
+	check := CheckDrop(stocked(10, 5, 2), nil, 0.5)
+	if check.Passed() {
+		t.Fatal("an emptied snapshot passed")
+	}
+	check.Overridden = true
+	if !check.Passed() {
+		t.Error("an overridden check did not pass")
+	}
+}
+
+func TestStatsOf(t *testing.T) {
+	items := []InventoryItem{
+		{State: "VA", StoreID: "1", ProductID: "a"},
+		{State: "VA", StoreID: "1", ProductID: "b"},
+		{State: "NC", StoreID: "1", ProductID: "a"}, // Same IDs in another state
+	}
+	if got, want := StatsOf(items), (SnapshotStats{Items: 3, Stores: 2, Products: 3}); got != want {
+		t.Errorf("StatsOf = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,24 @@
+package tracker
+
+// MergeRefreshed combines a previous snapshot with a run that refreshed only
+// some products, for trackers that search a subset each run. For every
+// product in searched (those searched successfully), the previous items are
+// dropped and replaced by fresh, so a product that sold out everywhere
+// disappears. Products that were not searched, or whose search failed, keep
+// their previous items. owns limits the merge to the tracker's own items;
+// anything else in previous is always kept.
+func MergeRefreshed(previous, fresh []InventoryItem, searched []string, owns func(InventoryItem) bool) []InventoryItem {
+	replaced := make(map[string]bool, len(searched))
+	for _, productID := range searched {
+		replaced[productID] = true
+	}
+
+	merged := make([]InventoryItem, 0, len(previous)+len(fresh))
+	for _, item := range previous {
+		if owns(item) && replaced[item.ProductID] {
+			continue
+		}
+		merged = append(merged, item)
+	}
+	return append(merged, fresh...)
+}
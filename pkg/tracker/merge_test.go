@@ -0,0 +1,64 @@
+package tracker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeRefreshed(t *testing.T) {
+	wake := func(productID, storeID string, quantity int) InventoryItem {
+		return InventoryItem{ProductID: productID, StoreID: storeID, Quantity: quantity, State: "NC"}
+	}
+	other := InventoryItem{ProductID: "empty", StoreID: "va-1", Quantity: 4, State: "VA"}
+	owns := func(item InventoryItem) bool { return item.State == "NC" }
+
+	previous := []InventoryItem{
+		wake("empty", "s1", 2),
+		wake("empty", "s2", 1),
+		wake("failed", "s1", 5),
+		wake("skipped", "s1", 3),
+		wake("restocked", "s1", 1),
+		other,
+	}
+
+	tests := []struct {
+		name     string
+		fresh    []InventoryItem
+		searched []string
+		want     []InventoryItem
+	}{
+		{
+			name:     "searched and empty drops previous items",
+			searched: []string{"empty"},
+			want:     []InventoryItem{wake("failed", "s1", 5), wake("skipped", "s1", 3), wake("restocked", "s1", 1), other},
+		},
+		{
+			name:     "searched but failed keeps previous items",
+			searched: nil, // Failed searches aren't reported as searched
+			want:     previous,
+		},
+		{
+			name:     "not searched keeps previous items",
+			fresh:    []InventoryItem{wake("restocked", "s2", 6)},
+			searched: []string{"restocked"},
+			want: []InventoryItem{
+				wake("empty", "s1", 2), wake("empty", "s2", 1), wake("failed", "s1", 5), wake("skipped", "s1", 3), other,
+				wake("restocked", "s2", 6),
+			},
+		},
+		{
+			name:     "items not owned by the tracker are always kept",
+			searched: []string{"empty", "failed", "skipped", "restocked"},
+			want:     []InventoryItem{other},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeRefreshed(previous, tt.fresh, tt.searched, owns)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeRefreshed =\n  %+v\nwant\n  %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package tracker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out requests so that, across every goroutine sharing it,
+// no more than a fixed number start per second
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter returns a limiter allowing perSecond requests per second.
+// A non-positive rate disables limiting.
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	var interval time.Duration
+	if perSecond > 0 {
+		interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return &RateLimiter{interval: interval}
+}
+
+// Wait blocks until the caller may issue a request or ctx is cancelled
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	if r.interval <= 0 {
+		return ctx.Err()
+	}
+
+	// Reserve the next free slot, then sleep until it arrives
+	r.mu.Lock()
+	now := time.Now()
+	slot := r.next
+	if slot.Before(now) {
+		slot = now
+	}
+	r.next = slot.Add(r.interval)
+	r.mu.Unlock()
+
+	return Sleep(ctx, time.Until(slot))
+}
+
+// Backoff tracks an exponential backoff delay. It is not safe for concurrent
+// use; give each worker its own.
+type Backoff struct {
+	Min     time.Duration
+	Max     time.Duration
+	current time.Duration
+}
+
+// Current returns the delay to wait before the next retry
+func (b *Backoff) Current() time.Duration {
+	if b.current < b.Min {
+		b.current = b.Min
+	}
+	return b.current
+}
+
+// Failure doubles the delay, capped at Max
+func (b *Backoff) Failure() {
+	b.current = b.Current() * 2
+	if b.Max > 0 && b.current > b.Max {
+		b.current = b.Max
+	}
+}
+
+// Success gradually reduces the delay instead of resetting it immediately
+func (b *Backoff) Success() {
+	b.current = b.Current() / 2
+}
+
+// Reset returns the delay to Min
+func (b *Backoff) Reset() {
+	b.current = b.Min
+}
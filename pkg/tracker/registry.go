@@ -0,0 +1,122 @@
+package tracker
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Definition describes a tracker implementation that can be enabled by name
+type Definition struct {
+	// Name is the short name used to enable the tracker (e.g., "va", "wake")
+	Name string
+
+	// Description is a short human-readable label shown in command-line help
+	Description string
+
+	// Output is the default path for the tracker's inventory file
+	Output string
+
+	// Interval is how often cmd/tracker -daemon runs the tracker by default
+	Interval time.Duration
+
+	// NewConfig returns a pointer to the tracker's config block, populated with
+	// defaults. The block is decoded from JSON config files, and it gets its own
+	// command-line flags if it implements FlagBinder.
+	NewConfig func() interface{}
+
+	// New builds the tracker from a config block returned by NewConfig
+	New func(config interface{}) (StreamTracker, error)
+}
+
+// FlagBinder is implemented by config blocks that expose command-line flags
+type FlagBinder interface {
+	// BindFlags registers the block's fields as flags on fs
+	BindFlags(fs *flag.FlagSet)
+}
+
+// LoggerSetter is implemented by trackers that accept a structured logger.
+// Trackers log to slog.Default() until one is set.
+type LoggerSetter interface {
+	SetLogger(logger *slog.Logger)
+}
+
+// Incremental is implemented by trackers that only refresh part of their
+// inventory on each run and carry the rest forward from the previous snapshot.
+// The snapshot may be a legacy array, in which case only Items is set.
+type Incremental interface {
+	// Prepare inspects the previous snapshot to decide what to refresh
+	Prepare(previous *Envelope)
+
+	// Merge combines the previous snapshot with the items in result, and
+	// updates result.Coverage to describe the merged snapshot
+	Merge(previous *Envelope, result *Result) []InventoryItem
+}
+
+// Canonicalizer is implemented by trackers whose item identities (such as
+// store IDs) have changed between releases. Canonicalize rewrites items from
+// an older snapshot to the current identities, so comparing the snapshot with
+// a new run doesn't report every item as removed and re-added.
+type Canonicalizer interface {
+	Canonicalize(items []InventoryItem) []InventoryItem
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Definition)
+)
+
+// Register makes a tracker available by name. It is intended to be called from
+// the init function of the package implementing the tracker, and panics if the
+// definition is incomplete or the name is already taken.
+func Register(def Definition) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if def.Name == "" || def.New == nil || def.NewConfig == nil {
+		panic("tracker: Register called with incomplete definition")
+	}
+	if _, dup := registry[def.Name]; dup {
+		panic(fmt.Sprintf("tracker: Register called twice for %q", def.Name))
+	}
+	registry[def.Name] = def
+}
+
+// Lookup returns the registered definition for name
+func Lookup(name string) (Definition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	def, ok := registry[name]
+	return def, ok
+}
+
+// Names returns the names of all registered trackers in sorted order
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Definitions returns all registered definitions sorted by name
+func Definitions() []Definition {
+	names := Names()
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	defs := make([]Definition, 0, len(names))
+	for _, name := range names {
+		defs = append(defs, registry[name])
+	}
+	return defs
+}
@@ -0,0 +1,82 @@
+package tracker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+// Report summarises one tracker's run so downstream tools know what is missing
+type Report struct {
+	Name        string    `json:"name"`    // Registry name (e.g., "va")
+	Tracker     string    `json:"tracker"` // Display name (e.g., "VA ABC")
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+	Items       int       `json:"items"`
+	Interrupted bool      `json:"interrupted"`
+	Failures    []Failure `json:"failures"`
+	Coverage    *Coverage `json:"coverage,omitempty"`
+
+	// Guard is the sanity check against the previous snapshot. The run was not
+	// published if it has violations and was not overridden, in which case
+	// Rejected is set.
+	Guard    *GuardCheck `json:"guard,omitempty"`
+	Rejected bool        `json:"rejected,omitempty"`
+}
+
+// RunReport is written by cmd/tracker -report and covers every tracker in a run
+type RunReport struct {
+	Trackers []Report `json:"trackers"`
+}
+
+// NewReport summarises a Result under the tracker's registry name
+func NewReport(name string, result *Result, interrupted bool) Report {
+	failures := result.Failures
+	if failures == nil {
+		failures = []Failure{}
+	}
+
+	return Report{
+		Name:        name,
+		Tracker:     result.Tracker,
+		Started:     result.Started,
+		Finished:    result.Finished,
+		Items:       len(result.Items),
+		Interrupted: interrupted,
+		Failures:    failures,
+		Coverage:    &result.Coverage,
+	}
+}
+
+// Find returns the report for the named tracker
+func (r *RunReport) Find(name string) (Report, bool) {
+	for _, report := range r.Trackers {
+		if report.Name == name {
+			return report, true
+		}
+	}
+	return Report{}, false
+}
+
+// WriteRunReport writes a run report as indented JSON
+func WriteRunReport(filename string, report *RunReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// LoadRunReport reads a run report written by WriteRunReport
+func LoadRunReport(filename string) (*RunReport, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var report RunReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,294 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EventKind identifies what a streamed Event describes
+type EventKind int
+
+const (
+	// EventItem carries a single in-stock InventoryItem
+	EventItem EventKind = iota
+
+	// EventStore reports that a store has been fully scanned
+	EventStore
+
+	// EventProduct reports that a product has been fully searched
+	EventProduct
+
+	// EventRequest reports a single HTTP request made by the tracker
+	EventRequest
+)
+
+// String returns a short name for the event kind
+func (k EventKind) String() string {
+	switch k {
+	case EventItem:
+		return "item"
+	case EventStore:
+		return "store"
+	case EventProduct:
+		return "product"
+	case EventRequest:
+		return "request"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is emitted by a StreamTracker while it runs
+type Event struct {
+	Kind EventKind
+
+	// Item is set for EventItem
+	Item InventoryItem
+
+	// StoreID is set for EventStore
+	StoreID string
+
+	// ProductID is set for EventProduct
+	ProductID string
+
+	// Err is set when the store or product could not be scanned. Trackers
+	// should use a *Failure so attempts and status are reported.
+	Err error
+
+	// Done and Total report progress in units of the event kind
+	// (stores for EventStore, products for EventProduct)
+	Done  int
+	Total int
+
+	// Status is the HTTP status for EventRequest, or 0 if the request got no
+	// response. Attempt is 1 for a first try and higher for retries.
+	Status  int
+	Attempt int
+}
+
+// EventFunc receives events from a StreamTracker.
+// Implementations never call it concurrently.
+type EventFunc func(Event)
+
+// StreamTracker is the context-aware version of Tracker. Instead of returning
+// everything at the end, it streams items and progress events as it goes, and
+// stops early when ctx is cancelled.
+type StreamTracker interface {
+	// Name returns the tracker name (e.g., "VA ABC", "NC Wake County")
+	Name() string
+
+	// TrackStream queries the inventory, calling fn for every in-stock item,
+	// every completed store or product and (optionally) every HTTP request.
+	// It returns ctx.Err() if cancelled.
+	TrackStream(ctx context.Context, fn EventFunc) error
+
+	// ProductCodes returns the list of product codes this tracker should search for
+	ProductCodes() []string
+
+	// StoreCount returns the number of stores this tracker queries
+	StoreCount() int
+}
+
+// Failure records a store or product that could not be scanned
+type Failure struct {
+	StoreID    string `json:"store_id,omitempty"`
+	ProductID  string `json:"product_id,omitempty"`
+	Attempts   int    `json:"attempts"`
+	LastStatus int    `json:"last_status,omitempty"` // Last HTTP status, if any
+	LastError  string `json:"last_error"`
+}
+
+// Error implements the error interface
+func (f *Failure) Error() string {
+	if f.LastStatus != 0 {
+		return fmt.Sprintf("HTTP %d after %d attempts: %s", f.LastStatus, f.Attempts, f.LastError)
+	}
+	return fmt.Sprintf("failed after %d attempts: %s", f.Attempts, f.LastError)
+}
+
+// Result holds everything collected from a single StreamTracker run
+type Result struct {
+	Tracker  string
+	Items    []InventoryItem
+	Failures []Failure
+
+	// Coverage lists the stores and products that were scanned successfully
+	Coverage Coverage
+
+	// Stores and products the run tried to scan. Scoped trackers that report
+	// one of them per event scan all of the other (StoreCount or ProductCodes)
+	// for each; unscoped trackers are assumed to scan both in full.
+	StoresAttempted   int
+	StoresSucceeded   int
+	ProductsAttempted int
+
+	Started  time.Time
+	Finished time.Time
+}
+
+// Duration returns how long the run took
+func (r *Result) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+// Collect runs t and gathers its items into a Result. Successful store and
+// product events are recorded in the Result's Coverage, and failed ones in its
+// Failures. Every event is also passed to fn (if non-nil) so callers can
+// observe progress. When the run is
+// cancelled or fails, the items gathered so far are returned along with the
+// error so partial results can still be written.
+func Collect(ctx context.Context, t StreamTracker, fn EventFunc) (*Result, error) {
+	result := &Result{
+		Tracker: t.Name(),
+		Started: time.Now(),
+	}
+
+	var scope Scope
+	if scoped, ok := t.(Scoped); ok {
+		scope = scoped.CoverageScope()
+	}
+	switch scope {
+	case ScopeStores:
+		result.Coverage.Stores = []string{}
+	case ScopeProducts:
+		result.Coverage.Products = []string{}
+	}
+
+	storeEvents, storeFailures, productEvents := 0, 0, 0
+	err := t.TrackStream(ctx, func(ev Event) {
+		switch ev.Kind {
+		case EventStore:
+			storeEvents++
+			if ev.Err != nil {
+				storeFailures++
+			}
+		case EventProduct:
+			productEvents++
+		}
+
+		switch {
+		case ev.Kind == EventItem:
+			result.Items = append(result.Items, ev.Item)
+		case ev.Kind == EventRequest:
+			// Only of interest to fn (e.g. for metrics)
+		case ev.Err != nil:
+			result.Failures = append(result.Failures, failureFromEvent(ev))
+		case ev.Kind == EventStore:
+			result.Coverage.Stores = append(result.Coverage.Stores, ev.StoreID)
+		case ev.Kind == EventProduct:
+			result.Coverage.Products = append(result.Coverage.Products, ev.ProductID)
+		}
+		if fn != nil {
+			fn(ev)
+		}
+	})
+
+	result.Finished = time.Now()
+	result.StoresAttempted, result.StoresSucceeded = storeEvents, storeEvents-storeFailures
+	result.ProductsAttempted = productEvents
+
+	// A tracker that reports per store searches every product at each store,
+	// and one that reports per product searches every store for it. A scoped
+	// tracker that emitted no events for its scope attempted nothing (e.g. an
+	// incremental run with nothing stale); only unscoped trackers, which never
+	// report either, are assumed to have covered their whole catalog.
+	switch scope {
+	case ScopeStores:
+		if storeEvents > 0 && productEvents == 0 {
+			result.ProductsAttempted = len(t.ProductCodes())
+		}
+	case ScopeProducts:
+		if productEvents > 0 && storeEvents == 0 {
+			result.StoresAttempted, result.StoresSucceeded = t.StoreCount(), t.StoreCount()
+		}
+	default:
+		started := storeEvents > 0 || productEvents > 0 || err == nil
+		if storeEvents == 0 && started {
+			result.StoresAttempted, result.StoresSucceeded = t.StoreCount(), t.StoreCount()
+		}
+		if productEvents == 0 && started {
+			result.ProductsAttempted = len(t.ProductCodes())
+		}
+	}
+	return result, err
+}
+
+// failureFromEvent builds a Failure record for a failed store or product event
+func failureFromEvent(ev Event) Failure {
+	var failure Failure
+	var f *Failure
+	if errors.As(ev.Err, &f) {
+		failure = *f
+	} else {
+		failure = Failure{Attempts: 1, LastError: ev.Err.Error()}
+	}
+
+	if failure.StoreID == "" {
+		failure.StoreID = ev.StoreID
+	}
+	if failure.ProductID == "" {
+		failure.ProductID = ev.ProductID
+	}
+	return failure
+}
+
+// Stream adapts a legacy Tracker to the StreamTracker interface. The wrapped
+// Track call cannot be interrupted, so on cancellation Stream returns
+// immediately and abandons the in-flight call.
+func Stream(t Tracker) StreamTracker {
+	if st, ok := t.(StreamTracker); ok {
+		return st
+	}
+	return legacyTracker{t}
+}
+
+// legacyTracker wraps a blocking Tracker
+type legacyTracker struct {
+	Tracker
+}
+
+// TrackStream runs the blocking Track call and replays its items as events
+func (l legacyTracker) TrackStream(ctx context.Context, fn EventFunc) error {
+	type result struct {
+		items []InventoryItem
+		err   error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		items, err := l.Track()
+		done <- result{items: items, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res := <-done:
+		if res.err != nil {
+			return res.err
+		}
+		for _, item := range res.items {
+			fn(Event{Kind: EventItem, Item: item})
+		}
+		return nil
+	}
+}
+
+// Sleep pauses for d or until ctx is cancelled, whichever comes first
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
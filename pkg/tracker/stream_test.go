@@ -0,0 +1,84 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeTracker replays a fixed list of events
+type fakeTracker struct {
+	events []Event
+	err    error
+}
+
+func (f *fakeTracker) Name() string           { return "fake" }
+func (f *fakeTracker) ProductCodes() []string { return []string{"p1", "p2", "p3"} }
+func (f *fakeTracker) StoreCount() int        { return 10 }
+
+func (f *fakeTracker) TrackStream(ctx context.Context, fn EventFunc) error {
+	for _, ev := range f.events {
+		fn(ev)
+	}
+	return f.err
+}
+
+// scopedTracker is a fakeTracker that declares its coverage scope
+type scopedTracker struct {
+	fakeTracker
+	scope Scope
+}
+
+func (s *scopedTracker) CoverageScope() Scope { return s.scope }
+
+func TestCollectAttempted(t *testing.T) {
+	product := func(id string, err error) Event { return Event{Kind: EventProduct, ProductID: id, Err: err} }
+	store := func(id string, err error) Event { return Event{Kind: EventStore, StoreID: id, Err: err} }
+	failed := errors.New("boom")
+
+	tests := []struct {
+		name    string
+		tracker StreamTracker
+		stores  int // Attempted
+		ok      int // Succeeded
+		prods   int
+	}{
+		{
+			name:    "product scope, nothing searched",
+			tracker: &scopedTracker{scope: ScopeProducts},
+		},
+		{
+			name:    "product scope, some searched",
+			tracker: &scopedTracker{fakeTracker{events: []Event{product("p1", nil), product("p2", failed)}}, ScopeProducts},
+			stores:  10, ok: 10, prods: 2,
+		},
+		{
+			name:    "store scope, nothing scanned",
+			tracker: &scopedTracker{scope: ScopeStores},
+		},
+		{
+			name:    "store scope, some scanned",
+			tracker: &scopedTracker{fakeTracker{events: []Event{store("1", nil), store("2", failed)}}, ScopeStores},
+			stores:  2, ok: 1, prods: 3,
+		},
+		{
+			name:    "unscoped, completed",
+			tracker: &fakeTracker{},
+			stores:  10, ok: 10, prods: 3,
+		},
+		{
+			name:    "unscoped, failed before starting",
+			tracker: &fakeTracker{err: failed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := Collect(context.Background(), tt.tracker, nil)
+			if result.StoresAttempted != tt.stores || result.StoresSucceeded != tt.ok || result.ProductsAttempted != tt.prods {
+				t.Errorf("attempted stores/succeeded/products = %d/%d/%d, want %d/%d/%d",
+					result.StoresAttempted, result.StoresSucceeded, result.ProductsAttempted, tt.stores, tt.ok, tt.prods)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package tracker
 
 import (
+	"math"
 	"regexp"
 	"strings"
 	"time"
@@ -14,12 +15,21 @@ type InventoryItem struct {
 	Location    Location  `json:"geo.location"`
 	Quantity    int       `json:"bt.quantity"`
 	StoreID     string    `json:"bt.storeId"`
+	StoreName   string    `json:"bt.storeName,omitempty"` // Display name, if different from StoreID
 	StoreURL    string    `json:"bt.storeurl"`
 	State       string    `json:"bt.state"`        // VA, NC, etc.
 	County      string    `json:"bt.county"`       // For NC counties
 	ListingType string    `json:"bt.listingType"`  // Listed, Limited, Allocation, Barrel, Christmas
 }
 
+// StoreLabel returns the store's display name, or its ID if it has none
+func (i InventoryItem) StoreLabel() string {
+	if i.StoreName != "" {
+		return i.StoreName
+	}
+	return i.StoreID
+}
+
 // Location represents geographic coordinates
 type Location struct {
 	Latitude  float64 `json:"lat"`
@@ -51,14 +61,22 @@ type Config struct {
 
 	// Timeout is the HTTP request timeout
 	Timeout time.Duration
+
+	// Workers is the number of stores scanned concurrently
+	Workers int
+
+	// RequestsPerSecond caps the total request rate across all workers
+	RequestsPerSecond float64
 }
 
 // DefaultConfig returns sensible defaults
 func DefaultConfig() Config {
 	return Config{
-		BaseDelay:  250 * time.Millisecond,
-		MaxRetries: 5,
-		Timeout:    30 * time.Second,
+		BaseDelay:         250 * time.Millisecond,
+		MaxRetries:        5,
+		Timeout:           30 * time.Second,
+		Workers:           8,
+		RequestsPerSecond: 4, // Same ceiling as the old sequential 250ms delay
 	}
 }
 
@@ -104,3 +122,18 @@ func NormalizeProductName(name string) string {
 
 	return strings.TrimSpace(name)
 }
+
+// earthRadiusMiles is the mean radius of the Earth used for distances
+const earthRadiusMiles = 3958.8
+
+// DistanceMiles returns the great-circle distance to other in miles
+func (l Location) DistanceMiles(other Location) float64 {
+	lat1 := l.Latitude * math.Pi / 180
+	lat2 := other.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (other.Longitude - l.Longitude) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMiles * math.Asin(math.Sqrt(a))
+}
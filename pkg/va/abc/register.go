@@ -0,0 +1,63 @@
+package abc
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// Config is the "va" config block
+type Config struct {
+	Stores            string  `json:"stores"`              // Path to stores file
+	Products          string  `json:"products"`            // Path to products file
+	Workers           int     `json:"workers"`             // Stores scanned concurrently
+	RequestsPerSecond float64 `json:"requests_per_second"` // Total request rate ceiling
+	BatchSize         int     `json:"batch_size"`          // Store numbers per request
+}
+
+// BindFlags registers the VA ABC flags
+func (c *Config) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Stores, "stores", c.Stores, "Path to stores file (VA ABC)")
+	fs.StringVar(&c.Products, "products", c.Products, "Path to products file (VA ABC)")
+	fs.IntVar(&c.Workers, "va-workers", c.Workers, "Number of stores to scan concurrently (VA ABC)")
+	fs.Float64Var(&c.RequestsPerSecond, "va-rate", c.RequestsPerSecond, "Maximum requests per second across all workers (VA ABC)")
+	fs.IntVar(&c.BatchSize, "va-batch-size", c.BatchSize, "Number of store numbers per request, 1 disables batching (VA ABC)")
+}
+
+func init() {
+	tracker.Register(tracker.Definition{
+		Name:        "va",
+		Description: "VA ABC",
+		Output:      "inventory-va.json",
+		Interval:    6 * time.Hour, // Same cadence as the scheduled workflow
+		NewConfig: func() interface{} {
+			defaults := tracker.DefaultConfig()
+			return &Config{
+				Stores:            "stores",
+				Products:          "products.json",
+				Workers:           defaults.Workers,
+				RequestsPerSecond: defaults.RequestsPerSecond,
+				BatchSize:         DefaultBatchSize,
+			}
+		},
+		New: func(config interface{}) (tracker.StreamTracker, error) {
+			c, ok := config.(*Config)
+			if !ok {
+				return nil, fmt.Errorf("unexpected config type %T", config)
+			}
+			t, err := New(c.Stores, c.Products)
+			if err != nil {
+				return nil, err
+			}
+
+			settings := tracker.DefaultConfig()
+			settings.Workers = c.Workers
+			settings.RequestsPerSecond = c.RequestsPerSecond
+			t.SetConfig(settings)
+			t.SetBatchSize(c.BatchSize)
+			return t, nil
+		},
+	})
+}
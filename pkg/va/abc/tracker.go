@@ -2,26 +2,61 @@ package abc
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/jeffspahr/bourbontracker/pkg/logging"
 	"github.com/jeffspahr/bourbontracker/pkg/tracker"
 )
 
+const (
+	// DefaultInventoryURL is the Virginia ABC inventory endpoint
+	DefaultInventoryURL = "https://www.abc.virginia.gov/webapi/inventory/mystore"
+
+	// DefaultBatchSize is how many store numbers are sent per request
+	DefaultBatchSize = 10
+
+	// maxURLLength keeps request URLs under common server limits. Product code
+	// lists are split across requests when a batch would exceed it.
+	maxURLLength = 2000
+
+	// Each worker's backoff between retries starts at minBackoff and doubles
+	// up to maxBackoff
+	minBackoff = time.Second
+	maxBackoff = 512 * time.Second
+)
+
 // Tracker implements the tracker.Tracker interface for Virginia ABC
 type Tracker struct {
-	config       tracker.Config
-	stores       []string
-	products     map[string]string
-	storeRetries map[int]int
-	waitTime     int
+	config    tracker.Config
+	stores    []string
+	products  map[string]string
+	client    *http.Client
+	batchSize int
+	logger    *slog.Logger
+
+	inventoryURL           string
+	minBackoff, maxBackoff time.Duration
 }
 
+// Ensure Tracker satisfies the legacy and streaming interfaces and takes a logger
+var (
+	_ tracker.Tracker       = (*Tracker)(nil)
+	_ tracker.StreamTracker = (*Tracker)(nil)
+	_ tracker.LoggerSetter  = (*Tracker)(nil)
+)
+
 // payloadIn represents the Virginia ABC API response
 type payloadIn struct {
 	Products []struct {
@@ -46,10 +81,13 @@ type payloadIn struct {
 // New creates a new Virginia ABC tracker
 func New(storesFile, productsFile string) (*Tracker, error) {
 	t := &Tracker{
-		config:       tracker.DefaultConfig(),
-		storeRetries: make(map[int]int),
-		waitTime:     1,
+		batchSize:    DefaultBatchSize,
+		logger:       slog.Default(),
+		inventoryURL: DefaultInventoryURL,
+		minBackoff:   minBackoff,
+		maxBackoff:   maxBackoff,
 	}
+	t.SetConfig(tracker.DefaultConfig())
 
 	// Load stores
 	if err := t.loadStores(storesFile); err != nil {
@@ -64,6 +102,37 @@ func New(storesFile, productsFile string) (*Tracker, error) {
 	return t, nil
 }
 
+// SetConfig replaces the tracker's configuration and rebuilds its HTTP client
+func (t *Tracker) SetConfig(config tracker.Config) {
+	t.config = config
+	t.client = &http.Client{Timeout: config.Timeout}
+}
+
+// SetLogger sets the logger for request failures and retries
+func (t *Tracker) SetLogger(logger *slog.Logger) {
+	t.logger = logger
+}
+
+// SetBatchSize sets how many store numbers are sent per request.
+// Values below 1 disable batching.
+func (t *Tracker) SetBatchSize(size int) {
+	if size < 1 {
+		size = 1
+	}
+	t.batchSize = size
+}
+
+// SetInventoryURL points the tracker at another inventory endpoint, such as
+// a stand-in server
+func (t *Tracker) SetInventoryURL(url string) {
+	t.inventoryURL = url
+}
+
+// CoverageScope reports that coverage is tracked per store
+func (t *Tracker) CoverageScope() tracker.Scope {
+	return tracker.ScopeStores
+}
+
 // loadStores reads the store list from a file
 func (t *Tracker) loadStores(filename string) error {
 	file, err := os.Open(filename)
@@ -112,109 +181,380 @@ func (t *Tracker) StoreCount() int {
 
 // Track queries all stores and returns inventory items
 func (t *Tracker) Track() ([]tracker.InventoryItem, error) {
-	var inventory []tracker.InventoryItem
+	result, err := tracker.Collect(context.Background(), t, nil)
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// storeResult is the outcome of scanning a single store for one product list
+type storeResult struct {
+	store string
+	items []tracker.InventoryItem
+
+	// failure is set when the store was given up on after repeated failures
+	failure *tracker.Failure
+
+	// err is set only when the run was cancelled
+	err error
+
+	// requests holds the EventRequests made for the batch, on its first result
+	requests []tracker.Event
+}
+
+// requestRecorder notes the HTTP status and attempt number of each request
+type requestRecorder func(status, attempt int)
 
-	// Create comma-delimited product list for query string
-	productListString := ""
-	for key := range t.products {
-		if productListString == "" {
-			productListString = key
-		} else {
-			productListString += "," + key
+// batch is a single inventory request covering several stores
+type batch struct {
+	stores   []string
+	products string // comma-delimited product codes
+}
+
+// TrackStream scans all stores with a pool of workers, emitting each in-stock
+// item and each completed store as it goes. Stores are requested in batches;
+// workers share one HTTP client and one request-rate budget, and each keeps
+// its own backoff. Stores that keep failing are reported through a
+// *tracker.Failure on their EventStore rather than stopping the run. It only
+// returns an error if ctx is cancelled.
+func (t *Tracker) TrackStream(ctx context.Context, fn tracker.EventFunc) error {
+	if len(t.stores) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := t.planBatches()
+
+	// A store is complete once every product list for its batch has come back
+	remaining := make(map[string]int)
+	for _, b := range batches {
+		for _, store := range b.stores {
+			remaining[store]++
 		}
 	}
 
-	for h := 0; h < len(t.stores); h++ {
-		// Sleep before each request except the first
-		if h > 0 {
-			time.Sleep(t.config.BaseDelay)
+	limiter := tracker.NewRateLimiter(t.config.RequestsPerSecond)
+
+	workers := t.config.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(batches) {
+		workers = len(batches)
+	}
+
+	jobs := make(chan batch)
+	results := make(chan storeResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			backoff := &tracker.Backoff{Min: t.minBackoff, Max: t.maxBackoff}
+			for b := range jobs {
+				var requests []tracker.Event
+				record := func(status, attempt int) {
+					requests = append(requests, tracker.Event{Kind: tracker.EventRequest, Status: status, Attempt: attempt})
+				}
+
+				batchResults := t.scanBatch(ctx, limiter, backoff, b, record)
+				batchResults[0].requests = requests
+				for _, res := range batchResults {
+					results <- res
+				}
+			}
+		}()
+	}
+
+	// Feed batches to the workers until done or cancelled
+	go func() {
+		defer close(jobs)
+		for _, b := range batches {
+			select {
+			case jobs <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	failures := make(map[string]*tracker.Failure)
+	done := 0
+	for res := range results {
+		for _, ev := range res.requests {
+			fn(ev)
 		}
 
-		client := &http.Client{Timeout: t.config.Timeout}
-		req, err := http.NewRequest("GET", "https://www.abc.virginia.gov/webapi/inventory/mystore", nil)
-		if err != nil {
-			return nil, err
+		if res.err != nil {
+			// Cancelled mid-store; keep draining so the workers can exit
+			continue
 		}
 
-		req.Header.Add("Content-type", "application/json")
-		req.Header.Add("Accept", "application/json")
-		req.Header.Add("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-		req.Header.Add("Referer", "https://www.abc.virginia.gov/")
+		for _, item := range res.items {
+			fn(tracker.Event{Kind: tracker.EventItem, Item: item})
+		}
 
-		q := req.URL.Query()
-		q.Add("storeNumbers", t.stores[h])
-		q.Add("productCodes", productListString)
-		req.URL.RawQuery = q.Encode()
+		if res.failure != nil && failures[res.store] == nil {
+			failures[res.store] = res.failure
+		}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, err
+		remaining[res.store]--
+		if remaining[res.store] > 0 {
+			continue
 		}
 
-		body, err := ioutil.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return nil, err
+		ev := tracker.Event{
+			Kind:    tracker.EventStore,
+			StoreID: res.store,
+			Done:    done + 1,
+			Total:   len(t.stores),
+		}
+		if failure := failures[res.store]; failure != nil {
+			ev.Err = failure
 		}
+		done++
+		fn(ev)
+	}
 
-		// Handle non-200 responses
-		if resp.StatusCode != 200 {
-			t.storeRetries[h]++
-			fmt.Fprintf(os.Stderr, "Got HTTP %d for store %s (retry %d, backoff %ds)\n",
-				resp.StatusCode, t.stores[h], t.storeRetries[h], t.waitTime)
+	return ctx.Err()
+}
 
-			// Skip stores that consistently fail
-			if t.storeRetries[h] >= t.config.MaxRetries {
-				fmt.Fprintf(os.Stderr, "Skipping store %s after %d failed attempts\n",
-					t.stores[h], t.storeRetries[h])
-				t.waitTime = 1 // Reset backoff
-				continue
-			}
+// planBatches groups stores into batches and splits the product list for each
+// batch so that no request URL exceeds maxURLLength
+func (t *Tracker) planBatches() []batch {
+	codes := t.ProductCodes()
+	sort.Strings(codes)
+
+	var batches []batch
+	for start := 0; start < len(t.stores); start += t.batchSize {
+		end := start + t.batchSize
+		if end > len(t.stores) {
+			end = len(t.stores)
+		}
+		stores := t.stores[start:end]
 
-			time.Sleep(time.Duration(t.waitTime) * time.Second)
-			t.waitTime = t.waitTime * 2
-			if t.waitTime > 512 {
-				t.waitTime = 512 // Cap backoff
-			}
-			h-- // Retry this store
-			continue
+		budget := maxURLLength - len(t.requestURL(stores, ""))
+		for _, products := range splitProducts(codes, budget) {
+			batches = append(batches, batch{stores: stores, products: products})
 		}
+	}
 
-		// Gradually reduce backoff on success
-		if resp.StatusCode == 200 && t.waitTime > 1 {
-			t.waitTime = t.waitTime / 2
+	return batches
+}
+
+// splitProducts joins product codes into comma-delimited lists whose
+// query-escaped length fits within budget. Every list holds at least one code.
+func splitProducts(codes []string, budget int) []string {
+	var lists []string
+	current := ""
+
+	for _, code := range codes {
+		candidate := code
+		if current != "" {
+			candidate = current + "," + code
 		}
 
-		// Parse response
-		var pIn payloadIn
-		if err := json.Unmarshal(body, &pIn); err != nil {
-			return nil, fmt.Errorf("failed to parse response for store %s: %w", t.stores[h], err)
+		if current != "" && len(url.QueryEscape(candidate)) > budget {
+			lists = append(lists, current)
+			candidate = code
+		}
+		current = candidate
+	}
+
+	if current != "" || len(lists) == 0 {
+		lists = append(lists, current)
+	}
+	return lists
+}
+
+// scanBatch requests inventory for a batch of stores. If a multi-store batch
+// fails, each store is retried on its own so one bad store number cannot hide
+// the rest of the batch.
+func (t *Tracker) scanBatch(ctx context.Context, limiter *tracker.RateLimiter, backoff *tracker.Backoff, b batch, record requestRecorder) []storeResult {
+	byStore, failure, err := t.fetchWithRetry(ctx, limiter, backoff, b, record)
+	if err != nil {
+		return []storeResult{{store: b.stores[0], err: err}}
+	}
+
+	if len(b.stores) == 1 {
+		store := b.stores[0]
+		if failure != nil {
+			failure.StoreID = store
 		}
+		return []storeResult{{store: store, items: byStore[store], failure: failure}}
+	}
+
+	if failure != nil {
+		t.logger.Warn("Batch failed; retrying stores individually",
+			logging.KeyStoreID, strings.Join(b.stores, ","), logging.KeyError, failure.Error())
 
-		// Convert to common inventory format
-		for i := range pIn.Products {
-			if pIn.Products[i].StoreInfo.Quantity <= 0 {
-				continue // Skip items with no quantity
+		var results []storeResult
+		for _, store := range b.stores {
+			single := batch{stores: []string{store}, products: b.products}
+			results = append(results, t.scanBatch(ctx, limiter, backoff, single, record)...)
+		}
+		return results
+	}
+
+	results := make([]storeResult, 0, len(b.stores))
+	for _, store := range b.stores {
+		results = append(results, storeResult{store: store, items: byStore[store]})
+	}
+	return results
+}
+
+// fetchWithRetry issues a batch request and parses the response, retrying
+// transport errors, non-200 responses and unparseable bodies with the worker's
+// backoff. After MaxRetries attempts it gives up and returns a Failure. The
+// returned error is only set when ctx is cancelled.
+func (t *Tracker) fetchWithRetry(ctx context.Context, limiter *tracker.RateLimiter, backoff *tracker.Backoff, b batch, record requestRecorder) (map[string][]tracker.InventoryItem, *tracker.Failure, error) {
+	label := strings.Join(b.stores, ",")
+	failure := &tracker.Failure{}
+
+	for attempt := 1; ; attempt++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, nil, err
+		}
+
+		failure.Attempts = attempt
+		status, body, err := t.fetch(ctx, b)
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		record(status, attempt)
+
+		switch {
+		case err != nil:
+			failure.LastError = err.Error()
+			t.logger.Warn("Request failed", logging.KeyStoreID, label, logging.KeyAttempt, attempt,
+				"backoff", backoff.Current(), logging.KeyError, err)
+		case status != http.StatusOK:
+			// Sometimes the api returns a 403 or 400
+			failure.LastStatus = status
+			failure.LastError = http.StatusText(status)
+			t.logger.Warn("Unexpected HTTP status", logging.KeyStoreID, label, logging.KeyAttempt, attempt,
+				logging.KeyStatus, status, "backoff", backoff.Current())
+		default:
+			failure.LastStatus = status
+			items, err := t.parseInventory(b.stores, body)
+			if err == nil {
+				// Gradually reduce backoff on success
+				backoff.Success()
+				return items, nil, nil
 			}
+			failure.LastError = err.Error()
+			t.logger.Warn("Unparseable response", logging.KeyStoreID, label, logging.KeyAttempt, attempt,
+				"backoff", backoff.Current(), logging.KeyError, err)
+		}
 
-			storeID, _ := strconv.Atoi(t.stores[h])
-			item := tracker.InventoryItem{
-				Timestamp:   time.Now(),
-				ProductName: tracker.NormalizeProductName(t.products[pIn.Products[i].ProductID]),
-				ProductID:   pIn.Products[i].ProductID,
-				Location: tracker.Location{
-					Latitude:  pIn.Products[i].StoreInfo.Latitude,
-					Longitude: pIn.Products[i].StoreInfo.Longitude,
-				},
-				Quantity: pIn.Products[i].StoreInfo.Quantity,
-				StoreID:  strconv.Itoa(storeID),
-				StoreURL: fmt.Sprintf("https://www.abc.virginia.gov/stores/store-%d", storeID),
-				State:    "VA",
-				County:   "",
+		// Skip stores that consistently fail
+		if attempt >= t.config.MaxRetries {
+			t.logger.Error("Skipping store after repeated failures", logging.KeyStoreID, label, logging.KeyAttempt, attempt)
+			backoff.Reset()
+			return nil, failure, nil
+		}
+
+		if err := tracker.Sleep(ctx, backoff.Current()); err != nil {
+			return nil, nil, err
+		}
+		backoff.Failure()
+	}
+}
+
+// requestURL builds the inventory URL for a set of stores and product codes
+func (t *Tracker) requestURL(stores []string, products string) string {
+	q := url.Values{}
+	q.Add("storeNumbers", strings.Join(stores, ","))
+	q.Add("productCodes", products)
+	return t.inventoryURL + "?" + q.Encode()
+}
+
+// fetch issues the inventory request for a batch
+func (t *Tracker) fetch(ctx context.Context, b batch) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.requestURL(b.stores, b.products), nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req.Header.Add("Content-type", "application/json")
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Add("Referer", "https://www.abc.virginia.gov/")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+// parseInventory converts an API response into in-stock inventory items keyed
+// by requested store number. Single-store responses are attributed to the
+// requested store; multi-store responses are matched on storeInfo.storeId.
+func (t *Tracker) parseInventory(stores []string, body []byte) (map[string][]tracker.InventoryItem, error) {
+	// Parse response
+	var pIn payloadIn
+	if err := json.Unmarshal(body, &pIn); err != nil {
+		return nil, fmt.Errorf("failed to parse response for store %s: %w", strings.Join(stores, ","), err)
+	}
+
+	// Map numeric store IDs back to the store numbers we asked for
+	requested := make(map[int]string, len(stores))
+	for _, store := range stores {
+		id, _ := strconv.Atoi(store)
+		requested[id] = store
+	}
+
+	items := make(map[string][]tracker.InventoryItem)
+
+	// Convert to common inventory format
+	for i := range pIn.Products {
+		if pIn.Products[i].StoreInfo.Quantity <= 0 {
+			continue // Skip items with no quantity
+		}
+
+		store := stores[0]
+		if len(stores) > 1 {
+			var ok bool
+			if store, ok = requested[pIn.Products[i].StoreInfo.StoreID]; !ok {
+				continue // Not one of the stores in this batch
 			}
-			inventory = append(inventory, item)
 		}
+
+		storeID, _ := strconv.Atoi(store)
+		item := tracker.InventoryItem{
+			Timestamp:   time.Now(),
+			ProductName: tracker.NormalizeProductName(t.products[pIn.Products[i].ProductID]),
+			ProductID:   pIn.Products[i].ProductID,
+			Location: tracker.Location{
+				Latitude:  pIn.Products[i].StoreInfo.Latitude,
+				Longitude: pIn.Products[i].StoreInfo.Longitude,
+			},
+			Quantity: pIn.Products[i].StoreInfo.Quantity,
+			StoreID:  strconv.Itoa(storeID),
+			StoreURL: fmt.Sprintf("https://www.abc.virginia.gov/stores/store-%d", storeID),
+			State:    "VA",
+			County:   "",
+		}
+		items[store] = append(items[store], item)
 	}
 
-	return inventory, nil
+	return items, nil
 }
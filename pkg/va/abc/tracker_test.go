@@ -0,0 +1,478 @@
+package abc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeffspahr/bourbontracker/pkg/tracker"
+)
+
+// stock is one product's quantity at one store in a stand-in response
+type stock struct {
+	ProductID string `json:"productId"`
+	StoreInfo struct {
+		Quantity int `json:"quantity"`
+		StoreID  int `json:"storeId"`
+	} `json:"storeInfo"`
+}
+
+// vaRequest is a request the stand-in server received
+type vaRequest struct {
+	stores   []string
+	products []string
+}
+
+// fakeVA is a stand-in for the inventory endpoint. respond decides each
+// answer; by default every requested product is in stock at every requested
+// store with quantity 1.
+type fakeVA struct {
+	*httptest.Server
+	respond func(r vaRequest) (int, []stock)
+
+	mu          sync.Mutex
+	requests    []vaRequest
+	inFlight    int
+	maxInFlight int
+}
+
+func newFakeVA(t *testing.T) *fakeVA {
+	f := &fakeVA{respond: func(r vaRequest) (int, []stock) { return http.StatusOK, inStock(r, 1) }}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeVA) serve(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := vaRequest{
+		stores:   strings.Split(query.Get("storeNumbers"), ","),
+		products: strings.Split(query.Get("productCodes"), ","),
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.inFlight++
+	if f.inFlight > f.maxInFlight {
+		f.maxInFlight = f.inFlight
+	}
+	respond := f.respond
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	status, products := respond(req)
+	w.WriteHeader(status)
+	if status == http.StatusOK {
+		json.NewEncoder(w).Encode(map[string]interface{}{"products": products})
+	}
+}
+
+func (f *fakeVA) received() []vaRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]vaRequest(nil), f.requests...)
+}
+
+// inStock answers a request with every product at every store
+func inStock(r vaRequest, quantity int) []stock {
+	var products []stock
+	for _, store := range r.stores {
+		id, _ := strconv.Atoi(store)
+		for _, product := range r.products {
+			var s stock
+			s.ProductID = product
+			s.StoreInfo.Quantity = quantity
+			s.StoreInfo.StoreID = id
+			products = append(products, s)
+		}
+	}
+	return products
+}
+
+// newTestTracker returns a tracker for the stand-in server with no rate
+// limit and millisecond backoff
+func newTestTracker(serverURL string, stores []string, products map[string]string) *Tracker {
+	t := &Tracker{
+		stores:       stores,
+		products:     products,
+		batchSize:    DefaultBatchSize,
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		inventoryURL: serverURL,
+		minBackoff:   time.Millisecond,
+		maxBackoff:   4 * time.Millisecond,
+	}
+	config := tracker.DefaultConfig()
+	config.RequestsPerSecond = 0
+	config.Timeout = 5 * time.Second
+	t.SetConfig(config)
+	return t
+}
+
+// storeNumbers returns "1" through "n"
+func storeNumbers(n int) []string {
+	stores := make([]string, n)
+	for i := range stores {
+		stores[i] = strconv.Itoa(i + 1)
+	}
+	return stores
+}
+
+// itemKeys returns sorted "store/product" keys for items
+func itemKeys(items []tracker.InventoryItem) []string {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.StoreID + "/" + item.ProductID
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestTrackStreamWorkerLimit(t *testing.T) {
+	fake := newFakeVA(t)
+	fake.respond = func(r vaRequest) (int, []stock) {
+		time.Sleep(20 * time.Millisecond) // Long enough for the workers to overlap
+		return http.StatusOK, inStock(r, 1)
+	}
+
+	va := newTestTracker(fake.URL, storeNumbers(12), map[string]string{"018006": "Buffalo Trace"})
+	va.SetBatchSize(1)
+	config := va.config
+	config.Workers = 3
+	va.SetConfig(config)
+
+	result, err := tracker.Collect(context.Background(), va, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Items) != 12 || result.StoresSucceeded != 12 {
+		t.Errorf("got %d items from %d stores, want 12 from 12", len(result.Items), result.StoresSucceeded)
+	}
+	if fake.maxInFlight != 3 {
+		t.Errorf("at most %d requests in flight, want 3 (the worker count)", fake.maxInFlight)
+	}
+}
+
+func TestTrackStreamRateLimit(t *testing.T) {
+	fake := newFakeVA(t)
+	va := newTestTracker(fake.URL, storeNumbers(5), map[string]string{"018006": "Buffalo Trace"})
+	va.SetBatchSize(1)
+	config := va.config
+	config.RequestsPerSecond = 50 // One request every 20ms across all workers
+	va.SetConfig(config)
+
+	start := time.Now()
+	if _, err := tracker.Collect(context.Background(), va, nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("5 requests at 50/s took %s, want at least 80ms", elapsed)
+	}
+}
+
+func TestTrackStreamRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int // Answers before the request succeeds
+	}{
+		{"rate limited", []int{http.StatusTooManyRequests}},
+		{"server errors", []int{http.StatusServiceUnavailable, http.StatusInternalServerError}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeVA(t)
+			calls := 0
+			fake.respond = func(r vaRequest) (int, []stock) {
+				calls++
+				if calls <= len(tt.statuses) {
+					return tt.statuses[calls-1], nil
+				}
+				return http.StatusOK, inStock(r, 2)
+			}
+
+			va := newTestTracker(fake.URL, []string{"247"}, map[string]string{"016850": "Blanton's"})
+			var requests []tracker.Event
+			result, err := tracker.Collect(context.Background(), va, func(ev tracker.Event) {
+				if ev.Kind == tracker.EventRequest {
+					requests = append(requests, ev)
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(result.Items) != 1 || len(result.Failures) != 0 {
+				t.Errorf("got %d items and failures %v, want the item after retrying", len(result.Items), result.Failures)
+			}
+			if len(requests) != len(tt.statuses)+1 {
+				t.Fatalf("recorded %d requests, want %d", len(requests), len(tt.statuses)+1)
+			}
+			for i, ev := range requests {
+				want := http.StatusOK
+				if i < len(tt.statuses) {
+					want = tt.statuses[i]
+				}
+				if ev.Status != want || ev.Attempt != i+1 {
+					t.Errorf("request %d: status %d attempt %d, want %d attempt %d", i, ev.Status, ev.Attempt, want, i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestTrackStreamGivesUp(t *testing.T) {
+	fake := newFakeVA(t)
+	fake.respond = func(vaRequest) (int, []stock) { return http.StatusTooManyRequests, nil }
+
+	va := newTestTracker(fake.URL, []string{"247"}, map[string]string{"016850": "Blanton's"})
+	result, err := tracker.Collect(context.Background(), va, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []tracker.Failure{{StoreID: "247", Attempts: va.config.MaxRetries, LastStatus: http.StatusTooManyRequests, LastError: "Too Many Requests"}}
+	if len(result.Failures) != 1 || result.Failures[0] != want[0] {
+		t.Errorf("failures = %+v, want %+v", result.Failures, want)
+	}
+	if got := len(fake.received()); got != va.config.MaxRetries {
+		t.Errorf("made %d requests, want %d", got, va.config.MaxRetries)
+	}
+}
+
+func TestTrackStreamCancel(t *testing.T) {
+	fake := newFakeVA(t)
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{}, 100)
+	fake.respond = func(r vaRequest) (int, []stock) {
+		started <- struct{}{}
+		<-release
+		return http.StatusOK, inStock(r, 1)
+	}
+
+	va := newTestTracker(fake.URL, storeNumbers(40), map[string]string{"018006": "Buffalo Trace"})
+	va.SetBatchSize(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	var stores int
+	go func() {
+		done <- va.TrackStream(ctx, func(ev tracker.Event) {
+			if ev.Kind == tracker.EventStore {
+				stores++
+			}
+		})
+	}()
+
+	<-started
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("TrackStream returned %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("TrackStream did not return after cancellation")
+	}
+	if stores != 0 {
+		t.Errorf("%d stores reported complete; none finished before cancellation", stores)
+	}
+}
+
+func TestSplitProducts(t *testing.T) {
+	tests := []struct {
+		name   string
+		codes  []string
+		budget int
+		want   []string
+	}{
+		{"fits", []string{"000001", "000002"}, 100, []string{"000001,000002"}},
+		// A comma is escaped to %2C, so two codes take 6+3+6 characters
+		{"split", []string{"000001", "000002", "000003"}, 15, []string{"000001,000002", "000003"}},
+		{"one per list", []string{"000001", "000002"}, 6, []string{"000001", "000002"}},
+		{"code over budget", []string{"000001"}, 3, []string{"000001"}},
+		{"none", nil, 100, []string{""}},
+	}
+
+	for _, tt := range tests {
+		got := splitProducts(tt.codes, tt.budget)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: splitProducts = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlanBatches(t *testing.T) {
+	products := make(map[string]string)
+	for i := 0; i < 400; i++ {
+		products[strconv.Itoa(100000+i)] = "Product"
+	}
+	va := newTestTracker(DefaultInventoryURL, storeNumbers(25), products)
+
+	batches := va.planBatches()
+	covered := make(map[string]int) // store/product -> requests covering it
+	groups := make(map[string]bool)
+	for _, b := range batches {
+		if u := va.requestURL(b.stores, b.products); len(u) > maxURLLength {
+			t.Errorf("request URL is %d characters, over %d", len(u), maxURLLength)
+		}
+		groups[strings.Join(b.stores, ",")] = true
+		for _, store := range b.stores {
+			for _, product := range strings.Split(b.products, ",") {
+				covered[store+"/"+product]++
+			}
+		}
+	}
+
+	if len(groups) != 3 {
+		t.Errorf("stores split into %d batches, want 3 of at most 10", len(groups))
+	}
+	if len(batches) <= len(groups) {
+		t.Errorf("%d requests for %d batches; 400 products should need several per batch", len(batches), len(groups))
+	}
+	if len(covered) != 25*400 {
+		t.Errorf("requests cover %d store/product pairs, want %d", len(covered), 25*400)
+	}
+	for pair, n := range covered {
+		if n != 1 {
+			t.Errorf("%s requested %d times", pair, n)
+		}
+	}
+}
+
+func TestTrackStreamBatches(t *testing.T) {
+	fake := newFakeVA(t)
+	va := newTestTracker(fake.URL, storeNumbers(25), map[string]string{"016850": "Blanton's", "018006": "Buffalo Trace"})
+
+	result, err := tracker.Collect(context.Background(), va, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sizes []int
+	for _, r := range fake.received() {
+		sizes = append(sizes, len(r.stores))
+	}
+	sort.Ints(sizes)
+	if want := []int{5, 10, 10}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("batch sizes = %v, want %v", sizes, want)
+	}
+
+	var want []string
+	for _, store := range storeNumbers(25) {
+		want = append(want, store+"/016850", store+"/018006")
+	}
+	sort.Strings(want)
+	if got := itemKeys(result.Items); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("items = %v, want every product at every store", got)
+	}
+	for _, item := range result.Items {
+		if item.StoreURL != "https://www.abc.virginia.gov/stores/store-"+item.StoreID {
+			t.Errorf("store %s has URL %s", item.StoreID, item.StoreURL)
+		}
+	}
+	if result.StoresSucceeded != 25 || len(result.Failures) != 0 {
+		t.Errorf("%d stores succeeded with failures %v, want 25 and none", result.StoresSucceeded, result.Failures)
+	}
+}
+
+func TestTrackStreamAttributesByStoreID(t *testing.T) {
+	fake := newFakeVA(t)
+	fake.respond = func(r vaRequest) (int, []stock) {
+		// Store 2 has nothing, store 3 has twice what store 1 has, and an
+		// unrequested store is thrown in
+		var products []stock
+		for _, s := range inStock(vaRequest{stores: []string{"3", "1", "99"}, products: r.products}, 1) {
+			if s.StoreInfo.StoreID == 3 {
+				s.StoreInfo.Quantity = 2
+			}
+			products = append(products, s)
+		}
+		return http.StatusOK, products
+	}
+
+	va := newTestTracker(fake.URL, []string{"001", "2", "3"}, map[string]string{"016850": "Blanton's"})
+	var completed []string
+	result, err := tracker.Collect(context.Background(), va, func(ev tracker.Event) {
+		if ev.Kind == tracker.EventStore && ev.Err == nil {
+			completed = append(completed, ev.StoreID)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quantities := make(map[string]int)
+	for _, item := range result.Items {
+		quantities[item.StoreID] = item.Quantity
+	}
+	if len(quantities) != 2 || quantities["1"] != 1 || quantities["3"] != 2 {
+		t.Errorf("quantities by store = %v, want 1 at store 1 and 2 at store 3", quantities)
+	}
+
+	// A store missing from the response was scanned and has nothing in stock
+	sort.Strings(completed)
+	if strings.Join(completed, ",") != "001,2,3" || len(result.Failures) != 0 {
+		t.Errorf("completed stores = %v, failures = %v; want all three without failures", completed, result.Failures)
+	}
+}
+
+func TestTrackStreamBatchFallback(t *testing.T) {
+	fake := newFakeVA(t)
+	fake.respond = func(r vaRequest) (int, []stock) {
+		switch {
+		case len(r.stores) > 1:
+			return http.StatusBadRequest, nil // A bad store number fails the whole batch
+		case r.stores[0] == "3":
+			return http.StatusInternalServerError, nil
+		}
+		return http.StatusOK, inStock(r, 4)
+	}
+
+	va := newTestTracker(fake.URL, []string{"1", "2", "3", "4"}, map[string]string{"016850": "Blanton's"})
+	va.SetBatchSize(4)
+	result, err := tracker.Collect(context.Background(), va, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := itemKeys(result.Items), []string{"1/016850", "2/016850", "4/016850"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("items = %v, want %v", got, want)
+	}
+	retries := va.config.MaxRetries
+	wantFailures := []tracker.Failure{{StoreID: "3", Attempts: retries, LastStatus: http.StatusInternalServerError, LastError: "Internal Server Error"}}
+	if !reflect.DeepEqual(result.Failures, wantFailures) {
+		t.Errorf("failures = %+v, want %+v", result.Failures, wantFailures)
+	}
+	if result.StoresAttempted != 4 || result.StoresSucceeded != 3 {
+		t.Errorf("stores attempted %d, succeeded %d; want 4 and 3", result.StoresAttempted, result.StoresSucceeded)
+	}
+
+	// The batch is tried until it gives up, then each store on its own
+	batchRequests, singleRequests := 0, 0
+	for _, r := range fake.received() {
+		if len(r.stores) > 1 {
+			batchRequests++
+		} else {
+			singleRequests++
+		}
+	}
+	if batchRequests != retries || singleRequests != 3+retries {
+		t.Errorf("%d batch and %d single-store requests, want %d and %d", batchRequests, singleRequests, retries, 3+retries)
+	}
+}